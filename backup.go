@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+// runTool runs an external tool. The connection string in its arguments has
+// no password, which would show in the process list; the tool gets it from
+// PGPASSWORD instead.
+func runTool(ctx context.Context, password string, name string, toolArgs ...string) error {
+	if os.Getenv("PG_TENANT_SETUP_DRY_RUN") != "" {
+		fmt.Fprintf(os.Stdout, "-- %s %s\n", name, strings.Join(redactToolArgs(toolArgs), " "))
+		return nil
+	}
+
+	// pg_dump only reads, every other tool writes to the tenant
+	if os.Getenv("PG_TENANT_SETUP_READ_ONLY") != "" && name != "pg_dump" {
+		return fmt.Errorf("refusing to run %s in read-only mode", name)
+	}
+
+	// tools quote their connection string in error messages
+	cmd := exec.CommandContext(ctx, name, toolArgs...)
+	if password != "" {
+		cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
+	}
+	stdout := &redactingWriter{w: os.Stderr}
+	stderr := &redactingWriter{w: os.Stderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+
+	return err
+}
+
+func redactToolArgs(toolArgs []string) (redacted []string) {
+	for _, arg := range toolArgs {
+		redacted = append(redacted, pg.RedactDSN(arg))
+	}
+	return
+}
+
+// redactingWriter scrubs connection string passwords from the output line by
+// line, so that a password split across writes is still caught. Flush writes
+// the last line when it has no newline.
+type redactingWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+
+	end := bytes.LastIndexByte(r.pending, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	_, err := io.WriteString(r.w, pg.RedactDSN(string(r.pending[:end+1])))
+	r.pending = slices.Clone(r.pending[end+1:])
+	return len(p), err
+}
+
+func (r *redactingWriter) Flush() {
+	if len(r.pending) > 0 {
+		io.WriteString(r.w, pg.RedactDSN(string(r.pending)))
+		r.pending = nil
+	}
+}
+
+func backupTenant() {
+	var args struct {
+		SchemaName string `cli:"#R, -s, --schema-name, Schema name"`
+		OutputFile string `cli:"#R, -o, --output, Archive file to write, in pg_dump custom format"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	connString, err := pg.ConnStringWithDatabase(args.ConnectionString, args.DBName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	connString, password, err := pg.ConnStringWithoutPassword(connString)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	// ownership and grants are re-applied by restore-tenant for the target tenant
+	err = runTool(ctx, password, "pg_dump",
+		"--dbname="+connString,
+		"--schema="+args.SchemaName,
+		"--format=custom",
+		"--no-owner",
+		"--no-privileges",
+		"--file="+args.OutputFile,
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to back up tenant schema: %v\n", err)
+		exit(1)
+	}
+}
+
+func restoreTenant() {
+	var args struct {
+		SchemaName string `cli:"#R, -s, --schema-name, Schema name, as in the archive"`
+		InputFile  string `cli:"#R, -i, --input, Archive file written by backup-tenant"`
+		Clean      bool   `cli:"--clean, Drop the schema's existing objects before restoring"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	connString, err := pg.ConnStringWithDatabase(args.ConnectionString, args.DBName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	connString, password, err := pg.ConnStringWithoutPassword(connString)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	tenantName := args.TenantName
+	if tenantName == "" {
+		tenantName = args.DBName
+	}
+
+	// restored objects are owned by the target tenant's owner, whatever roles
+	// owned them in the source
+	restoreArgs := []string{
+		"--dbname=" + connString,
+		"--role=" + pg.TenantOwnerName(tenantName),
+		"--no-owner",
+		"--no-privileges",
+		"--exit-on-error",
+		"--single-transaction",
+	}
+
+	if args.Clean {
+		restoreArgs = append(restoreArgs, "--clean", "--if-exists")
+	}
+
+	err = runTool(ctx, password, "pg_restore", append(restoreArgs, args.InputFile)...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to restore tenant schema: %v\n", err)
+		exit(1)
+	}
+
+	err = pgInstance.FixTenantSchemaPermissions(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName}, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to re-apply tenant permissions: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRedactingWriterSplitWrites(t *testing.T) {
+	output := `pg_dump: error: connection to "postgres://app:s3cret@db/acme" failed` + "\n" + "password=hunter2 host=db"
+
+	for size := 1; size <= len(output); size++ {
+		var b strings.Builder
+		w := &redactingWriter{w: &b}
+
+		for chunk := range slices.Chunk([]byte(output), size) {
+			n, err := w.Write(chunk)
+			if err != nil || n != len(chunk) {
+				t.Fatalf("Write() = %d, %v", n, err)
+			}
+		}
+		w.Flush()
+
+		got := b.String()
+		if strings.Contains(got, "s3cret") || strings.Contains(got, "hunter2") {
+			t.Errorf("chunks of %d bytes: password not redacted in %q", size, got)
+		}
+		if !strings.HasSuffix(got, "host=db") {
+			t.Errorf("chunks of %d bytes: output cut short: %q", size, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jxskiss/mcli"
+)
+
+func bootstrap() {
+	var args struct {
+		RoleName              string `cli:"-r, --role-name, Name of the control role" default:"tenant_setup"`
+		ConnectionString      string `cli:"-c, --connection-string, PostgreSQL connection string of a superuser" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		OutputSQLFile         string `cli:"#E, File name to save executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_SQL_FILE"`
+		OutputCredentialsFile string `cli:"#E, File name to save the control role credentials to" env:"PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"`
+		CredentialsStdout     bool   `cli:"--credentials-stdout, Print the control role credentials to stdout and never write files" env:"PG_TENANT_SETUP_CREDENTIALS_STDOUT"`
+		DryRun                bool   `cli:"--dry-run, Print the SQL statements to stdout instead of executing them" env:"PG_TENANT_SETUP_DRY_RUN"`
+	}
+	mcli.Parse(&args)
+
+	if args.CredentialsStdout && (args.OutputCredentialsFile != "" || args.OutputSQLFile != "") {
+		fmt.Fprintf(os.Stderr, "refusing to write output files with --credentials-stdout\n")
+		exit(1)
+	}
+
+	exportEnv("PG_TENANT_SETUP_CREDENTIALS_STDOUT", args.CredentialsStdout)
+	exportEnv("PG_TENANT_SETUP_DRY_RUN", args.DryRun)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	_, err := pgInstance.BootstrapControlRole(ctx, args.RoleName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to bootstrap control role: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func checkConnection() {
+	var args struct {
+		ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string used for host and connection options" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		CredentialsFile  string `cli:"#R, -f, --credentials-file, Schema users credentials JSON file"`
+		DBName           string `cli:"#R, -d, --database-name, Database name"`
+		SchemaName       string `cli:"-s, --schema-name, Schema name to read a table from"`
+		ReadOnly         bool   `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+
+	data, err := os.ReadFile(args.CredentialsFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read credentials file: %v\n", err)
+		exit(1)
+	}
+
+	users, err := credentialsFileUsers(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to parse credentials file: %v\n", err)
+		exit(1)
+	}
+
+	if len(users) == 0 {
+		fmt.Fprintf(os.Stderr, "no users found in credentials file %s\n", args.CredentialsFile)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	failed := false
+	for _, user := range users {
+		check := pg.CheckUserConnection(ctx, args.ConnectionString, args.DBName, args.SchemaName, user)
+
+		status := "ok"
+		if !check.OK {
+			status = "failed"
+			failed = true
+		}
+		fmt.Printf("%s: %s\n", check.Username, status)
+
+		for _, p := range check.Probes {
+			if p.OK {
+				fmt.Printf("  %s: ok\n", p.Name)
+			} else {
+				fmt.Printf("  %s: %s\n", p.Name, p.Error)
+			}
+		}
+	}
+
+	if failed {
+		exit(1)
+	}
+}
+
+// credentialsFileUsers finds the users in any credentials document this tool
+// writes: a schema's users, blue/green pairs, a single role's split file, the
+// CDC user, or a batch keyed by tenant and schema. Every object with a
+// username is a user.
+func credentialsFileUsers(data []byte) (users []pg.UserCredentials, err error) {
+	var document any
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return
+	}
+
+	seen := map[string]bool{}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if username, ok := v["username"].(string); ok && username != "" {
+				if !seen[username] {
+					seen[username] = true
+					password, _ := v["password"].(string)
+					users = append(users, pg.UserCredentials{Username: username, Password: password})
+				}
+				return
+			}
+
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				walk(v[key])
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(document)
+
+	return
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCredentialsFileUsers(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "schema users",
+			data: `{"admin":{"username":"adm","password":"p"},"readwrite":{"username":"rw","password":"p"},"readonly":{"username":"ro","password":"p"},"cdc":{"username":"cdc","password":"p"}}`,
+			want: []string{"adm", "cdc", "ro", "rw"},
+		},
+		{
+			name: "dual users",
+			data: `{"admin":{"live":"adm_a","a":{"username":"adm_a","password":"p"},"b":{"username":"adm_b","password":"p"}}}`,
+			want: []string{"adm_a", "adm_b"},
+		},
+		{
+			name: "split role file",
+			data: `{"username":"rw","password":"p","uri":"postgres://rw@db/acme"}`,
+			want: []string{"rw"},
+		},
+		{
+			name: "batch",
+			data: `{"acme":{"app":{"readonly":{"username":"ro","password":"p"}},"billing":{"readonly":{"username":"ro2","password":"p"}}}}`,
+			want: []string{"ro", "ro2"},
+		},
+		{
+			name: "no users",
+			data: `{"admin":{"password":"p"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := credentialsFileUsers([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, user := range users {
+				got = append(got, user.Username)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("credentialsFileUsers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+const completionTimeout = 2 * time.Second
+
+func catalogCompletion() mcli.ParseOpt {
+	return mcli.WithArgCompFuncs(map[string]mcli.ArgCompletionFunc{
+		"-d": completeDatabases,
+		"-s": completeSchemas,
+	})
+}
+
+func completionFlag(ctx mcli.ArgCompletionContext, name string, envVar string) string {
+	if f := ctx.FlagSet().Lookup(name); f != nil && f.Value.String() != "" {
+		return f.Value.String()
+	}
+	return os.Getenv(envVar)
+}
+
+func completionItems(ctx mcli.ArgCompletionContext, names []string) (items []mcli.CompletionItem) {
+	for _, name := range names {
+		if strings.HasPrefix(name, ctx.ArgPrefix()) {
+			items = append(items, mcli.CompletionItem{Value: name})
+		}
+	}
+	return
+}
+
+func completeDatabases(ctx mcli.ArgCompletionContext) []mcli.CompletionItem {
+	timeoutCtx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	connString := completionFlag(ctx, "connection-string", "PG_TENANT_SETUP_CONNECTION_STRING")
+
+	dbNames, err := pg.ListDatabases(timeoutCtx, connString)
+	if err != nil {
+		return nil
+	}
+
+	return completionItems(ctx, dbNames)
+}
+
+func completeSchemas(ctx mcli.ArgCompletionContext) []mcli.CompletionItem {
+	timeoutCtx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	connString := completionFlag(ctx, "connection-string", "PG_TENANT_SETUP_CONNECTION_STRING")
+	dbName := completionFlag(ctx, "database-name", "")
+
+	schemaNames, err := pg.ListSchemas(timeoutCtx, connString, dbName)
+	if err != nil {
+		return nil
+	}
+
+	return completionItems(ctx, schemaNames)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+)
+
+// readSchemaRequests reads a CSV file with a header row naming the db, schema,
+// tenant and optional blueprint columns. Rows with an empty db column use
+// defaultDB, which is already namespaced.
+func readSchemaRequests(filename string, defaultDB string) (requests []pg.SchemaRequest, err error) {
+	err = readCSVRows(filename, "schema", func(line int, field func(name string) string) error {
+		req := pg.SchemaRequest{
+			DBName:     pg.Namespaced(field("db")),
+			SchemaName: pg.Namespaced(field("schema")),
+			TenantName: pg.Namespaced(field("tenant")),
+			Blueprint:  field("blueprint"),
+		}
+
+		if req.DBName == "" {
+			req.DBName = defaultDB
+		}
+
+		if req.SchemaName == "" {
+			return fmt.Errorf("line %d: missing schema", line)
+		}
+
+		requests = append(requests, req)
+		return nil
+	})
+
+	return
+}
+
+// readCSVRows calls fn for each row of a CSV file with a header row, which
+// must have the required column. Columns are looked up by name.
+func readCSVRows(filename string, required string, fn func(line int, field func(name string) string) error) (err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		err = fmt.Errorf("unable to read header: %w", err)
+		return
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns[required]; !ok {
+		err = fmt.Errorf("missing %s column", required)
+		return
+	}
+
+	for line := 2; ; line++ {
+		var record []string
+		record, err = r.Read()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		err = fn(line, field)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func deleteDB() {
+	var args struct {
+		DropReplication bool   `cli:"--drop-replication, Drop the database's replication slots instead of refusing to delete it" env:"PG_TENANT_SETUP_DROP_REPLICATION"`
+		Scope           string `cli:"--scope, What to delete: users (the login users of its schemas), grants (what its schema groups were granted), or all" default:"all"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	validateDeleteScope(args.Scope)
+	exportEnv("PG_TENANT_SETUP_DROP_REPLICATION", args.DropReplication)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	var err error
+	switch args.Scope {
+	case deleteScopeUsers:
+		err = pgInstance.DeleteTenantDBUsers(ctx, args.DBName, args.TenantName)
+	case deleteScopeGrants:
+		err = pgInstance.RevokeTenantDBGrants(ctx, args.DBName, args.TenantName)
+	default:
+		err = pgInstance.DeleteTenantDB(ctx, args.DBName, args.TenantName)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to delete tenant database: %v\n", err)
+		exit(1)
+	}
+}
+
+func deleteSchema() {
+	var args struct {
+		SchemaName      string `cli:"#R, -s, --schema-name, Schema name"`
+		DropReplication bool   `cli:"--drop-replication, Drop the schema's publications and replication slots instead of refusing to delete it" env:"PG_TENANT_SETUP_DROP_REPLICATION"`
+		Scope           string `cli:"--scope, What to delete: users (its login users), grants (what its groups were granted), or all" default:"all"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	validateDeleteScope(args.Scope)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+	exportEnv("PG_TENANT_SETUP_DROP_REPLICATION", args.DropReplication)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	connConfig := pg.ConnectDBConfig{DBName: args.DBName}
+
+	var err error
+	switch args.Scope {
+	case deleteScopeUsers:
+		err = pgInstance.DeleteTenantSchemaUsers(ctx, args.SchemaName, args.TenantName, connConfig)
+	case deleteScopeGrants:
+		err = pgInstance.RevokeTenantSchemaGrants(ctx, args.SchemaName, args.TenantName, connConfig)
+	default:
+		err = pgInstance.DeleteTenantSchema(ctx, args.SchemaName, args.TenantName, connConfig)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to delete tenant schema: %v\n", err)
+		exit(1)
+	}
+}
+
+// delete scopes: users revokes an application's access and keeps the data,
+// grants also cuts off the groups' privileges, all drops the tenant's data
+const (
+	deleteScopeUsers  = "users"
+	deleteScopeGrants = "grants"
+	deleteScopeAll    = "all"
+)
+
+func validateDeleteScope(scope string) {
+	switch scope {
+	case deleteScopeUsers, deleteScopeGrants, deleteScopeAll:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown scope %q, supported scopes: %s, %s, %s\n", scope, deleteScopeUsers, deleteScopeGrants, deleteScopeAll)
+		exit(1)
+	}
+}
+
+// parseGracePeriod accepts a whole number of days such as 7d on top of the
+// units of time.ParseDuration, which has none for days
+func parseGracePeriod(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid grace period %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func deleteTenant() {
+	var args struct {
+		GracePeriod string `cli:"#R, --grace-period, Time to keep the disabled tenant before purge drops it, e.g. 7d or 12h"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+
+	gracePeriod, err := parseGracePeriod(args.GracePeriod)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	_, err = pgInstance.SoftDeleteTenantDB(ctx, args.DBName, args.TenantName, gracePeriod)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to disable tenant database: %v\n", err)
+		exit(1)
+	}
+}
+
+func purge() {
+	var args struct {
+		ConnectionString     string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		OutputSQLFile        string `cli:"#E, File name to save executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_SQL_FILE"`
+		DryRun               bool   `cli:"--dry-run, Print the SQL statements to stdout instead of executing them" env:"PG_TENANT_SETUP_DRY_RUN"`
+		Verbose              bool   `cli:"-v, --verbose, Echo each SQL statement and its timing to stderr" env:"PG_TENANT_SETUP_VERBOSE"`
+		TerminateConnections bool   `cli:"--terminate-connections, Terminate sessions of tenant roles before dropping schemas and roles" env:"PG_TENANT_SETUP_TERMINATE_CONNECTIONS"`
+		DropReplication      bool   `cli:"--drop-replication, Drop the databases' replication slots instead of refusing to purge them" env:"PG_TENANT_SETUP_DROP_REPLICATION"`
+		Namespace            string `cli:"--namespace, Only purge databases in this namespace" env:"PG_TENANT_SETUP_NAMESPACE"`
+		LeastPrivilege       bool   `cli:"--least-privilege, Run under a non-superuser control role, skipping superuser-only steps" env:"PG_TENANT_SETUP_LEAST_PRIVILEGE"`
+		Operator             string `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+	}
+	mcli.Parse(&args)
+
+	exportEnv("PG_TENANT_SETUP_DRY_RUN", args.DryRun)
+	exportEnv("PG_TENANT_SETUP_VERBOSE", args.Verbose)
+	exportEnv("PG_TENANT_SETUP_TERMINATE_CONNECTIONS", args.TerminateConnections)
+	exportEnv("PG_TENANT_SETUP_DROP_REPLICATION", args.DropReplication)
+	exportEnv("PG_TENANT_SETUP_LEAST_PRIVILEGE", args.LeastPrivilege)
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	setupNamespace(args.Namespace)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	purged, err := pgInstance.PurgeTenantDBs(ctx, time.Now())
+	for _, p := range purged {
+		fmt.Fprintf(os.Stderr, "purged tenant database %s\n", p.DBName)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to purge tenant databases: %v\n", err)
+		exit(1)
+	}
+}
+
+func reap() {
+	var args struct {
+		ConnectionString     string        `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		DBName               string        `cli:"-d, --database-name, Only reap schemas in this database"`
+		OutputSQLFile        string        `cli:"#E, File name to save executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_SQL_FILE"`
+		Interval             time.Duration `cli:"--interval, Keep running and reap at this interval, e.g. 10m"`
+		DryRun               bool          `cli:"--dry-run, Print the SQL statements to stdout instead of executing them" env:"PG_TENANT_SETUP_DRY_RUN"`
+		Verbose              bool          `cli:"-v, --verbose, Echo each SQL statement and its timing to stderr" env:"PG_TENANT_SETUP_VERBOSE"`
+		TerminateConnections bool          `cli:"--terminate-connections, Terminate sessions of tenant roles before dropping schemas and roles" env:"PG_TENANT_SETUP_TERMINATE_CONNECTIONS"`
+		DropReplication      bool          `cli:"--drop-replication, Drop the schemas' publications and replication slots instead of refusing to reap them" env:"PG_TENANT_SETUP_DROP_REPLICATION"`
+		Namespace            string        `cli:"--namespace, Only reap schemas in this namespace" env:"PG_TENANT_SETUP_NAMESPACE"`
+		LeastPrivilege       bool          `cli:"--least-privilege, Run under a non-superuser control role, skipping superuser-only steps" env:"PG_TENANT_SETUP_LEAST_PRIVILEGE"`
+		Operator             string        `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+	}
+	mcli.Parse(&args)
+
+	exportEnv("PG_TENANT_SETUP_DRY_RUN", args.DryRun)
+	exportEnv("PG_TENANT_SETUP_VERBOSE", args.Verbose)
+	exportEnv("PG_TENANT_SETUP_TERMINATE_CONNECTIONS", args.TerminateConnections)
+	exportEnv("PG_TENANT_SETUP_DROP_REPLICATION", args.DropReplication)
+	exportEnv("PG_TENANT_SETUP_LEAST_PRIVILEGE", args.LeastPrivilege)
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	setupNamespace(args.Namespace)
+
+	var dbNames []string
+	if args.DBName != "" {
+		dbNames = append(dbNames, pg.Namespaced(args.DBName))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	for {
+		reaped, err := pgInstance.ReapTenantSchemas(ctx, time.Now(), dbNames...)
+		for _, s := range reaped {
+			fmt.Fprintf(os.Stderr, "reaped schema %s in database %s\n", s.SchemaName, s.DBName)
+		}
+
+		if err == nil {
+			var dropped []string
+			dropped, err = pgInstance.ReapGraceUsers(ctx, time.Now())
+			for _, roleName := range dropped {
+				fmt.Fprintf(os.Stderr, "disabled expired user %s\n", roleName)
+			}
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to reap: %v\n", err)
+			// a one-off run fails, a periodic one tries again next time
+			if args.Interval == 0 {
+				exit(1)
+			}
+		}
+
+		if args.Interval == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(args.Interval):
+		}
+	}
+}
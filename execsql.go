@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func execSQL() {
+	var args struct {
+		File       string `cli:"#R, --file, SQL file to execute"`
+		SchemaName string `cli:"-s, --schema-name, Schema to resolve unqualified names in"`
+		AsOwner    bool   `cli:"--as-owner, Run the SQL as the tenant owner role instead of the connecting role"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	if _, err := os.Stat(args.File); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read SQL file: %v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	err := pgInstance.ExecSQLFile(ctx, args.File, args.SchemaName, args.TenantName, args.AsOwner, pg.ConnectDBConfig{DBName: args.DBName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to execute SQL file: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func fixPermissions() {
+	var args struct {
+		SchemaName     string `cli:"#R, -s, --schema-name, Schema name"`
+		PartitionsOnly bool   `cli:"--partitions-only, Only grant on partitions missing the tenant privileges"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	err := pgInstance.FixTenantSchemaPermissions(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName}, args.PartitionsOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to fix tenant permissions: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+)
+
+// writeGitHubOutput appends results to the file GitHub Actions names in
+// GITHUB_OUTPUT, for later steps to read as steps.<id>.outputs.<key>. Step
+// outputs aren't masked, so passwords never go there; the credentials files
+// they were written to are referenced instead.
+func writeGitHubOutput(outputs ...string) {
+	if os.Getenv("PG_TENANT_SETUP_GITHUB_OUTPUT") == "" {
+		return
+	}
+
+	var b strings.Builder
+	for i := 0; i+1 < len(outputs); i += 2 {
+		if outputs[i+1] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", outputs[i], outputs[i+1])
+		}
+	}
+
+	f, err := os.OpenFile(os.Getenv("GITHUB_OUTPUT"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.WriteString(b.String())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write GitHub outputs: %v\n", err)
+	}
+}
+
+func gitHubOutputDB(dbName string, tenantName string) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	writeGitHubOutput(
+		"database", dbName,
+		"owner_role", pg.TenantOwnerName(roleNamePrefix),
+	)
+}
+
+func gitHubOutputSchema(result pg.SchemaProvisionResult) {
+	outputs := []string{
+		"database", result.DBName,
+		"schema", result.SchemaName,
+		"admin_group", result.Groups.Admin,
+		"readwrite_group", result.Groups.ReadWrite,
+		"readonly_group", result.Groups.ReadOnly,
+	}
+
+	cdc := false
+
+	// the live user of each pair with --dual-users
+	switch users := result.Users.(type) {
+	case pg.SchemaUsers:
+		outputs = append(outputs,
+			"admin_user", users.Admin.Username,
+			"readwrite_user", users.ReadWrite.Username,
+			"readonly_user", users.ReadOnly.Username,
+		)
+		if users.CDC != nil {
+			outputs = append(outputs, "cdc_user", users.CDC.Username)
+			cdc = true
+		}
+	case pg.DualSchemaUsers:
+		outputs = append(outputs,
+			"admin_user", users.Admin.Live,
+			"readwrite_user", users.ReadWrite.Live,
+			"readonly_user", users.ReadOnly.Live,
+		)
+		if users.CDC != nil {
+			outputs = append(outputs, "cdc_user", users.CDC.Username)
+			cdc = true
+		}
+	}
+
+	if result.Users != nil {
+		outputs = append(outputs, gitHubOutputCredentials(cdc)...)
+	}
+
+	writeGitHubOutput(outputs...)
+}
+
+// gitHubOutputExistingSchema writes the outputs of a schema skipped with
+// --exit-zero-if-exists; its users and credentials are left out since this
+// run didn't create them
+func gitHubOutputExistingSchema(dbName string, schemaName string, tenantName string) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	gitHubOutputSchema(pg.SchemaProvisionResult{
+		DBName:     dbName,
+		SchemaName: schemaName,
+		Groups:     pg.TenantSchemaGroupNames(roleNamePrefix, schemaName),
+	})
+}
+
+// gitHubOutputSchemas writes the schemas created from a CSV file as
+// comma-separated lists, since there is one output per key
+func gitHubOutputSchemas(requests []pg.SchemaRequest) {
+	var dbNames, schemaNames []string
+	for _, req := range requests {
+		dbNames = append(dbNames, req.DBName)
+		schemaNames = append(schemaNames, req.SchemaName)
+	}
+
+	outputs := []string{
+		"databases", strings.Join(dbNames, ","),
+		"schemas", strings.Join(schemaNames, ","),
+	}
+
+	// batches are written to one credentials file
+	if os.Getenv("PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE") != "" && os.Getenv("PG_TENANT_SETUP_DRY_RUN") == "" {
+		outputs = append(outputs, "credentials_file", os.Getenv("PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"))
+	}
+
+	writeGitHubOutput(outputs...)
+}
+
+// gitHubOutputCredentials references the credentials files written by the
+// command, which a later step can read or upload
+func gitHubOutputCredentials(cdc bool) []string {
+	filename := os.Getenv("PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE")
+	if filename == "" || os.Getenv("PG_TENANT_SETUP_DRY_RUN") != "" {
+		return nil
+	}
+
+	if os.Getenv("PG_TENANT_SETUP_SPLIT_CREDENTIALS") == "" {
+		return []string{"credentials_file", filename}
+	}
+
+	// split credentials files sit next to the credentials file
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	outputs := []string{
+		"admin_credentials_file", base + ".admin" + ext,
+		"readwrite_credentials_file", base + ".readwrite" + ext,
+		"readonly_credentials_file", base + ".readonly" + ext,
+	}
+	if cdc {
+		outputs = append(outputs, "cdc_credentials_file", base+".cdc"+ext)
+	}
+
+	return outputs
+}
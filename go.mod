@@ -5,6 +5,7 @@ go 1.23.2
 require (
 	github.com/jackc/pgx/v5 v5.7.1
 	github.com/jxskiss/mcli v0.9.5
+	golang.org/x/term v0.24.0
 )
 
 require (
@@ -14,5 +15,6 @@ require (
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	golang.org/x/crypto v0.27.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 )
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func graph() {
+	var args struct {
+		ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		DBName           string `cli:"#R, -d, --database-name, Database name"`
+		SchemaName       string `cli:"#R, -s, --schema-name, Schema name"`
+		TenantName       string `cli:"-t, --tenant-name, Tenant name"`
+		Format           string `cli:"-f, --format, Output format (dot or mermaid)" default:"dot"`
+		ReadOnly         bool   `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+		Namespace        string `cli:"--namespace, Namespace of the database, schema and tenant names" env:"PG_TENANT_SETUP_NAMESPACE"`
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	setupNamespace(args.Namespace)
+	args.DBName = pg.Namespaced(args.DBName)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+	args.TenantName = pg.Namespaced(args.TenantName)
+
+	if args.Format != "dot" && args.Format != "mermaid" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, supported formats: dot, mermaid\n", args.Format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	g, err := pgInstance.TenantGraph(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to build tenant graph: %v\n", err)
+		exit(1)
+	}
+
+	if args.Format == "mermaid" {
+		fmt.Print(g.Mermaid())
+		return
+	}
+
+	fmt.Print(g.DOT())
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func history() {
+	var args struct {
+		ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		DBName           string `cli:"#R, -d, --database-name, Database name"`
+		SchemaName       string `cli:"#R, -s, --schema-name, Schema name"`
+		TenantName       string `cli:"-t, --tenant-name, Tenant name"`
+		Format           string `cli:"-f, --format, Output format (csv or json)" default:"csv"`
+		ReadOnly         bool   `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+		Namespace        string `cli:"--namespace, Namespace of the database, schema and tenant names" env:"PG_TENANT_SETUP_NAMESPACE"`
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	setupNamespace(args.Namespace)
+	args.DBName = pg.Namespaced(args.DBName)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+	args.TenantName = pg.Namespaced(args.TenantName)
+
+	if args.Format != "csv" && args.Format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, supported formats: csv, json\n", args.Format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	events, err := pgInstance.RotationHistory(ctx, args.SchemaName, args.TenantName, args.DBName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read rotation history: %v\n", err)
+		exit(1)
+	}
+
+	if args.Format == "json" {
+		if events == nil {
+			events = []pg.RotationEvent{}
+		}
+
+		data, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to marshal rotation history: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"schema", "role", "username", "rotated_at", "rotated_by"})
+
+	for _, e := range events {
+		w.Write([]string{e.SchemaName, e.Role, e.Username, e.RotatedAt.UTC().Format(time.RFC3339), e.RotatedBy})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write rotation history: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func scanIsolation() {
+	var args struct {
+		ConnectionString string        `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		Format           string        `cli:"-f, --format, Output format (csv or json)" default:"csv"`
+		Interval         time.Duration `cli:"--interval, Keep running and scan at this interval, e.g. 15m"`
+		Endpoint         string        `cli:"--endpoint, URL to POST the violations of each scan that finds any to as JSON" env:"PG_TENANT_SETUP_ISOLATION_ENDPOINT"`
+		EndpointToken    string        `cli:"#E, Bearer token sent to the isolation endpoint" env:"PG_TENANT_SETUP_ISOLATION_TOKEN"`
+		ReadOnly         bool          `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+		Operator         string        `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+		Namespace        string        `cli:"--namespace, Only scan tenants in this namespace" env:"PG_TENANT_SETUP_NAMESPACE"`
+	}
+	mcli.Parse(&args)
+
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	setupNamespace(args.Namespace)
+
+	if args.Format != "csv" && args.Format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, supported formats: csv, json\n", args.Format)
+		exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	for {
+		violations, err := pgInstance.ScanIsolation(ctx)
+		if err != nil {
+			err = fmt.Errorf("unable to scan tenant isolation: %w", err)
+		} else {
+			err = reportViolations(ctx, client, args.Format, args.Endpoint, args.EndpointToken, violations)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			// a one-off run fails, a periodic one tries again next time
+			if args.Interval == 0 {
+				exit(1)
+			}
+		}
+
+		if args.Interval == 0 {
+			// a clean scan is the proof, so violations fail the command
+			if len(violations) > 0 {
+				exit(1)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(args.Interval):
+		}
+	}
+}
+
+// reportViolations prints the violations of a scan, and posts them to the
+// endpoint when there are any, so that a periodic scan alerts on drift
+func reportViolations(ctx context.Context, client *http.Client, format string, endpoint string, token string, violations []pg.IsolationViolation) error {
+	if violations == nil {
+		violations = []pg.IsolationViolation{}
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(violations, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal isolation violations: %w", err)
+		}
+		fmt.Printf("%s\n", data)
+	} else {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"role", "tenant", "target", "database", "schema", "privilege", "via"})
+
+		for _, v := range violations {
+			w.Write([]string{v.Role, v.Tenant, v.Target, v.Database, v.Schema, v.Privilege, v.Via})
+		}
+
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("unable to write isolation violations: %w", err)
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "found %d isolation violations\n", len(violations))
+
+	if endpoint == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(violations)
+	if err != nil {
+		return fmt.Errorf("unable to marshal isolation violations: %w", err)
+	}
+
+	err = postJSON(ctx, client, endpoint, token, data)
+	if err != nil {
+		return fmt.Errorf("unable to post isolation violations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+)
+
+func TestReportViolationsPostsOnlyViolations(t *testing.T) {
+	var posts [][]pg.IsolationViolation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		var violations []pg.IsolationViolation
+		if err := json.NewDecoder(r.Body).Decode(&violations); err != nil {
+			t.Errorf("unable to decode violations: %v", err)
+		}
+		posts = append(posts, violations)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	violation := pg.IsolationViolation{Role: "acme_app_rw_grp", Tenant: "acme", Target: "globex", Database: "globex", Privilege: "CONNECT", Via: "PUBLIC"}
+
+	for _, violations := range [][]pg.IsolationViolation{nil, {violation}} {
+		err := reportViolations(ctx, server.Client(), "json", server.URL, "token", violations)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(posts) != 1 || len(posts[0]) != 1 || posts[0][0] != violation {
+		t.Errorf("posts = %v, want only the scan with a violation", posts)
+	}
+}
@@ -4,89 +4,579 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/andreswebs/pg-tenant-setup/pg"
 	"github.com/jxskiss/mcli"
 )
 
+// SetupArgs are the settings of the provisioning commands, apart from the
+// names of what they act on, which the wizard asks for instead
+type SetupArgs struct {
+	ConnectionString      string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+	ConnectionSecret      string `cli:"--connection-secret, Secrets Manager ARN or vault://path#field holding the connection string" env:"PG_TENANT_SETUP_CONNECTION_SECRET"`
+	OutputSQLFile         string `cli:"#E, File name to save executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_SQL_FILE"`
+	OutputRollbackFile    string `cli:"#E, File name to save a script undoing the executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_ROLLBACK_FILE"`
+	OutputCredentialsFile string `cli:"#E, File name to save schema users credentials to" env:"PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"`
+	HaltOnError           string `cli:"#E, Whether to halt SQL further execution on error" env:"PG_TENANT_SETUP_HALT_ON_ERROR"`
+	CredentialsStdout     bool   `cli:"--credentials-stdout, Print schema users credentials to stdout and never write files" env:"PG_TENANT_SETUP_CREDENTIALS_STDOUT"`
+	SplitCredentials      bool   `cli:"--split-credentials, Write each schema user's credentials to its own file next to the credentials file" env:"PG_TENANT_SETUP_SPLIT_CREDENTIALS"`
+	NoCredentialsOutput   bool   `cli:"--no-credentials-output, Create users without passwords and print their usernames only; set passwords later with rotate-credentials" env:"PG_TENANT_SETUP_NO_CREDENTIALS_OUTPUT"`
+	WithDSN               bool   `cli:"--with-dsn, Add URI, key=value and JDBC connection strings to each user's credentials" env:"PG_TENANT_SETUP_WITH_DSN"`
+	Pooler                string `cli:"--pooler, Write connection pooler configuration for the new schema users (pgcat)" env:"PG_TENANT_SETUP_POOLER"`
+	PoolerConfigFile      string `cli:"#E, File name to save the pooler configuration to" env:"PG_TENANT_SETUP_POOLER_CONFIG_FILE"`
+	DualUsers             bool   `cli:"--dual-users, Use blue/green pairs of schema users for zero-downtime rotation" env:"PG_TENANT_SETUP_DUAL_USERS"`
+	DryRun                bool   `cli:"--dry-run, Print the SQL statements to stdout instead of executing them" env:"PG_TENANT_SETUP_DRY_RUN"`
+	ReadOnly              bool   `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+	Quiet                 bool   `cli:"-q, --quiet, Only print errors and the final result" env:"PG_TENANT_SETUP_QUIET"`
+	Verbose               bool   `cli:"-v, --verbose, Echo each SQL statement and its timing to stderr" env:"PG_TENANT_SETUP_VERBOSE"`
+	Summary               bool   `cli:"--summary, Print a summary of executed statements and their timing to stderr" env:"PG_TENANT_SETUP_SUMMARY"`
+	LockTimeout           string `cli:"--lock-timeout, lock_timeout for the tool's own sessions (default 10s, 0 disables)" env:"PG_TENANT_SETUP_LOCK_TIMEOUT"`
+	StatementTimeout      string `cli:"--statement-timeout, statement_timeout for the tool's own sessions (default 5min, 0 disables)" env:"PG_TENANT_SETUP_STATEMENT_TIMEOUT"`
+	PoolMaxConns          int    `cli:"--pool-max-conns, Connections per tenant database pool; partition grants fan out across them (default 1)" env:"PG_TENANT_SETUP_POOL_MAX_CONNS"`
+	PoolMinConns          int    `cli:"--pool-min-conns, Connections kept open per tenant database pool (default 1)" env:"PG_TENANT_SETUP_POOL_MIN_CONNS"`
+	TerminateConnections  bool   `cli:"--terminate-connections, Terminate sessions of tenant roles before dropping schemas and roles" env:"PG_TENANT_SETUP_TERMINATE_CONNECTIONS"`
+	Operator              string `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+	Citus                 bool   `cli:"--citus, Provision on a Citus cluster, propagating databases to the workers" env:"PG_TENANT_SETUP_CITUS"`
+	CitusDistributeSchema bool   `cli:"--citus-distribute-schema, Distribute tenant schemas with citus_schema_distribute (implies --citus)" env:"PG_TENANT_SETUP_CITUS_DISTRIBUTE_SCHEMA"`
+	Profile               string `cli:"--profile, Adapt provisioning to a managed platform (supabase)" env:"PG_TENANT_SETUP_PROFILE"`
+	Dialect               string `cli:"--dialect, SQL dialect of the server (postgres or yugabyte)" env:"PG_TENANT_SETUP_DIALECT"`
+	TenantNamePattern     string `cli:"#E, Regular expression tenant names must match" env:"PG_TENANT_SETUP_TENANT_NAME_PATTERN"`
+	TenantNameMinLength   string `cli:"#E, Minimum tenant name length" env:"PG_TENANT_SETUP_TENANT_NAME_MIN_LENGTH"`
+	TenantNameMaxLength   string `cli:"#E, Maximum tenant name length" env:"PG_TENANT_SETUP_TENANT_NAME_MAX_LENGTH"`
+	TenantNameDeny        string `cli:"#E, Comma-separated list of additional forbidden tenant names" env:"PG_TENANT_SETUP_TENANT_NAME_DENY"`
+	OwnerAttributes       string `cli:"#E, Comma-separated role attributes for the owner role, e.g. CREATEDB" env:"PG_TENANT_SETUP_OWNER_ATTRIBUTES"`
+	AdminAttributes       string `cli:"#E, Comma-separated role attributes for the admin group and user" env:"PG_TENANT_SETUP_ADMIN_ATTRIBUTES"`
+	ReadWriteAttributes   string `cli:"#E, Comma-separated role attributes for the readwrite group and user" env:"PG_TENANT_SETUP_READWRITE_ATTRIBUTES"`
+	ReadOnlyAttributes    string `cli:"#E, Comma-separated role attributes for the readonly group and user" env:"PG_TENANT_SETUP_READONLY_ATTRIBUTES"`
+	AdminDBPrivileges     string `cli:"#E, Database privileges of the admin group besides CONNECT, e.g. TEMPORARY; overrides the preset" env:"PG_TENANT_SETUP_ADMIN_DATABASE_PRIVILEGES"`
+	ReadWriteDBPrivileges string `cli:"#E, Database privileges of the readwrite group besides CONNECT; overrides the preset" env:"PG_TENANT_SETUP_READWRITE_DATABASE_PRIVILEGES"`
+	ReadOnlyDBPrivileges  string `cli:"#E, Database privileges of the readonly group besides CONNECT; overrides the preset" env:"PG_TENANT_SETUP_READONLY_DATABASE_PRIVILEGES"`
+	PasswordClasses       string `cli:"#E, Comma-separated character classes of generated passwords: letters, numbers, special" env:"PG_TENANT_SETUP_PASSWORD_CLASSES"`
+	PasswordRequireEach   string `cli:"#E, Whether generated passwords must contain each selected character class" env:"PG_TENANT_SETUP_PASSWORD_REQUIRE_EACH_CLASS"`
+	PasswordPrefix        string `cli:"#E, Fixed prefix of generated passwords" env:"PG_TENANT_SETUP_PASSWORD_PREFIX"`
+	PasswordSuffix        string `cli:"#E, Fixed suffix of generated passwords" env:"PG_TENANT_SETUP_PASSWORD_SUFFIX"`
+	PasswordStyle         string `cli:"--password-style, Style of generated passwords: random (default) or passphrase" env:"PG_TENANT_SETUP_PASSWORD_STYLE"`
+	PassphraseWords       int    `cli:"--passphrase-words, Number of words in generated passphrases (default 8)" env:"PG_TENANT_SETUP_PASSPHRASE_WORDS"`
+	PassphraseSeparator   string `cli:"--passphrase-separator, Separator between passphrase words (default -)" env:"PG_TENANT_SETUP_PASSPHRASE_SEPARATOR"`
+	CDC                   bool   `cli:"--cdc, Also create a replication user and a publication for CDC connectors" env:"PG_TENANT_SETUP_CDC"`
+	CDCRDSReplication     bool   `cli:"--cdc-rds-replication, Grant rds_replication to the CDC user instead of REPLICATION" env:"PG_TENANT_SETUP_CDC_RDS_REPLICATION"`
+	ForeignServers        string `cli:"--foreign-servers, Comma-separated foreign servers the schema admin may use" env:"PG_TENANT_SETUP_FOREIGN_SERVERS"`
+	LargeObjects          bool   `cli:"--large-objects, Grant on large objects owned by the schema admins" env:"PG_TENANT_SETUP_LARGE_OBJECTS"`
+	ReadWriteSequences    string `cli:"--readwrite-sequences, Sequence privileges of the readwrite group: setval (also on existing sequences) or deny (nextval only)" env:"PG_TENANT_SETUP_READWRITE_SEQUENCES"`
+	Preset                string `cli:"--preset, Grant preset of the schema groups: strict, standard (default) or permissive" env:"PG_TENANT_SETUP_PRESET"`
+	TempSchema            bool   `cli:"--temp-schema, Create a <schema>_tmp scratch schema owned by the readwrite group and revoke TEMPORARY on the database from the schema groups, unless the database privileges variables grant it" env:"PG_TENANT_SETUP_TEMP_SCHEMA"`
+	PgDumpCompat          bool   `cli:"--pg-dump-compat, Let the schema admin pg_dump and pg_restore its own schema" env:"PG_TENANT_SETUP_PG_DUMP_COMPAT"`
+	GitHubOutput          bool   `cli:"--github-output, Also write the database, role names and credentials file paths to $GITHUB_OUTPUT" env:"PG_TENANT_SETUP_GITHUB_OUTPUT"`
+	UploadURI             string `cli:"--upload-uri, s3:// or gs:// prefix to upload the SQL and credentials files to" env:"PG_TENANT_SETUP_UPLOAD_URI"`
+	UploadSSE             string `cli:"--upload-sse, S3 server-side encryption (AES256 or aws:kms)" env:"PG_TENANT_SETUP_UPLOAD_SSE"`
+	UploadKMSKey          string `cli:"--upload-kms-key, KMS key for S3 aws:kms encryption or GCS customer-managed encryption" env:"PG_TENANT_SETUP_UPLOAD_KMS_KEY"`
+	LeastPrivilege        bool   `cli:"--least-privilege, Run under a non-superuser control role, skipping superuser-only steps" env:"PG_TENANT_SETUP_LEAST_PRIVILEGE"`
+	PgauditLog            string `cli:"--pgaudit-log, pgaudit.log classes to set on the schema users, e.g. ddl,write" env:"PG_TENANT_SETUP_PGAUDIT_LOG"`
+	PgauditRole           string `cli:"--pgaudit-role, Audit role named by pgaudit.role to grant on the tenant schema for object auditing" env:"PG_TENANT_SETUP_PGAUDIT_ROLE"`
+	Blueprint             string `cli:"--blueprint, SQL file or directory of migrations applied as the owner to new schemas" env:"PG_TENANT_SETUP_BLUEPRINT"`
+	Namespace             string `cli:"--namespace, Prefix for every generated database, schema and role name, e.g. staging" env:"PG_TENANT_SETUP_NAMESPACE"`
+}
+
 type CommonArgs struct {
-	ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
-	OutputSQLFile    string `cli:"#E, File name to save executed SQL commands to" env:"PG_TENANT_SETUP_OUTPUT_SQL_FILE"`
-	HaltOnError      string `cli:"#E, Whether to halt SQL further execution on error" env:"PG_TENANT_SETUP_HALT_ON_ERROR"`
-	TenantName       string `cli:"-t, --tenant-name, Tenant name"`
-	DBName           string `cli:"#R, -d, --database-name, Database name"`
-	SchemaName       string `cli:"-s, --schema-name, Schema name"`
+	SetupArgs
+	TenantName string `cli:"-t, --tenant-name, Tenant name"`
+	DBName     string `cli:"#R, -d, --database-name, Database name"`
 }
 
 func main() {
-	mcli.Add("create-database", createDB, "Create a new tenant database with an owner role.")
-	mcli.Add("create-schema", createSchema, "Create a new tenant schema with a set of scoped roles.")
+	mcli.Add("bootstrap", bootstrap, "Create a non-superuser control role to run this tool with.")
+	mcli.Add("create-database", createDB, "Create a new tenant database with an owner role.", mcli.EnableFlagCompletion())
+	mcli.Add("create-shared-db", createSharedDB, "Create a shared database prepared to host many tenant schemas.", mcli.EnableFlagCompletion())
+	mcli.Add("create-schema", createSchema, "Create a new tenant schema with a set of scoped roles.", mcli.EnableFlagCompletion())
+	mcli.Add("delete-database", deleteDB, "Delete a tenant database, its schemas' roles and its owner role.", mcli.EnableFlagCompletion())
+	mcli.Add("delete-schema", deleteSchema, "Delete a tenant schema and its roles.", mcli.EnableFlagCompletion())
+	mcli.Add("delete-tenant", deleteTenant, "Disable a tenant database now and leave dropping it to purge after a grace period.", mcli.EnableFlagCompletion())
+	mcli.Add("purge", purge, "Drop the disabled tenant databases whose grace period has ended.")
+	mcli.Add("reap", reap, "Delete the tenant schemas whose TTL has ended, and disable rotated users whose grace period has ended, once or periodically.")
+	mcli.Add("rename-schema", renameSchema, "Rename a tenant schema and the roles named after it.", mcli.EnableFlagCompletion())
+	mcli.Add("fix-permissions", fixPermissions, "Re-apply a tenant schema's grants, including on new partitions.", mcli.EnableFlagCompletion())
+	mcli.Add("backup-tenant", backupTenant, "Back up a tenant schema with pg_dump.", mcli.EnableFlagCompletion())
+	mcli.Add("restore-tenant", restoreTenant, "Restore a tenant schema with pg_restore and re-apply its grants.", mcli.EnableFlagCompletion())
+	mcli.Add("reconcile", reconcile, "Re-assert the expected state of a tenant schema without dropping anything.", mcli.EnableFlagCompletion())
+	mcli.Add("rotate-credentials", rotateCredentials, "Rotate the passwords of a tenant schema's users.", mcli.EnableFlagCompletion())
+	mcli.Add("exec-sql", execSQL, "Run an admin SQL file in a tenant database with the tool's logging and safety checks.", mcli.EnableFlagCompletion())
+	mcli.Add("history", history, "List the latest password rotations of a tenant schema's users, as recorded in the comments of its groups.", mcli.EnableFlagCompletion())
+	mcli.Add("check-connection", checkConnection, "Check that a set of schema users credentials can connect and query.", mcli.EnableFlagCompletion())
+	mcli.Add("create-neon-branch", createNeonBranch, "Create a Neon branch for a tenant and provision a schema in it.")
+	mcli.Add("stream", stream, "Read NDJSON schema requests from stdin and write NDJSON results to stdout.")
+	mcli.Add("graph", graph, "Print a tenant schema's role hierarchy as DOT or Mermaid.", mcli.EnableFlagCompletion())
+	mcli.Add("report access", reportAccess, "Export an access review of a tenant's roles as CSV or JSON.", mcli.EnableFlagCompletion())
+	mcli.Add("report usage", reportUsage, "Measure tenant databases and schemas, once or periodically, for billing.")
+	mcli.Add("watch", watch, "Check listed tenant schemas for drift, alert on it or reconcile it, once or periodically.")
+	mcli.Add("scan-isolation", scanIsolation, "Check every tenant role for access to other tenants' databases, schemas and roles, once or periodically.")
+	mcli.Add("wizard", wizard, "Interactively create a tenant database and schemas.")
+	mcli.Add("version", printVersion, "Print version and build information.")
+	mcli.Add("self-update", selfUpdate, "Replace this binary with the latest signed release.")
 	mcli.AddCompletion()
+	pg.Exit = exit
+
 	mcli.Run()
+	exit(0)
 }
 
 func createDB() {
 	var args struct {
+		SchemaName       string `cli:"-s, --schema-name, Schema name"`
+		ExitZeroIfExists bool   `cli:"--exit-zero-if-exists, Exit 0 without changes when the tenant already exists as this command creates it, for re-run Jobs"`
+		MigrateArgs
+		SnapshotArgs
 		CommonArgs
 	}
-	mcli.Parse(&args)
+	mcli.Parse(&args, catalogCompletion())
 
-	ctx := context.Background()
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
 
-	pgInstance, err := pg.Connect(ctx, args.ConnectionString)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to connect to database: %v\n", err)
-		os.Exit(1)
+	if err := args.MigrateArgs.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
 	}
+
+	if err := args.SnapshotArgs.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
 	defer pgInstance.Close()
 
-	err = pgInstance.Ping(ctx)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to connect to database: %v\n", err)
-		os.Exit(1)
+	// an existing database is kept and only a missing schema is created
+	dbExists := args.ExitZeroIfExists && existsAsCreated(pgInstance.VerifyTenantDB(ctx, args.DBName, args.TenantName))
+
+	if dbExists && (args.SchemaName == "" || existsAsCreated(pgInstance.VerifyTenantSchema(ctx, args.SchemaName, args.TenantName, args.DBName))) {
+		gitHubOutputDB(args.DBName, args.TenantName)
+		if args.SchemaName != "" {
+			gitHubOutputExistingSchema(args.DBName, args.SchemaName, args.TenantName)
+		}
+		return
 	}
 
-	err = pgInstance.NewTenantDB(ctx, args.DBName, args.TenantName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
-		os.Exit(1)
+	if !dbExists {
+		err := pgInstance.NewTenantDB(ctx, args.DBName, args.TenantName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
+			exit(1)
+		}
 	}
 
+	gitHubOutputDB(args.DBName, args.TenantName)
+
 	if args.SchemaName != "" {
-		err = pgInstance.NewTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+		result, err := pgInstance.NewTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+		outputSchemaResult(result)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		err = args.MigrateArgs.runMigrations(ctx, pgInstance, args.ConnectionString, args.DBName, args.SchemaName, args.TenantName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(1)
+		}
+
+		err = args.SnapshotArgs.writeSnapshot(ctx, pgInstance, args.ConnectionString, args.DBName, args.SchemaName, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit(1)
 		}
 	}
 }
 
-func createSchema() {
+func createSharedDB() {
 	var args struct {
-		SchemaName            string `cli:"#R, -s, --schema-name, Schema name"`
-		OutputCredentialsFile string `cli:"#E, File name to save schema users credentials to" env:"PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"`
+		ControlSchema string `cli:"--control-schema, Name of the control schema" default:"control"`
+		Pgcrypto      bool   `cli:"--pgcrypto, Install the pgcrypto extension in the control schema"`
 		CommonArgs
 	}
-	mcli.Parse(&args)
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
 
 	ctx := context.Background()
 
-	pgInstance, err := pg.Connect(ctx, args.ConnectionString)
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	err := pgInstance.NewSharedDB(ctx, args.DBName, args.TenantName, args.ControlSchema, args.Pgcrypto)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to connect to database: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "unable to create shared database: %v\n", err)
+		exit(1)
+	}
+}
+
+func createSchema() {
+	var args struct {
+		SchemaName       string `cli:"-s, --schema-name, Schema name (required unless --from-csv is given)"`
+		FromCSV          string `cli:"--from-csv, CSV file with db, schema and tenant columns to create many schemas; -d is the default db"`
+		AllOrNothing     bool   `cli:"--all-or-nothing, With --from-csv, delete the schemas already created if any schema fails" env:"PG_TENANT_SETUP_ALL_OR_NOTHING"`
+		TTL              string `cli:"--ttl, Time after which reap deletes the new schemas, e.g. 72h" env:"PG_TENANT_SETUP_TTL"`
+		ExitZeroIfExists bool   `cli:"--exit-zero-if-exists, Skip schemas that already exist as this command creates them, for re-run Jobs"`
+		MigrateArgs
+		SnapshotArgs
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	if err := args.MigrateArgs.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	if err := args.SnapshotArgs.validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
 	}
+
+	exportEnv("PG_TENANT_SETUP_ALL_OR_NOTHING", args.AllOrNothing)
+
+	if args.TTL != "" {
+		if _, err := time.ParseDuration(args.TTL); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --ttl: %v\n", err)
+			exit(1)
+		}
+		exportEnvValue("PG_TENANT_SETUP_TTL", args.TTL)
+	}
+
+	if args.SchemaName == "" && args.FromCSV == "" {
+		fmt.Fprintf(os.Stderr, "either --schema-name or --from-csv must be set\n")
+		exit(1)
+	}
+
+	var requests []pg.SchemaRequest
+	if args.FromCSV != "" {
+		var err error
+		requests, err = readSchemaRequests(args.FromCSV, args.DBName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read %s: %v\n", args.FromCSV, err)
+			exit(1)
+		}
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
 	defer pgInstance.Close()
 
+	if args.ExitZeroIfExists && requests != nil {
+		var missing []pg.SchemaRequest
+		for _, req := range requests {
+			if !existsAsCreated(pgInstance.VerifyTenantSchema(ctx, req.SchemaName, req.TenantName, req.DBName)) {
+				missing = append(missing, req)
+			}
+		}
+
+		if len(missing) == 0 {
+			return
+		}
+		requests = missing
+	}
+
+	if args.ExitZeroIfExists && requests == nil && existsAsCreated(pgInstance.VerifyTenantSchema(ctx, args.SchemaName, args.TenantName, args.DBName)) {
+		gitHubOutputExistingSchema(args.DBName, args.SchemaName, args.TenantName)
+		return
+	}
+
+	if requests != nil {
+		err := pgInstance.NewTenantSchemas(ctx, requests)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
+			exit(1)
+		}
+
+		gitHubOutputSchemas(requests)
+
+		for _, req := range requests {
+			err = args.MigrateArgs.runMigrations(ctx, pgInstance, args.ConnectionString, req.DBName, req.SchemaName, req.TenantName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "schema %s: %v\n", req.SchemaName, err)
+				exit(1)
+			}
+
+			err = args.SnapshotArgs.writeSnapshot(ctx, pgInstance, args.ConnectionString, req.DBName, req.SchemaName, len(requests) > 1)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "schema %s: %v\n", req.SchemaName, err)
+				exit(1)
+			}
+		}
+		return
+	}
+
+	result, err := pgInstance.NewTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	outputSchemaResult(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
+		exit(1)
+	}
+
+	err = args.MigrateArgs.runMigrations(ctx, pgInstance, args.ConnectionString, args.DBName, args.SchemaName, args.TenantName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	err = args.SnapshotArgs.writeSnapshot(ctx, pgInstance, args.ConnectionString, args.DBName, args.SchemaName, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+}
+
+// outputSchemaResult writes the credentials and pooler configuration of a new
+// schema; users may already exist when a later step failed
+func outputSchemaResult(result pg.SchemaProvisionResult) {
+	if result.Users != nil {
+		pg.OutputCredentials(result.Users)
+	}
+
+	if result.PoolerConfig != "" {
+		pg.WritePoolerConfig([]string{result.PoolerConfig})
+	}
+
+	gitHubOutputSchema(result)
+}
+
+// existsAsCreated takes the result of verifying a tenant object for
+// --exit-zero-if-exists. An object that exists in another state is an error,
+// since creating it again would drop it.
+func existsAsCreated(exists bool, err error) bool {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+	return exists
+}
+
+func connect(ctx context.Context, connString string) *pg.Postgres {
+	pgInstance, err := openConnection(ctx, resolveConnectionString(ctx, connString))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	return pgInstance
+}
+
+// openConnection is connect for callers that have to clean up before
+// exiting when the connection fails. The connection string is used as given.
+func openConnection(ctx context.Context, connString string) (*pg.Postgres, error) {
+	opts := []pg.Option{
+		pg.WithApplicationName(fmt.Sprintf("pg-tenant-setup/%s", buildVersionInfo().Version)),
+	}
+
+	if operator := os.Getenv("PG_TENANT_SETUP_OPERATOR"); operator != "" {
+		opts = append(opts, pg.WithOperator(operator))
+	}
+
+	pgInstance, err := pg.Connect(ctx, connString, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
 	err = pgInstance.Ping(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to connect to database: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	err = pgInstance.NewTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	err = pgInstance.EnsurePrimary(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+
+	if os.Getenv("PG_TENANT_SETUP_CITUS") != "" {
+		err = pgInstance.EnsureCitus(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pgInstance, nil
+}
+
+func setupOutput(args *CommonArgs) {
+	if args.CredentialsStdout && (args.OutputCredentialsFile != "" || args.OutputSQLFile != "" || args.OutputRollbackFile != "" || args.PoolerConfigFile != "") {
+		fmt.Fprintf(os.Stderr, "refusing to write output files with --credentials-stdout\n")
+		exit(1)
+	}
+
+	if args.NoCredentialsOutput && (args.CredentialsStdout || args.SplitCredentials || args.OutputCredentialsFile != "") {
+		fmt.Fprintf(os.Stderr, "--no-credentials-output cannot be combined with other credentials outputs\n")
+		exit(1)
+	}
+
+	if args.Pooler != "" && args.Pooler != "pgcat" {
+		fmt.Fprintf(os.Stderr, "unknown pooler %q, supported poolers: pgcat\n", args.Pooler)
+		exit(1)
+	}
+
+	if args.Pooler != "" && args.PoolerConfigFile == "" {
+		fmt.Fprintf(os.Stderr, "--pooler requires PG_TENANT_SETUP_POOLER_CONFIG_FILE to be set\n")
+		exit(1)
+	}
+
+	if args.ConnectionSecret != "" && args.ConnectionString != "" {
+		fmt.Fprintf(os.Stderr, "--connection-secret and --connection-string cannot be used together\n")
+		exit(1)
+	}
+
+	if args.Quiet && args.Verbose {
+		fmt.Fprintf(os.Stderr, "--quiet and --verbose cannot be used together\n")
+		exit(1)
+	}
+
+	if args.SplitCredentials && args.OutputCredentialsFile == "" {
+		fmt.Fprintf(os.Stderr, "--split-credentials requires PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE to be set\n")
+		exit(1)
+	}
+
+	if args.Profile != "" && args.Profile != "supabase" {
+		fmt.Fprintf(os.Stderr, "unknown profile %q, supported profiles: supabase\n", args.Profile)
+		exit(1)
+	}
+
+	if args.Dialect != "" && args.Dialect != "postgres" && args.Dialect != "yugabyte" {
+		fmt.Fprintf(os.Stderr, "unknown dialect %q, supported dialects: postgres, yugabyte\n", args.Dialect)
+		exit(1)
+	}
+
+	if args.ReadWriteSequences != "" && args.ReadWriteSequences != "setval" && args.ReadWriteSequences != "deny" {
+		fmt.Fprintf(os.Stderr, "unknown --readwrite-sequences mode %q, supported modes: setval, deny\n", args.ReadWriteSequences)
+		exit(1)
+	}
+
+	if err := pg.ValidatePreset(args.Preset); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	if args.Blueprint != "" {
+		if _, err := os.Stat(args.Blueprint); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to read blueprint: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if args.GitHubOutput && os.Getenv("GITHUB_OUTPUT") == "" {
+		fmt.Fprintf(os.Stderr, "--github-output requires GITHUB_OUTPUT to be set\n")
+		exit(1)
+	}
+
+	if args.UploadURI != "" && args.CredentialsStdout {
+		fmt.Fprintf(os.Stderr, "--upload-uri has nothing to upload with --credentials-stdout\n")
+		exit(1)
+	}
+
+	// the database name doubles as the tenant name when none is given
+	tenantName := args.TenantName
+	if tenantName == "" {
+		tenantName = args.DBName
+	}
+
+	if err := pg.ValidateTenantName(tenantName); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	setupNamespace(args.Namespace)
+
+	// the pg package reads its output settings from the environment
+	exportEnv("PG_TENANT_SETUP_CREDENTIALS_STDOUT", args.CredentialsStdout)
+	exportEnv("PG_TENANT_SETUP_SPLIT_CREDENTIALS", args.SplitCredentials)
+	exportEnv("PG_TENANT_SETUP_NO_CREDENTIALS_OUTPUT", args.NoCredentialsOutput)
+	exportEnv("PG_TENANT_SETUP_WITH_DSN", args.WithDSN)
+	exportEnvValue("PG_TENANT_SETUP_POOLER", args.Pooler)
+	exportEnv("PG_TENANT_SETUP_DUAL_USERS", args.DualUsers)
+	exportEnv("PG_TENANT_SETUP_DRY_RUN", args.DryRun)
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	exportEnv("PG_TENANT_SETUP_QUIET", args.Quiet)
+	exportEnv("PG_TENANT_SETUP_VERBOSE", args.Verbose)
+	exportEnv("PG_TENANT_SETUP_SUMMARY", args.Summary)
+	exportEnv("PG_TENANT_SETUP_GITHUB_OUTPUT", args.GitHubOutput)
+	exportEnvValue("PG_TENANT_SETUP_LOCK_TIMEOUT", args.LockTimeout)
+	exportEnvValue("PG_TENANT_SETUP_STATEMENT_TIMEOUT", args.StatementTimeout)
+	exportEnv("PG_TENANT_SETUP_TERMINATE_CONNECTIONS", args.TerminateConnections)
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	exportEnv("PG_TENANT_SETUP_CITUS", args.Citus || args.CitusDistributeSchema)
+	exportEnv("PG_TENANT_SETUP_CITUS_DISTRIBUTE_SCHEMA", args.CitusDistributeSchema)
+	exportEnvValue("PG_TENANT_SETUP_PROFILE", args.Profile)
+	exportEnvValue("PG_TENANT_SETUP_DIALECT", args.Dialect)
+	exportEnv("PG_TENANT_SETUP_CDC", args.CDC || args.CDCRDSReplication)
+	exportEnv("PG_TENANT_SETUP_CDC_RDS_REPLICATION", args.CDCRDSReplication)
+	exportEnvValue("PG_TENANT_SETUP_FOREIGN_SERVERS", args.ForeignServers)
+	exportEnv("PG_TENANT_SETUP_LARGE_OBJECTS", args.LargeObjects)
+	exportEnvValue("PG_TENANT_SETUP_READWRITE_SEQUENCES", args.ReadWriteSequences)
+	exportEnvValue("PG_TENANT_SETUP_PRESET", args.Preset)
+	exportEnv("PG_TENANT_SETUP_TEMP_SCHEMA", args.TempSchema)
+	exportEnv("PG_TENANT_SETUP_PG_DUMP_COMPAT", args.PgDumpCompat)
+	exportEnvValue("PG_TENANT_SETUP_UPLOAD_URI", args.UploadURI)
+	exportEnvValue("PG_TENANT_SETUP_UPLOAD_SSE", args.UploadSSE)
+	exportEnvValue("PG_TENANT_SETUP_UPLOAD_KMS_KEY", args.UploadKMSKey)
+	exportEnv("PG_TENANT_SETUP_LEAST_PRIVILEGE", args.LeastPrivilege)
+	exportEnvValue("PG_TENANT_SETUP_PGAUDIT_LOG", args.PgauditLog)
+	exportEnvValue("PG_TENANT_SETUP_PGAUDIT_ROLE", args.PgauditRole)
+	exportEnvValue("PG_TENANT_SETUP_PASSWORD_STYLE", args.PasswordStyle)
+	exportEnvValue("PG_TENANT_SETUP_PASSPHRASE_SEPARATOR", args.PassphraseSeparator)
+	exportEnvValue("PG_TENANT_SETUP_BLUEPRINT", args.Blueprint)
+	if args.PassphraseWords != 0 {
+		exportEnvValue("PG_TENANT_SETUP_PASSPHRASE_WORDS", strconv.Itoa(args.PassphraseWords))
+	}
+	if args.PoolMaxConns != 0 {
+		exportEnvValue("PG_TENANT_SETUP_POOL_MAX_CONNS", strconv.Itoa(args.PoolMaxConns))
+	}
+	if args.PoolMinConns != 0 {
+		exportEnvValue("PG_TENANT_SETUP_POOL_MIN_CONNS", strconv.Itoa(args.PoolMinConns))
+	}
+
+	if err := pg.ValidatePoolSize(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	// migrations, snapshots and backups pass the connection string to tools
+	exportEnvValue("PG_TENANT_SETUP_CONNECTION_SECRET", args.ConnectionSecret)
+	args.ConnectionString = resolveConnectionString(context.Background(), args.ConnectionString)
+
+	// the password policy is only complete once the flags are exported
+	if err := pg.ValidatePasswordPolicy(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid password policy: %v\n", err)
+		exit(1)
+	}
+
+	args.DBName = pg.Namespaced(args.DBName)
+	args.TenantName = pg.Namespaced(args.TenantName)
+}
+
+// setupNamespace exports the namespace so that pg.Namespaced prefixes names
+// with it and cluster-wide scans skip other namespaces
+func setupNamespace(ns string) {
+	if err := pg.ValidateNamespace(ns); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	exportEnvValue("PG_TENANT_SETUP_NAMESPACE", ns)
+}
+
+func exportEnv(key string, enabled bool) {
+	if enabled {
+		os.Setenv(key, "true")
+	}
+}
+
+func exportEnvValue(key string, value string) {
+	if value != "" {
+		os.Setenv(key, value)
 	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/neon"
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func createNeonBranch() {
+	var args struct {
+		NeonAPIKey     string `cli:"#E, Neon API key" env:"NEON_API_KEY"`
+		NeonProjectID  string `cli:"#R, --neon-project-id, Neon project ID" env:"NEON_PROJECT_ID"`
+		ParentBranchID string `cli:"--parent-branch-id, Branch to fork from (defaults to the project's default branch)"`
+		BranchName     string `cli:"--branch-name, Branch name (defaults to the tenant name)"`
+		SchemaName     string `cli:"#R, -s, --schema-name, Schema name"`
+		CommonArgs
+	}
+	mcli.Parse(&args)
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	if args.NeonAPIKey == "" {
+		fmt.Fprintf(os.Stderr, "NEON_API_KEY must be set\n")
+		exit(1)
+	}
+
+	// a branch is a real resource, so there is nothing meaningful to print
+	if args.DryRun {
+		fmt.Fprintf(os.Stderr, "--dry-run is not supported with create-neon-branch\n")
+		exit(1)
+	}
+
+	branchName := args.BranchName
+	if branchName == "" {
+		branchName = args.TenantName
+	}
+
+	if branchName == "" {
+		fmt.Fprintf(os.Stderr, "either --branch-name or --tenant-name must be set\n")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	client := neon.NewClient(args.NeonAPIKey)
+
+	branch, err := client.CreateBranch(ctx, args.NeonProjectID, branchName, args.ParentBranchID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		exit(1)
+	}
+
+	// a half-provisioned branch is left behind for nobody, so remove it
+	fail := func(format string, a ...any) {
+		fmt.Fprintf(os.Stderr, format, a...)
+		if err := client.DeleteBranch(ctx, args.NeonProjectID, branch.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		exit(1)
+	}
+
+	pgInstance, err := openConnection(ctx, branch.ConnectionURI)
+	if err != nil {
+		fail("%v\n", err)
+	}
+	defer pgInstance.Close()
+
+	// a branch forked from a parent that already has the tenant database
+	// keeps it; otherwise the database and its owner are created here
+	dbExists, err := pgInstance.VerifyTenantDB(ctx, args.DBName, args.TenantName)
+	if err != nil {
+		fail("%v\n", err)
+	}
+
+	if !dbExists {
+		err = pgInstance.NewTenantDB(ctx, args.DBName, args.TenantName)
+		if err != nil {
+			fail("unable to create new tenant objects: %v\n", err)
+		}
+	}
+
+	result, err := pgInstance.NewTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	outputSchemaResult(result)
+	if err != nil {
+		fail("unable to create new tenant objects: %v\n", err)
+	}
+
+	data, err := json.Marshal(branch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to marshal branch data: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+}
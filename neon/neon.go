@@ -0,0 +1,146 @@
+package neon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultBaseURL = "https://console.neon.tech/api/v2"
+
+type Client struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type Branch struct {
+	ID            string `json:"branch_id"`
+	Name          string `json:"branch_name"`
+	ConnectionURI string `json:"connection_uri"`
+}
+
+type createBranchRequest struct {
+	Branch struct {
+		Name     string `json:"name"`
+		ParentID string `json:"parent_id,omitempty"`
+	} `json:"branch"`
+	Endpoints []struct {
+		Type string `json:"type"`
+	} `json:"endpoints"`
+}
+
+type createBranchResponse struct {
+	Branch struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"branch"`
+	ConnectionURIs []struct {
+		ConnectionURI string `json:"connection_uri"`
+	} `json:"connection_uris"`
+}
+
+func NewClient(apiKey string) *Client {
+	return &Client{
+		APIKey:     apiKey,
+		BaseURL:    defaultBaseURL,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// CreateBranch creates a branch with a read-write compute endpoint, so that
+// the returned connection URI can be used right away to provision the tenant.
+func (c *Client) CreateBranch(ctx context.Context, projectID string, name string, parentID string) (branch Branch, err error) {
+	var reqBody createBranchRequest
+	reqBody.Branch.Name = name
+	reqBody.Branch.ParentID = parentID
+	reqBody.Endpoints = append(reqBody.Endpoints, struct {
+		Type string `json:"type"`
+	}{Type: "read_write"})
+
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		err = fmt.Errorf("unable to marshal branch request: %w", err)
+		return
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/branches", c.BaseURL, projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		err = fmt.Errorf("unable to build branch request: %w", err)
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("unable to create neon branch: %w", err)
+		return
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("unable to read neon response: %w", err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unable to create neon branch: %s: %s", resp.Status, bytes.TrimSpace(body))
+		return
+	}
+
+	var respBody createBranchResponse
+	err = json.Unmarshal(body, &respBody)
+	if err != nil {
+		err = fmt.Errorf("unable to parse neon response: %w", err)
+		return
+	}
+
+	if len(respBody.ConnectionURIs) == 0 {
+		err = fmt.Errorf("neon did not return a connection URI for branch %s", respBody.Branch.ID)
+		return
+	}
+
+	branch = Branch{
+		ID:            respBody.Branch.ID,
+		Name:          respBody.Branch.Name,
+		ConnectionURI: respBody.ConnectionURIs[0].ConnectionURI,
+	}
+
+	return
+}
+
+// DeleteBranch deletes a branch along with its compute endpoints.
+func (c *Client) DeleteBranch(ctx context.Context, projectID string, branchID string) error {
+	url := fmt.Sprintf("%s/projects/%s/branches/%s", c.BaseURL, projectID, branchID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to build branch request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to delete neon branch %s: %w", branchID, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unable to delete neon branch %s: %s: %s", branchID, resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
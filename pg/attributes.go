@@ -0,0 +1,97 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Generated roles get these attributes explicitly instead of relying on the
+// server defaults, which managed platforms sometimes change.
+var defaultRoleAttributes = []string{"NOSUPERUSER", "NOCREATEDB", "NOCREATEROLE", "NOREPLICATION", "NOBYPASSRLS"}
+
+var allowedRoleAttributes = map[string]bool{
+	"CREATEDB":    true,
+	"CREATEROLE":  true,
+	"REPLICATION": true,
+	"BYPASSRLS":   true,
+	"INHERIT":     true,
+}
+
+// role kinds are told apart by the suffixes of the generated names, which
+// survive hashing; dual users carry one more suffix
+func roleKindOf(roleName string) string {
+	for _, suffix := range []string{dualSuffixA, dualSuffixB} {
+		if base, ok := strings.CutSuffix(roleName, suffix); ok && strings.HasSuffix(base, userSuffix) {
+			roleName = base
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(roleName, ownerSuffix):
+		return "owner"
+	case strings.HasSuffix(roleName, schemaAdminSuffix+groupSuffix), strings.HasSuffix(roleName, schemaAdminSuffix+userSuffix):
+		return roleAdmin
+	case strings.HasSuffix(roleName, rwSuffix+groupSuffix), strings.HasSuffix(roleName, rwSuffix+userSuffix):
+		return roleReadWrite
+	case strings.HasSuffix(roleName, roSuffix+groupSuffix), strings.HasSuffix(roleName, roSuffix+userSuffix):
+		return roleReadOnly
+	}
+
+	return ""
+}
+
+func roleAttributesEnvVar(kind string) string {
+	switch kind {
+	case "owner":
+		return envVarOwnerAttrs
+	case roleAdmin:
+		return envVarAdminAttrs
+	case roleReadWrite:
+		return envVarRWAttrs
+	case roleReadOnly:
+		return envVarROAttrs
+	}
+
+	return ""
+}
+
+// roleAttributes returns the attribute clause for a generated role, with the
+// configured attributes (e.g. "CREATEDB,NOBYPASSRLS") replacing the defaults
+// for the same attribute
+func roleAttributes(roleName string) (attrs string, err error) {
+	attributes := make([]string, len(defaultRoleAttributes))
+	copy(attributes, defaultRoleAttributes)
+
+	envVar := roleAttributesEnvVar(roleKindOf(roleName))
+	if envVar == "" {
+		return strings.Join(attributes, " "), nil
+	}
+
+	for _, attr := range strings.Split(os.Getenv(envVar), ",") {
+		attr = strings.ToUpper(strings.TrimSpace(attr))
+		if attr == "" {
+			continue
+		}
+
+		name := strings.TrimPrefix(attr, "NO")
+		if !allowedRoleAttributes[name] {
+			err = fmt.Errorf("unsupported role attribute %s in %s", attr, envVar)
+			return
+		}
+
+		replaced := false
+		for i, current := range attributes {
+			if strings.TrimPrefix(current, "NO") == name {
+				attributes[i] = attr
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			attributes = append(attributes, attr)
+		}
+	}
+
+	return strings.Join(attributes, " "), nil
+}
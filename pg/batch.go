@@ -0,0 +1,132 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+type SchemaRequest struct {
+	DBName     string `json:"db"`
+	SchemaName string `json:"schema"`
+	TenantName string `json:"tenant"`
+	// Blueprint is a SQL file or directory applied to the new schema,
+	// overriding --blueprint
+	Blueprint string `json:"blueprint,omitempty"`
+}
+
+func (req SchemaRequest) blueprint() string {
+	if req.Blueprint != "" {
+		return req.Blueprint
+	}
+	return blueprint()
+}
+
+func allOrNothing() bool {
+	return os.Getenv(envVarAllOrNothing) != ""
+}
+
+// NewTenantSchemas provisions many schemas over the same connection and
+// writes one credentials document keyed by tenant, then by schema. It stops
+// at the first failure, but the credentials of the schemas already created
+// are still written out since their passwords are already set. With
+// --all-or-nothing the schemas of the run are deleted again instead.
+func (pg *Postgres) NewTenantSchemas(ctx context.Context, requests []SchemaRequest) (err error) {
+	credentials := make(map[string]map[string]any)
+	var pools []string
+
+	defer func() {
+		if len(credentials) > 0 {
+			outputCredentials(credentials)
+			writePoolerConfig(pools)
+		}
+	}()
+
+	for i, req := range requests {
+		tenant := req.TenantName
+		if tenant == "" {
+			tenant = req.DBName
+		}
+
+		var creds any
+		creds, err = pg.newTenantSchema(ctx, req.SchemaName, req.TenantName, ConnectDBConfig{DBName: req.DBName}, req.blueprint())
+
+		if creds != nil {
+			if credentials[tenant] == nil {
+				credentials[tenant] = make(map[string]any)
+			}
+			credentials[tenant][req.SchemaName] = creds
+
+			if pool, ok := pg.poolerConfig(creds, req.DBName, req.SchemaName, req.TenantName); ok {
+				pools = append(pools, pool)
+			}
+		}
+
+		if err != nil {
+			err = fmt.Errorf("schema %s of tenant %s: %w", req.SchemaName, tenant, err)
+			if allOrNothing() {
+				// the failed schema may be half created, so it goes too
+				if pg.rollbackTenantSchemas(ctx, requests[:i+1]) {
+					clear(credentials)
+				}
+			}
+			return
+		}
+	}
+
+	return
+}
+
+// rollbackTenantSchemas deletes the schemas of a failed all-or-nothing run,
+// newest first. It is best effort: DDL outside the schemas, like role
+// creation, can't be undone transactionally, and a schema that can't be
+// deleted is reported and skipped. It reports whether every schema was
+// deleted. The schemas' publications and slots were created by this run, so
+// they go without --drop-replication.
+func (pg *Postgres) rollbackTenantSchemas(ctx context.Context, requests []SchemaRequest) (ok bool) {
+	ok = true
+	ctx = withDropReplication(ctx)
+
+	for i := len(requests) - 1; i >= 0; i-- {
+		req := requests[i]
+
+		err := pg.DeleteTenantSchema(ctx, req.SchemaName, req.TenantName, ConnectDBConfig{DBName: req.DBName})
+		if err != nil {
+			warnf("unable to roll back schema %s in database %s: %v\n", req.SchemaName, req.DBName, err)
+			ok = false
+			continue
+		}
+
+		logf("rolled back schema %s in database %s\n", req.SchemaName, req.DBName)
+	}
+
+	return
+}
+
+type SchemaResult struct {
+	SchemaRequest
+	OK          bool   `json:"ok"`
+	Error       string `json:"error,omitempty"`
+	Credentials any    `json:"credentials,omitempty"`
+}
+
+// ProvisionSchema creates one tenant schema and returns its credentials in the
+// result instead of writing them out, for callers that stream results.
+func (pg *Postgres) ProvisionSchema(ctx context.Context, req SchemaRequest) (result SchemaResult) {
+	result.SchemaRequest = req
+
+	creds, err := pg.newTenantSchema(ctx, req.SchemaName, req.TenantName, ConnectDBConfig{DBName: req.DBName}, req.blueprint())
+	result.Credentials = creds
+	if creds != nil && noCredentialsOutput() {
+		result.Credentials, _ = withholdPasswords(creds)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	result.OK = true
+
+	return
+}
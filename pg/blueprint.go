@@ -0,0 +1,83 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func blueprint() string {
+	return os.Getenv(envVarBlueprint)
+}
+
+// blueprintFiles resolves a blueprint to the SQL files to apply: a single
+// file, or every .sql file of a directory in lexical order, which is how
+// migration tools name them. Down migrations are skipped.
+func blueprintFiles(path string) (files []string, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		err = fmt.Errorf("unable to read blueprint: %w", err)
+		return
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(path, "*.sql"))
+	if err != nil {
+		return
+	}
+
+	for _, match := range matches {
+		if !strings.HasSuffix(match, ".down.sql") {
+			files = append(files, match)
+		}
+	}
+
+	if len(files) == 0 {
+		err = fmt.Errorf("blueprint directory %s has no .sql files", path)
+	}
+
+	return
+}
+
+// applyBlueprint runs the blueprint's statements in the new schema on conn,
+// which is connected as the owner so that the owner's default privileges and
+// the grants that follow cover the objects it creates. Unqualified names
+// resolve to the schema.
+func (pg *Postgres) applyBlueprint(ctx context.Context, conn PGConnQuerier, schemaName string, path string) (err error) {
+	files, err := blueprintFiles(path)
+	if err != nil {
+		return
+	}
+
+	_, err = pg.RunExec(ctx, conn, fmt.Sprintf("SET search_path TO %s;", schemaName))
+	if err != nil {
+		return
+	}
+
+	// pooled connections are reused, so the search_path must not leak
+	defer pg.RunExec(ctx, conn, "RESET search_path;")
+
+	for _, file := range files {
+		var sql []byte
+		sql, err = os.ReadFile(file)
+		if err != nil {
+			err = fmt.Errorf("unable to read blueprint: %w", err)
+			return
+		}
+
+		_, err = pg.RunExec(ctx, conn, string(sql))
+		if err != nil {
+			err = fmt.Errorf("unable to apply blueprint %s: %w", file, err)
+			return
+		}
+
+		verbosef("applied blueprint %s to schema %s\n", file, schemaName)
+	}
+
+	return
+}
@@ -0,0 +1,89 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// BootstrapControlRole creates, or resets, a login role that can run this
+// tool without being a superuser: CREATEDB and CREATEROLE cover databases and
+// tenant roles, and pg_signal_backend allows terminating tenant sessions.
+// It must be run from a superuser session. Role names starting with pg_ are
+// reserved by PostgreSQL.
+func (pg *Postgres) BootstrapControlRole(ctx context.Context, roleName string) (user UserCredentials, err error) {
+	var superuser bool
+	err = pg.db.QueryRow(ctx, "SELECT rolsuper FROM pg_roles WHERE rolname = current_user;").Scan(&superuser)
+	if err != nil {
+		err = fmt.Errorf("unable to check current role: %w", err)
+		return
+	}
+
+	if !superuser && !dryRun() {
+		err = fmt.Errorf("bootstrap must be run as a superuser")
+		return
+	}
+
+	if noCredentialsOutput() {
+		err = fmt.Errorf("the control role password can't be withheld, unset --no-credentials-output")
+		return
+	}
+
+	user.Username = roleName
+	user.Password, err = generatePassword()
+	if err != nil {
+		return
+	}
+
+	exists, err := pg.CheckIfRoleExists(ctx, roleName)
+	if err != nil {
+		return
+	}
+
+	attrs := "LOGIN NOSUPERUSER CREATEDB CREATEROLE NOREPLICATION NOBYPASSRLS"
+
+	createRole := fmt.Sprintf("CREATE ROLE %s WITH %s PASSWORD '%s';", roleName, attrs, user.Password)
+	if exists {
+		createRole = fmt.Sprintf("ALTER ROLE %s WITH %s PASSWORD '%s';", roleName, attrs, user.Password)
+	}
+
+	grantSignal := fmt.Sprintf("GRANT pg_signal_backend TO %s;", roleName)
+	comment := fmt.Sprintf("COMMENT ON ROLE %s IS '%s';", roleName, controlRoleComment)
+
+	pg.annotate(ctx, pg.db, "bootstrap", "role="+roleName)
+
+	_, err = pg.RunExec(ctx, pg.db, createRole)
+	if err != nil {
+		err = fmt.Errorf("unable to create control role: %w", err)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, grantSignal)
+	if err != nil {
+		err = fmt.Errorf("unable to grant pg_signal_backend: %w", err)
+		return
+	}
+
+	pg.RunExec(ctx, pg.db, comment)
+
+	// from PostgreSQL 16 a CREATEROLE role only gets ADMIN OPTION on the roles
+	// it creates, while SET ROLE, REASSIGN OWNED and DROP OWNED need more
+	var serverVersion int
+	err = pg.db.QueryRow(ctx, "SELECT current_setting('server_version_num')::int;").Scan(&serverVersion)
+	if err != nil {
+		err = fmt.Errorf("unable to get server version: %w", err)
+		return
+	}
+
+	if serverVersion >= 160000 {
+		selfGrant := fmt.Sprintf("ALTER ROLE %s SET createrole_self_grant = 'set, inherit';", roleName)
+		_, err = pg.RunExec(ctx, pg.db, selfGrant)
+		if err != nil {
+			err = fmt.Errorf("unable to set createrole_self_grant: %w", err)
+			return
+		}
+	}
+
+	outputCredentials(user)
+
+	return
+}
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const catalogConnectTimeout = 2 * time.Second
+
+func connectCatalog(ctx context.Context, connString string, dbName string) (conn *pgx.Conn, err error) {
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		err = fmt.Errorf("unable to parse connection string: %w", err)
+		return
+	}
+
+	if dbName != "" {
+		config.Database = dbName
+	}
+
+	if _, ok := config.RuntimeParams["application_name"]; !ok {
+		config.RuntimeParams["application_name"] = applicationName
+	}
+
+	setReadOnly(config)
+
+	if config.ConnectTimeout == 0 || config.ConnectTimeout > catalogConnectTimeout {
+		config.ConnectTimeout = catalogConnectTimeout
+	}
+
+	conn, err = pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		err = fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	return
+}
+
+func queryNames(ctx context.Context, conn *pgx.Conn, sql string) (names []string, err error) {
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return
+	}
+
+	names, err = pgx.CollectRows(rows, pgx.RowTo[string])
+
+	return
+}
+
+func ListDatabases(ctx context.Context, connString string) (dbNames []string, err error) {
+	conn, err := connectCatalog(ctx, connString, "")
+	if err != nil {
+		return
+	}
+
+	defer conn.Close(ctx)
+
+	return queryNames(ctx, conn, "SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname;")
+}
+
+func ListSchemas(ctx context.Context, connString string, dbName string) (schemaNames []string, err error) {
+	conn, err := connectCatalog(ctx, connString, dbName)
+	if err != nil {
+		return
+	}
+
+	defer conn.Close(ctx)
+
+	return queryNames(ctx, conn, "SELECT nspname FROM pg_namespace WHERE nspname NOT LIKE 'pg\\_%' AND nspname <> 'information_schema' ORDER BY nspname;")
+}
@@ -0,0 +1,130 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func cdcUser() bool {
+	return os.Getenv(envVarCDC) != ""
+}
+
+// RDS and Aurora don't allow the REPLICATION attribute, logical replication
+// is granted through membership in rds_replication instead
+func cdcRDSReplication() bool {
+	return os.Getenv(envVarCDCRDS) != ""
+}
+
+func tenantSchemaCDCUserName(roleNamePrefix string, schemaName string) string {
+	return fmt.Sprintf("%s%s%s", tenantSchemaPrefix(roleNamePrefix, schemaName), cdcSuffix, userSuffix)
+}
+
+func tenantSchemaPublicationName(roleNamePrefix string, schemaName string) string {
+	return fmt.Sprintf("%s%s", tenantSchemaPrefix(roleNamePrefix, schemaName), publicationSuffix)
+}
+
+// the connector creates its slot under this name, which is the one deleting
+// the schema drops
+func tenantSchemaSlotName(roleNamePrefix string, schemaName string) string {
+	return fmt.Sprintf("%s%s", tenantSchemaPrefix(roleNamePrefix, schemaName), slotSuffix)
+}
+
+// NewTenantSchemaCDCUser creates a login role for a change data capture
+// connector such as Debezium: it can stream changes, reads the schema through
+// the readonly group, and gets a publication covering every table in the
+// schema. The replication slot is left for the connector to create, named
+// after tenantSchemaSlotName.
+func (pg *Postgres) NewTenantSchemaCDCUser(ctx context.Context, roleNamePrefix string, schemaName string, dbName string) (user UserCredentials, err error) {
+	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	publication := tenantSchemaPublicationName(roleNamePrefix, schemaName)
+
+	user.Username = tenantSchemaCDCUserName(roleNamePrefix, schemaName)
+	user.Password, err = initialPassword()
+	if err != nil {
+		return
+	}
+
+	attrs, err := roleAttributes(user.Username)
+	if err != nil {
+		return
+	}
+
+	if !cdcRDSReplication() {
+		if leastPrivilege() {
+			err = fmt.Errorf("only a superuser can create a role with REPLICATION, use --cdc-rds-replication on RDS")
+			return
+		}
+		attrs = strings.Replace(attrs, "NOREPLICATION", "REPLICATION", 1)
+	}
+
+	createUser := fmt.Sprintf("CREATE ROLE %s WITH LOGIN %s %s;", user.Username, attrs, passwordClause(user.Password))
+	grantRDSReplication := fmt.Sprintf("GRANT rds_replication TO %s;", user.Username)
+	grantReadOnly := fmt.Sprintf("GRANT %s TO %s;", schemaGroups.ReadOnly, user.Username)
+	grantConnect := fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s;", dbName, user.Username)
+	dropPublication := fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", publication)
+	createPublication := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLES IN SCHEMA %s;", publication, schemaName)
+
+	err = pg.DropRole(ctx, user.Username)
+	if err != nil {
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, createUser)
+	if err != nil {
+		err = fmt.Errorf("unable to create cdc user: %w", err)
+		return
+	}
+
+	if cdcRDSReplication() {
+		_, err = pg.RunExec(ctx, pg.db, grantRDSReplication)
+		if err != nil {
+			err = fmt.Errorf("unable to grant rds_replication: %w", err)
+			return
+		}
+	}
+
+	pg.RunExec(ctx, pg.db, grantReadOnly)
+	pg.RunExec(ctx, pg.db, grantConnect)
+
+	// publications for whole schemas need superuser, so the tool's role creates it
+	if leastPrivilege() {
+		warnf("least-privilege mode: skipping publication %s, a superuser must create it\n", publication)
+		return
+	}
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "create-schema", "tenant="+roleNamePrefix, "database="+dbName, "schema="+schemaName, "phase=cdc")
+		pg.RunExec(ctx, conn, dropPublication)
+
+		_, err = pg.RunExec(ctx, conn, createPublication)
+		if err != nil {
+			err = fmt.Errorf("unable to create publication: %w", err)
+		}
+
+		return
+	})
+
+	if err == nil {
+		logf("cdc user %s: use publication %s and replication slot %s\n", user.Username, publication, tenantSchemaSlotName(roleNamePrefix, schemaName))
+	}
+
+	return
+}
+
+func (pg *Postgres) newCDCUser(ctx context.Context, roleNamePrefix string, schemaName string, dbName string) (user *UserCredentials, err error) {
+	if !cdcUser() {
+		return
+	}
+
+	pg.annotate(ctx, pg.db, "create-schema", "tenant="+roleNamePrefix, "database="+dbName, "schema="+schemaName, "phase=cdc")
+
+	cdc, err := pg.NewTenantSchemaCDCUser(ctx, roleNamePrefix, schemaName, dbName)
+	if err != nil {
+		err = fmt.Errorf("unable to create cdc user: %w", err)
+		return
+	}
+
+	return &cdc, nil
+}
@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func CheckUserConnection(ctx context.Context, connString string, dbName string, schemaName string, user UserCredentials) (check ConnectionCheck) {
+	check.Username = user.Username
+
+	probe := func(name string, fn func() error) {
+		result := ProbeResult{Name: name, OK: true}
+		if err := fn(); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+		}
+		check.Probes = append(check.Probes, result)
+	}
+
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		probe("connect", func() error { return fmt.Errorf("unable to parse connection string: %w", err) })
+		return
+	}
+
+	if _, ok := config.RuntimeParams["application_name"]; !ok {
+		config.RuntimeParams["application_name"] = applicationName
+	}
+
+	setReadOnly(config)
+
+	config.User = user.Username
+	config.Password = user.Password
+	if dbName != "" {
+		config.Database = dbName
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	probe("connect", func() error { return err })
+	if err != nil {
+		return
+	}
+
+	defer conn.Close(ctx)
+
+	probe("select", func() error {
+		var res int
+		return conn.QueryRow(ctx, "SELECT 1;").Scan(&res)
+	})
+
+	// creating even a temporary table is a write
+	if !readOnly() {
+		probe("temp-table", func() (err error) {
+			_, err = conn.Exec(ctx, "CREATE TEMPORARY TABLE pg_tenant_setup_probe (id int) ON COMMIT DROP;")
+			return
+		})
+	}
+
+	if schemaName != "" {
+		probe("read-table", func() (err error) {
+			var tableName string
+			err = conn.QueryRow(ctx,
+				"SELECT quote_ident(table_name) FROM information_schema.tables WHERE table_schema = $1 LIMIT 1;",
+				schemaName,
+			).Scan(&tableName)
+			if errors.Is(err, pgx.ErrNoRows) {
+				// nothing to read yet
+				return nil
+			}
+			if err != nil {
+				return
+			}
+
+			rows, err := conn.Query(ctx, fmt.Sprintf("SELECT * FROM %s.%s LIMIT 1;", schemaName, tableName))
+			if err != nil {
+				return
+			}
+			rows.Close()
+			return rows.Err()
+		})
+	}
+
+	check.OK = true
+	for _, p := range check.Probes {
+		check.OK = check.OK && p.OK
+	}
+
+	return
+}
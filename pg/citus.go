@@ -0,0 +1,34 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Citus 11+ propagates CREATE ROLE, GRANT and ALTER DEFAULT PRIVILEGES to the
+// workers by itself. CREATE DATABASE is only propagated from Citus 12.2 when
+// citus.enable_create_database_propagation is on, and schema-based sharding
+// needs Citus 12.
+func citusMode() bool {
+	return os.Getenv(envVarCitus) != ""
+}
+
+func citusDistributeSchema() bool {
+	return citusMode() && os.Getenv(envVarCitusSchema) != ""
+}
+
+func (pg *Postgres) EnsureCitus(ctx context.Context) (err error) {
+	var version string
+	err = pg.db.QueryRow(ctx, "SELECT coalesce((SELECT extversion FROM pg_extension WHERE extname = 'citus'), '');").Scan(&version)
+	if err != nil {
+		err = fmt.Errorf("unable to check for the citus extension: %w", err)
+		return
+	}
+
+	if version == "" {
+		err = fmt.Errorf("citus mode requires the citus extension in the connection database")
+	}
+
+	return
+}
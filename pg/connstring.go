@@ -0,0 +1,155 @@
+package pg
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type ConnHost struct {
+	Host string
+	Port uint16
+}
+
+func (h ConnHost) String() string {
+	return net.JoinHostPort(h.Host, strconv.Itoa(int(h.Port)))
+}
+
+func isUnixSocket(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
+
+// ConnHosts lists every host of a (possibly multi-host) connection string in
+// the order they are tried. pgconn expands sslmode=prefer into one fallback
+// per TLS mode, so duplicates are dropped.
+func ConnHosts(connString string) (hosts []ConnHost, err error) {
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		err = fmt.Errorf("invalid connection string: %w", err)
+		return
+	}
+
+	seen := map[ConnHost]bool{}
+	add := func(h ConnHost) {
+		if !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	add(ConnHost{Host: config.Host, Port: config.Port})
+	for _, fallback := range config.Fallbacks {
+		add(ConnHost{Host: fallback.Host, Port: fallback.Port})
+	}
+
+	return
+}
+
+func ValidateConnString(connString string) (err error) {
+	hosts, err := ConnHosts(connString)
+	if err != nil {
+		return
+	}
+
+	for _, h := range hosts {
+		if !isUnixSocket(h.Host) {
+			continue
+		}
+
+		socket := filepath.Join(h.Host, fmt.Sprintf(".s.PGSQL.%d", h.Port))
+		if _, statErr := os.Stat(socket); statErr != nil {
+			err = fmt.Errorf("unix socket %s is not available: %w", socket, statErr)
+			return
+		}
+	}
+
+	return
+}
+
+// ConnStringWithDatabase points a URL or keyword/value connection string at
+// another database, for external tools such as pg_dump that take one.
+func ConnStringWithDatabase(connString string, dbName string) (string, error) {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", fmt.Errorf("invalid connection string: %w", err)
+		}
+		u.Path = "/" + dbName
+		u.RawPath = ""
+		return u.String(), nil
+	}
+
+	// libpq keeps the last value of a repeated keyword
+	return strings.TrimSpace(fmt.Sprintf("%s dbname=%s", connString, dbName)), nil
+}
+
+var kvPasswordKeyword = regexp.MustCompile(`(?i)(^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S*)\s*`)
+
+// ConnStringWithoutPassword takes the password out of a URL or keyword/value
+// connection string, for external tools whose command line anyone on the
+// host can read. The tools read the password from PGPASSWORD instead.
+func ConnStringWithoutPassword(connString string) (stripped string, password string, err error) {
+	config, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid connection string: %w", err)
+	}
+	password = config.Password
+
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid connection string: %w", err)
+		}
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		q := u.Query()
+		if q.Has("password") {
+			q.Del("password")
+			u.RawQuery = q.Encode()
+		}
+		return u.String(), password, nil
+	}
+
+	stripped = strings.TrimSpace(kvPasswordKeyword.ReplaceAllString(connString, "$1"))
+	return stripped, password, nil
+}
+
+// ConnStringWithOptions sets the server options of a URL or keyword/value
+// connection string, e.g. "-c search_path=tenant", replacing any options it
+// already had.
+func ConnStringWithOptions(connString string, options string) (string, error) {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return "", fmt.Errorf("invalid connection string: %w", err)
+		}
+		q := u.Query()
+		q.Set("options", options)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(options)
+	return strings.TrimSpace(fmt.Sprintf("%s options='%s'", connString, quoted)), nil
+}
+
+var (
+	urlPasswordPattern = regexp.MustCompile(`((?:postgres|postgresql)://[^:/@\s]*:)[^@\s]*@`)
+	kvPasswordPattern  = regexp.MustCompile(`(?i)(password=)('(?:[^'\\]|\\.)*'|[^\s&]*)`)
+)
+
+// RedactDSN scrubs the passwords of the URL, keyword/value and JDBC
+// connection strings found in s, which may be a connection string or any
+// text quoting one, such as an error message or a tool's output.
+func RedactDSN(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}********@")
+	return kvPasswordPattern.ReplaceAllString(s, "${1}********")
+}
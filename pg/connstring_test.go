@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnStringWithoutPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           string
+		wantStripped string
+		wantPassword string
+	}{
+		{"url", "postgres://app:s3cret@db:5432/acme?sslmode=require", "postgres://app@db:5432/acme?sslmode=require", "s3cret"},
+		{"url query", "postgres://app@db/acme?password=s3cret", "postgres://app@db/acme", "s3cret"},
+		{"escaped url", "postgres://app:s3%40cret@db/acme", "postgres://app@db/acme", "s3@cret"},
+		{"keyword/value", "host=db user=app password=s3cret dbname=acme", "host=db user=app dbname=acme", "s3cret"},
+		{"quoted keyword/value", `password='s3 cr\'et' host=db sslpassword=key`, "host=db sslpassword=key", "s3 cr'et"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PGPASSWORD", "")
+			t.Setenv("PGPASSFILE", filepath.Join(t.TempDir(), "pgpass"))
+
+			stripped, password, err := ConnStringWithoutPassword(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stripped != tt.wantStripped || password != tt.wantPassword {
+				t.Errorf("ConnStringWithoutPassword(%q) = %q, %q, want %q, %q", tt.in, stripped, password, tt.wantStripped, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"url", "postgres://app:s3cret@db:5432/acme", "postgres://app:********@db:5432/acme"},
+		{"postgresql url", "postgresql://app:s3cret@db/acme?sslmode=require", "postgresql://app:********@db/acme?sslmode=require"},
+		{"url without password", "postgres://app@db/acme", "postgres://app@db/acme"},
+		{"keyword/value", "host=db user=app password=s3cret dbname=acme", "host=db user=app password=******** dbname=acme"},
+		{"quoted keyword/value", `host=db password='s3 cr\'et' dbname=acme`, "host=db password=******** dbname=acme"},
+		{"jdbc", "jdbc:postgresql://db/acme?user=app&password=s3cret&ssl=true", "jdbc:postgresql://db/acme?user=app&password=********&ssl=true"},
+		{"error message", `failed to connect to "postgres://app:s3cret@db/acme": refused`, `failed to connect to "postgres://app:********@db/acme": refused`},
+		{"no connection string", "pg_dump: dumping contents of table", "pg_dump: dumping contents of table"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactDSN(tt.in); got != tt.want {
+				t.Errorf("RedactDSN(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConnString(t *testing.T) {
+	socketDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(socketDir, ".s.PGSQL.5432"), nil, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"url", "postgres://app@db/acme", false},
+		{"keyword/value", "host=db user=app dbname=acme", false},
+		{"multiple hosts", "postgres://app@db1,db2/acme", false},
+		{"available socket", "host=" + socketDir + " port=5432 user=app", false},
+		{"missing socket", "host=" + socketDir + " port=5433 user=app", true},
+		{"invalid", "postgres://app@db:notaport/acme", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConnString(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateConnString(%q) = %v, want error %t", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
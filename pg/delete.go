@@ -0,0 +1,376 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type dropReplicationKey struct{}
+
+// withDropReplication drops the publications and slots of the schemas deleted
+// with ctx, as for schemas a failed run created and nothing can use yet
+func withDropReplication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dropReplicationKey{}, true)
+}
+
+func dropReplication(ctx context.Context) bool {
+	return os.Getenv(envVarDropRepl) != "" || ctx.Value(dropReplicationKey{}) != nil
+}
+
+func collectNames(ctx context.Context, q PGConnQuerier, sql string, args ...any) (names []string, err error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// tenantSchemaNames lists the schemas of the database conn is connected to
+// that are owned by the tenant owner role
+func tenantSchemaNames(ctx context.Context, conn PGConnQuerier, ownerRole string) ([]string, error) {
+	return collectNames(ctx, conn,
+		"SELECT n.nspname FROM pg_namespace n JOIN pg_roles r ON r.oid = n.nspowner WHERE r.rolname = $1 ORDER BY n.nspname;",
+		ownerRole,
+	)
+}
+
+// Leftover replication slots keep WAL around forever, so they are never left
+// behind silently: they are either dropped, or the deletion is refused.
+func (pg *Postgres) dropReplicationSlots(ctx context.Context, slots []string) (err error) {
+	if len(slots) == 0 {
+		return
+	}
+
+	if !dropReplication(ctx) {
+		err = fmt.Errorf("replication slots %s would be left behind, use --drop-replication to drop them", strings.Join(slots, ", "))
+		return
+	}
+
+	if leastPrivilege() {
+		err = fmt.Errorf("replication slots %s need a role with REPLICATION to be dropped", strings.Join(slots, ", "))
+		return
+	}
+
+	for _, slot := range slots {
+		terminate := fmt.Sprintf(
+			"SELECT pg_terminate_backend(active_pid) FROM pg_replication_slots WHERE slot_name = '%s' AND active_pid IS NOT NULL;",
+			slot,
+		)
+		dropSlot := fmt.Sprintf("SELECT pg_drop_replication_slot('%s');", slot)
+
+		pg.RunExec(ctx, pg.db, terminate)
+
+		_, err = pg.RunExec(ctx, pg.db, dropSlot)
+		if err != nil {
+			err = fmt.Errorf("unable to drop replication slot %s: %w", slot, err)
+			return
+		}
+	}
+
+	logf("dropped replication slots: %s\n", strings.Join(slots, ", "))
+
+	return
+}
+
+// DeleteTenantSchema drops a tenant schema with its groups and users. The
+// schema's publications are dropped with it, and replication slots named after
+// the schema's role prefix (the convention for its CDC connector) must be
+// dropped explicitly.
+func (pg *Postgres) DeleteTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName}
+
+	err = pg.dropTenantSchemaSlots(ctx, dbName, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
+
+	dropSchema := fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;", schemaName)
+
+	err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "delete-schema", operation...)
+
+		// only publications limited to this schema, others just lose its tables
+		var publications []string
+		publications, err = collectNames(ctx, conn,
+			`SELECT p.pubname FROM pg_publication p
+WHERE NOT p.puballtables
+AND (p.pubname = $2 OR EXISTS (SELECT 1 FROM pg_publication_tables t WHERE t.pubname = p.pubname AND t.schemaname = $1))
+AND NOT EXISTS (SELECT 1 FROM pg_publication_tables t WHERE t.pubname = p.pubname AND t.schemaname <> $1)
+ORDER BY p.pubname;`,
+			schemaName, tenantSchemaPublicationName(roleNamePrefix, schemaName),
+		)
+		if err != nil {
+			err = fmt.Errorf("unable to list publications: %w", err)
+			return
+		}
+
+		if len(publications) > 0 && !dropReplication(ctx) {
+			err = fmt.Errorf("publications %s would be left behind, use --drop-replication to drop them", strings.Join(publications, ", "))
+			return
+		}
+
+		for _, publication := range publications {
+			_, err = pg.RunExec(ctx, conn, fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", publication))
+			if err != nil {
+				err = fmt.Errorf("unable to drop publication %s: %w", publication, err)
+				return
+			}
+		}
+
+		_, err = pg.RunExec(ctx, conn, dropSchema)
+		if err != nil {
+			err = fmt.Errorf("unable to drop schema: %w", err)
+			return
+		}
+
+		// dropping the readwrite group would otherwise hand it to the tool's role
+		var tempExists bool
+		tempExists, err = tenantTempSchemaExists(ctx, conn, schemaName, tenantSchemaGroupNames(roleNamePrefix, schemaName))
+		if err != nil || !tempExists {
+			return
+		}
+
+		_, err = pg.RunExec(ctx, conn, fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;", tenantTempSchemaName(schemaName)))
+		if err != nil {
+			err = fmt.Errorf("unable to drop temp schema: %w", err)
+		}
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	return pg.DropTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+}
+
+// the CDC connector of a schema uses the slot named after it; a prefix match
+// would also catch the slots of schemas whose names start the same
+func (pg *Postgres) dropTenantSchemaSlots(ctx context.Context, dbName string, roleNamePrefix string, schemaName string) (err error) {
+	slots, err := collectNames(ctx, pg.db,
+		"SELECT slot_name FROM pg_replication_slots WHERE database = $1 AND slot_name = $2;",
+		dbName, tenantSchemaSlotName(roleNamePrefix, schemaName),
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list replication slots: %w", err)
+		return
+	}
+
+	return pg.dropReplicationSlots(ctx, slots)
+}
+
+// DeleteTenantSchemaUsers drops the login users of a tenant schema and keeps
+// its groups, grants and data, to cut off an application's access. Objects
+// the users own are handed to the tool's role rather than dropped.
+func (pg *Postgres) DeleteTenantSchemaUsers(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	pg.annotate(ctx, pg.db, "delete-schema", "tenant="+roleNamePrefix, "database="+dbName, "schema="+schemaName, "scope=users")
+
+	err = pg.dropTenantSchemaSlots(ctx, dbName, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
+
+	return pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+}
+
+// RevokeTenantSchemaGrants takes away what the schema groups were granted on
+// the database, the schema and its objects, including default privileges,
+// and keeps the roles and the data.
+func (pg *Postgres) RevokeTenantSchemaGrants(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	if connConfig.RoleName == "" {
+		connConfig.RoleName = tenantOwnerName(roleNamePrefix)
+	}
+
+	tenantGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	groups := fmt.Sprintf("%s, %s, %s", tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly)
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName, "scope=grants"}
+
+	revokes := []string{
+		fmt.Sprintf("REVOKE ALL ON ALL TABLES IN SCHEMA %s FROM %s;", schemaName, groups),
+		fmt.Sprintf("REVOKE ALL ON ALL SEQUENCES IN SCHEMA %s FROM %s;", schemaName, groups),
+		fmt.Sprintf("REVOKE ALL ON ALL FUNCTIONS IN SCHEMA %s FROM %s;", schemaName, groups),
+		fmt.Sprintf("REVOKE ALL ON SCHEMA %s FROM %s;", schemaName, groups),
+	}
+
+	defaultAlter := fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s", schemaName)
+	defaultPrivileges := []string{
+		fmt.Sprintf("%s REVOKE ALL ON TABLES FROM %s;", defaultAlter, groups),
+		fmt.Sprintf("%s REVOKE ALL ON SEQUENCES FROM %s;", defaultAlter, groups),
+		fmt.Sprintf("%s REVOKE ALL ON FUNCTIONS FROM %s;", defaultAlter, groups),
+		fmt.Sprintf("%s REVOKE ALL ON TYPES FROM %s;", defaultAlter, groups),
+	}
+
+	err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "delete-schema", operation...)
+
+		for _, revoke := range revokes {
+			_, err = pg.RunExec(ctx, conn, revoke)
+			if err != nil {
+				return
+			}
+		}
+
+		pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
+
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to revoke schema grants: %w", err)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM %s;", dbName, groups))
+	if err != nil {
+		err = fmt.Errorf("unable to revoke database grants: %w", err)
+	}
+
+	return
+}
+
+func (pg *Postgres) listTenantSchemas(ctx context.Context, dbName string, roleNamePrefix string) (schemaNames []string, err error) {
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		schemaNames, err = tenantSchemaNames(ctx, conn, tenantOwnerName(roleNamePrefix))
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to list tenant schemas: %w", err)
+	}
+
+	return
+}
+
+// DeleteTenantDBUsers drops the login users of every tenant schema in a
+// database, see DeleteTenantSchemaUsers
+func (pg *Postgres) DeleteTenantDBUsers(ctx context.Context, dbName string, tenantName string) (err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	schemaNames, err := pg.listTenantSchemas(ctx, dbName, roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	for _, schemaName := range schemaNames {
+		err = pg.DeleteTenantSchemaUsers(ctx, schemaName, tenantName, ConnectDBConfig{DBName: dbName})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// RevokeTenantDBGrants takes away the grants of every tenant schema in a
+// database, see RevokeTenantSchemaGrants
+func (pg *Postgres) RevokeTenantDBGrants(ctx context.Context, dbName string, tenantName string) (err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	schemaNames, err := pg.listTenantSchemas(ctx, dbName, roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	for _, schemaName := range schemaNames {
+		err = pg.RevokeTenantSchemaGrants(ctx, schemaName, tenantName, ConnectDBConfig{DBName: dbName})
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// DeleteTenantDB drops a tenant database, the roles of the schemas its owner
+// created, and the owner role. Replication slots in the database would make
+// DROP DATABASE fail, so they are dropped first.
+func (pg *Postgres) DeleteTenantDB(ctx context.Context, dbName string, tenantName string) (err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	slots, err := collectNames(ctx, pg.db,
+		"SELECT slot_name FROM pg_replication_slots WHERE database = $1 ORDER BY slot_name;",
+		dbName,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list replication slots: %w", err)
+		return
+	}
+
+	err = pg.dropReplicationSlots(ctx, slots)
+	if err != nil {
+		return
+	}
+
+	var schemaNames []string
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "delete-database", "tenant="+roleNamePrefix, "database="+dbName)
+
+		schemaNames, err = tenantSchemaNames(ctx, conn, ownerRole)
+		if err != nil {
+			err = fmt.Errorf("unable to list tenant schemas: %w", err)
+		}
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	err = pg.DropDB(ctx, dbName)
+	if err != nil {
+		return
+	}
+
+	for _, schemaName := range schemaNames {
+		err = pg.DropTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+		if err != nil {
+			return
+		}
+	}
+
+	return pg.DropRole(ctx, ownerRole)
+}
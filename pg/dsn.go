@@ -0,0 +1,122 @@
+package pg
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func withDSN() bool {
+	return os.Getenv(envVarWithDSN) != ""
+}
+
+// connStringSSLMode finds the sslmode of a URL or keyword/value connection
+// string, which pgconn turns into a TLS config without keeping the name.
+func connStringSSLMode(connString string) string {
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		if u, err := url.Parse(connString); err == nil && u.Query().Has("sslmode") {
+			return u.Query().Get("sslmode")
+		}
+	} else {
+		for _, field := range strings.Fields(connString) {
+			if value, ok := strings.CutPrefix(field, "sslmode="); ok {
+				return strings.Trim(value, "'")
+			}
+		}
+	}
+
+	return os.Getenv("PGSSLMODE")
+}
+
+func quoteDSNValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// setDSNs fills in ready-to-use connection strings for a user, with the host,
+// port and sslmode of the tool's own connection. JDBC has no unix socket
+// support, so socket connections get no JDBC URL.
+func (pg *Postgres) setDSNs(user *UserCredentials, dbName string) {
+	config := pg.db.Config().ConnConfig
+	port := strconv.Itoa(int(config.Port))
+
+	uri := url.URL{Scheme: "postgresql", Path: "/" + dbName}
+	query := url.Values{}
+	keyValue := []string{}
+
+	if user.Password != "" {
+		uri.User = url.UserPassword(user.Username, user.Password)
+	} else {
+		uri.User = url.User(user.Username)
+	}
+
+	if isUnixSocket(config.Host) {
+		query.Set("host", config.Host)
+		query.Set("port", port)
+	} else {
+		uri.Host = net.JoinHostPort(config.Host, port)
+	}
+
+	keyValue = append(keyValue,
+		"host="+quoteDSNValue(config.Host),
+		"port="+port,
+		"dbname="+quoteDSNValue(dbName),
+		"user="+quoteDSNValue(user.Username),
+	)
+	if user.Password != "" {
+		keyValue = append(keyValue, "password="+quoteDSNValue(user.Password))
+	}
+
+	if sslMode := pg.sslMode; sslMode != "" {
+		query.Set("sslmode", sslMode)
+		keyValue = append(keyValue, "sslmode="+sslMode)
+	}
+
+	uri.RawQuery = query.Encode()
+	user.URI = uri.String()
+	user.DSN = strings.Join(keyValue, " ")
+
+	if isUnixSocket(config.Host) {
+		user.JDBC = ""
+		return
+	}
+
+	jdbcQuery := url.Values{}
+	jdbcQuery.Set("user", user.Username)
+	if user.Password != "" {
+		jdbcQuery.Set("password", user.Password)
+	}
+	if pg.sslMode != "" {
+		jdbcQuery.Set("sslmode", pg.sslMode)
+	}
+	user.JDBC = fmt.Sprintf("jdbc:postgresql://%s/%s?%s", net.JoinHostPort(config.Host, port), url.PathEscape(dbName), jdbcQuery.Encode())
+}
+
+// addDSNs returns the credentials with connection strings for every user
+func (pg *Postgres) addDSNs(credentials any, dbName string) any {
+	switch users := credentials.(type) {
+	case SchemaUsers:
+		for _, user := range []*UserCredentials{&users.Admin, &users.ReadWrite, &users.ReadOnly, users.CDC} {
+			if user != nil {
+				pg.setDSNs(user, dbName)
+			}
+		}
+		return users
+	case DualSchemaUsers:
+		for _, dual := range []*DualUserCredentials{&users.Admin, &users.ReadWrite, &users.ReadOnly} {
+			pg.setDSNs(&dual.A, dbName)
+			pg.setDSNs(&dual.B, dbName)
+		}
+		if users.CDC != nil {
+			pg.setDSNs(users.CDC, dbName)
+		}
+		return users
+	case UserCredentials:
+		pg.setDSNs(&users, dbName)
+		return users
+	}
+
+	return credentials
+}
@@ -0,0 +1,56 @@
+package pg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestSetDSNs(t *testing.T) {
+	tests := []struct {
+		name     string
+		connStr  string
+		wantURI  string
+		wantJDBC string
+	}{
+		{
+			name:     "host name",
+			connStr:  "postgres://app@db:5433/postgres",
+			wantURI:  "postgresql://acme_app_rw_usr:s3cret@db:5433/acme",
+			wantJDBC: "jdbc:postgresql://db:5433/acme?password=s3cret&user=acme_app_rw_usr",
+		},
+		{
+			name:     "ipv6",
+			connStr:  "postgres://app@[::1]:5433/postgres",
+			wantURI:  "postgresql://acme_app_rw_usr:s3cret@[::1]:5433/acme",
+			wantJDBC: "jdbc:postgresql://[::1]:5433/acme?password=s3cret&user=acme_app_rw_usr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := pgxpool.ParseConfig(tt.connStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the pool connects lazily, so nothing is dialed
+			db, err := pgxpool.NewWithConfig(context.Background(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			user := UserCredentials{Username: "acme_app_rw_usr", Password: "s3cret"}
+			(&Postgres{db: db}).setDSNs(&user, "acme")
+
+			if user.URI != tt.wantURI {
+				t.Errorf("URI = %q, want %q", user.URI, tt.wantURI)
+			}
+			if user.JDBC != tt.wantJDBC {
+				t.Errorf("JDBC = %q, want %q", user.JDBC, tt.wantJDBC)
+			}
+		})
+	}
+}
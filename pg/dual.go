@@ -0,0 +1,231 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func dualUserNames(username string) (a string, b string) {
+	return fmt.Sprintf("%s%s", username, dualSuffixA), fmt.Sprintf("%s%s", username, dualSuffixB)
+}
+
+func (pg *Postgres) DropTenantSchemaDualUsers(ctx context.Context, roleNamePrefix string, schemaName string) (err error) {
+	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+
+	for _, user := range []UserCredentials{schemaUsers.ReadOnly, schemaUsers.ReadWrite, schemaUsers.Admin} {
+		a, b := dualUserNames(user.Username)
+		err = pg.dropRoles(ctx, a, b)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (pg *Postgres) newDualUser(ctx context.Context, user UserCredentials, groupname string) (dual DualUserCredentials, err error) {
+	a, b := dualUserNames(user.Username)
+
+	dual.A.Username = a
+	dual.A.Password = user.Password
+	dual.B.Username = b
+	dual.B.Password, err = initialPassword()
+	if err != nil {
+		return
+	}
+
+	err = pg.CreateUser(ctx, dual.A, groupname)
+	if err != nil {
+		return
+	}
+
+	err = pg.CreateUser(ctx, dual.B, groupname)
+	if err != nil {
+		return
+	}
+
+	err = pg.markLiveUser(ctx, dual.A.Username, dual.B.Username)
+	dual.Live = dual.A.Username
+
+	return
+}
+
+func (pg *Postgres) NewTenantSchemaDualUsers(ctx context.Context, roleNamePrefix string, schemaName string) (dualUsers DualSchemaUsers, err error) {
+	err = pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
+
+	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+
+	dualUsers.Admin, err = pg.newDualUser(ctx, schemaUsers.Admin, schemaGroups.Admin)
+	if err != nil {
+		return
+	}
+
+	dualUsers.ReadWrite, err = pg.newDualUser(ctx, schemaUsers.ReadWrite, schemaGroups.ReadWrite)
+	if err != nil {
+		return
+	}
+
+	dualUsers.ReadOnly, err = pg.newDualUser(ctx, schemaUsers.ReadOnly, schemaGroups.ReadOnly)
+
+	return
+}
+
+func (pg *Postgres) markLiveUser(ctx context.Context, live string, inactive string) (err error) {
+	commentLive := fmt.Sprintf("COMMENT ON ROLE %s IS '%s';", live, liveUserComment)
+	commentInactive := fmt.Sprintf("COMMENT ON ROLE %s IS NULL;", inactive)
+
+	_, err = pg.RunExec(ctx, pg.db, commentLive)
+	if err != nil {
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, commentInactive)
+
+	return
+}
+
+func (pg *Postgres) liveDualUser(ctx context.Context, username string) (live string, inactive string, err error) {
+	a, b := dualUserNames(username)
+
+	for _, roleName := range []string{a, b} {
+		var exists bool
+		exists, err = pg.CheckIfRoleExists(ctx, roleName)
+		if err != nil {
+			return
+		}
+		if !exists {
+			err = fmt.Errorf("dual user %s does not exist", roleName)
+			return
+		}
+	}
+
+	err = pg.db.QueryRow(ctx,
+		"SELECT rolname FROM pg_roles WHERE rolname IN ($1, $2) AND shobj_description(oid, 'pg_authid') = $3;",
+		a, b, liveUserComment,
+	).Scan(&live)
+
+	// with no marker, the A user is considered live
+	if errors.Is(err, pgx.ErrNoRows) {
+		live, err = a, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("unable to find live user: %w", err)
+		return
+	}
+
+	inactive = b
+	if live == b {
+		inactive = a
+	}
+
+	return
+}
+
+func (pg *Postgres) RotateTenantSchemaDualUser(ctx context.Context, schemaName string, tenantName string, role string, connConfig ConnectDBConfig) (creds UserCredentials, err error) {
+	creds, err = pg.rotateTenantSchemaDualUser(ctx, schemaName, tenantName, role, connConfig)
+	if err != nil {
+		return
+	}
+
+	if withDSN() {
+		pg.setDSNs(&creds, connConfig.DBName)
+	}
+
+	outputRoleCredentials(role, creds)
+
+	return
+}
+
+func (pg *Postgres) RotateTenantSchemaDualUsers(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (users SchemaUsers, err error) {
+	users.Admin, err = pg.rotateTenantSchemaDualUser(ctx, schemaName, tenantName, roleAdmin, connConfig)
+	if err != nil {
+		return
+	}
+
+	users.ReadWrite, err = pg.rotateTenantSchemaDualUser(ctx, schemaName, tenantName, roleReadWrite, connConfig)
+	if err != nil {
+		return
+	}
+
+	users.ReadOnly, err = pg.rotateTenantSchemaDualUser(ctx, schemaName, tenantName, roleReadOnly, connConfig)
+	if err != nil {
+		return
+	}
+
+	if withDSN() {
+		users = pg.addDSNs(users, connConfig.DBName).(SchemaUsers)
+	}
+
+	outputCredentials(users)
+
+	return
+}
+
+// The inactive user of the pair gets a new password and becomes live. The
+// previously live user keeps working until the next rotation.
+func (pg *Postgres) rotateTenantSchemaDualUser(ctx context.Context, schemaName string, tenantName string, role string, connConfig ConnectDBConfig) (creds UserCredentials, err error) {
+
+	if noCredentialsOutput() {
+		err = fmt.Errorf("rotated passwords can't be withheld, unset --no-credentials-output")
+		return
+	}
+
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = connConfig.DBName
+	}
+
+	username, groupname, err := tenantSchemaRoleNames(roleNamePrefix, schemaName, role)
+	if err != nil {
+		return
+	}
+
+	pg.annotate(ctx, pg.db, "rotate-credentials", "tenant="+roleNamePrefix, "schema="+schemaName, "role="+role, "dual=true")
+
+	live, inactive, err := pg.liveDualUser(ctx, username)
+	if err != nil {
+		return
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return
+	}
+
+	creds = UserCredentials{
+		Username: inactive,
+		Password: password,
+	}
+
+	alterPassword := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD '%s';", inactive, password)
+	_, err = pg.RunExec(ctx, pg.db, alterPassword)
+	if err != nil {
+		err = fmt.Errorf("unable to rotate password: %w", err)
+		return
+	}
+
+	err = pg.markLiveUser(ctx, inactive, live)
+	if err != nil {
+		err = fmt.Errorf("unable to mark live user: %w", err)
+		return
+	}
+
+	pg.recordRotation(ctx, groupname, inactive)
+
+	logf("%s: %s is live, %s is inactive\n", role, inactive, live)
+
+	return
+}
@@ -0,0 +1,61 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ExecSQLFile runs an operator's SQL file in a tenant database, through the
+// same logging, halt-on-error, dry-run and read-only handling as provisioning.
+// The file is sent as one batch, like a blueprint. With asOwner it runs as the
+// tenant owner role, and with a schema name unqualified names resolve to it.
+func (pg *Postgres) ExecSQLFile(ctx context.Context, path string, schemaName string, tenantName string, asOwner bool, connConfig ConnectDBConfig) (err error) {
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	sql, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("unable to read SQL file: %w", err)
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = connConfig.DBName
+	}
+
+	if asOwner {
+		connConfig.RoleName = tenantOwnerName(roleNamePrefix)
+	}
+
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + connConfig.DBName, "file=" + filepath.Base(path)}
+	if schemaName != "" {
+		operation = append(operation, "schema="+schemaName)
+	}
+
+	// the file may change the session, e.g. with SET ROLE, so it gets a
+	// connection of its own
+	err = pg.withSessionDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "exec-sql", operation...)
+
+		if schemaName != "" {
+			_, err = pg.RunExec(ctx, conn, fmt.Sprintf("SET search_path TO %s;", schemaName))
+			if err != nil {
+				return
+			}
+		}
+
+		_, err = pg.RunExec(ctx, conn, string(sql))
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to run %s: %w", path, err)
+	}
+
+	return
+}
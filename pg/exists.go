@@ -0,0 +1,196 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// VerifyTenantDB reports whether the tenant database exists in the state
+// create-database leaves it in. A database that exists in any other state is
+// an error rather than something to recreate, since recreating drops it.
+func (pg *Postgres) VerifyTenantDB(ctx context.Context, dbName string, tenantName string) (exists bool, err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	var owner, comment string
+	err = pg.db.QueryRow(ctx,
+		`SELECT pg_get_userbyid(datdba), coalesce(shobj_description(oid, 'pg_database'), '')
+FROM pg_database WHERE datname = $1;`,
+		dbName,
+	).Scan(&owner, &comment)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to check database %s: %w", dbName, err)
+		return
+	}
+
+	exists = true
+
+	if _, _, ok := parseDeadlineComment(purgeAfterComment, comment); ok {
+		err = fmt.Errorf("database %s is disabled and waiting to be purged", dbName)
+		return
+	}
+
+	ownerExists, err := pg.CheckIfRoleExists(ctx, ownerRole)
+	if err != nil {
+		return
+	}
+
+	if !ownerExists {
+		err = fmt.Errorf("database %s exists but its owner role %s does not", dbName, ownerRole)
+		return
+	}
+
+	// the supabase profile uses a database it doesn't own
+	if owner != ownerRole && !supabaseProfile() {
+		err = fmt.Errorf("database %s exists but is owned by %s instead of %s", dbName, owner, ownerRole)
+		return
+	}
+
+	logf("database %s already exists\n", dbName)
+
+	return
+}
+
+// VerifyTenantSchema reports whether the tenant schema exists in the state
+// create-schema leaves it in: owned by the tenant owner role, with its groups
+// and users, each user a member of its group, and no function executable by
+// PUBLIC. Other grants aren't compared; that is what reconcile is for.
+func (pg *Postgres) VerifyTenantSchema(ctx context.Context, schemaName string, tenantName string, dbName string) (exists bool, err error) {
+	exists, problems, err := pg.tenantSchemaProblems(ctx, schemaName, tenantName, dbName)
+	if err != nil || !exists {
+		return
+	}
+
+	if len(problems) > 0 {
+		err = fmt.Errorf("schema %s exists but %s", schemaName, strings.Join(problems, ", "))
+		return
+	}
+
+	logf("schema %s already exists in database %s\n", schemaName, dbName)
+
+	return
+}
+
+// TenantSchemaDrift lists how a tenant schema differs from the state
+// VerifyTenantSchema expects, a missing schema included. An error means the
+// check itself failed.
+func (pg *Postgres) TenantSchemaDrift(ctx context.Context, schemaName string, tenantName string, dbName string) (problems []string, err error) {
+	exists, problems, err := pg.tenantSchemaProblems(ctx, schemaName, tenantName, dbName)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		problems = []string{fmt.Sprintf("schema %s is missing", schemaName)}
+	}
+
+	return
+}
+
+func (pg *Postgres) tenantSchemaProblems(ctx context.Context, schemaName string, tenantName string, dbName string) (exists bool, problems []string, err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	var owner string
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) error {
+		return conn.QueryRow(ctx,
+			"SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = $1;",
+			schemaName,
+		).Scan(&owner)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to check schema %s: %w", schemaName, err)
+		return
+	}
+
+	exists = true
+
+	if owner != ownerRole {
+		problems = append(problems, fmt.Sprintf("owned by %s instead of %s", owner, ownerRole))
+	}
+
+	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+
+	type membership struct {
+		username  string
+		groupname string
+	}
+
+	var members []membership
+	for _, m := range []membership{
+		{schemaUsers.Admin.Username, schemaGroups.Admin},
+		{schemaUsers.ReadWrite.Username, schemaGroups.ReadWrite},
+		{schemaUsers.ReadOnly.Username, schemaGroups.ReadOnly},
+	} {
+		if dualUsers() {
+			a, b := dualUserNames(m.username)
+			members = append(members, membership{a, m.groupname}, membership{b, m.groupname})
+		} else {
+			members = append(members, m)
+		}
+	}
+
+	for _, groupname := range []string{schemaGroups.Admin, schemaGroups.ReadWrite, schemaGroups.ReadOnly} {
+		var groupExists bool
+		groupExists, err = pg.CheckIfRoleExists(ctx, groupname)
+		if err != nil {
+			return
+		}
+		if !groupExists {
+			problems = append(problems, fmt.Sprintf("group %s is missing", groupname))
+		}
+	}
+
+	for _, m := range members {
+		var member bool
+		member, err = pg.CheckIfUserIsMember(ctx, m.username, m.groupname)
+		if err != nil {
+			return
+		}
+		if !member {
+			problems = append(problems, fmt.Sprintf("user %s is missing or not a member of %s", m.username, m.groupname))
+		}
+	}
+
+	// a NULL ACL is the default, which lets PUBLIC execute
+	var publicFunctions int
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) error {
+		return conn.QueryRow(ctx,
+			`SELECT count(*) FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE n.nspname = $1
+AND (p.proacl IS NULL OR EXISTS (SELECT 1 FROM aclexplode(p.proacl) a WHERE a.grantee = 0 AND a.privilege_type = 'EXECUTE'));`,
+			schemaName,
+		).Scan(&publicFunctions)
+	})
+	if err != nil {
+		err = fmt.Errorf("unable to check function privileges in schema %s: %w", schemaName, err)
+		return
+	}
+
+	if publicFunctions > 0 {
+		problems = append(problems, fmt.Sprintf("%d functions are executable by PUBLIC", publicFunctions))
+	}
+
+	return
+}
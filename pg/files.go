@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// concurrent operations append to the same SQL file
+var appendMu sync.Mutex
+
+func appendToFile(filename string, content string) {
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	f, err := os.OpenFile(filename,
+		os.O_APPEND|os.O_CREATE|os.O_WRONLY, outFileMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+
+	defer f.Close()
+
+	// other processes may append to the same file
+	if err := lockFile(f); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to lock %s: %v\n", filename, err)
+		return
+	}
+
+	defer unlockFile(f)
+
+	if _, err := f.WriteString(content); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+// startSQLLog appends the header of a run to the SQL log, which other runs
+// may be appending to. The log holds passwords, so it is protected like the
+// credentials files.
+func startSQLLog(filename string, header string) {
+	appendToFile(filename, fmt.Sprintf("\n%s\n", header))
+
+	if err := protectFile(filename); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and
+// renames it into place, so that readers never see a partial credentials
+// file and concurrent writers don't mix their contents
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	err = f.Chmod(perm)
+	if err != nil {
+		return
+	}
+
+	// before any data is written
+	err = protectFile(f.Name())
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		return
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return
+	}
+
+	err = f.Close()
+	if err != nil {
+		return
+	}
+
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package pg
+
+import "os"
+
+// without advisory locks, writes are only serialized within the process
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+func protectFile(filename string) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package pg
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory lock, so that processes sharing an
+// output directory don't interleave their writes
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
+
+// protectFile is a no-op, outFileMode already keeps the file private
+func protectFile(filename string) error {
+	return nil
+}
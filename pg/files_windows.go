@@ -0,0 +1,55 @@
+//go:build windows
+
+package pg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 0x2
+
+// lockFile locks the first byte of the file, which every process writing to
+// it locks too, so it works like flock on Unix
+func lockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	var overlapped syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// protectFile is the ACL equivalent of outFileMode, which Windows ignores:
+// inherited entries are removed and only the current user gets access
+func protectFile(filename string) error {
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command("icacls", filename, "/inheritance:r", "/grant:r", u.Username+":F").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("unable to restrict access to %s: %v: %s", filename, err, out)
+	}
+	return nil
+}
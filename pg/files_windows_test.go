@@ -0,0 +1,95 @@
+//go:build windows
+
+package pg
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+const lockfileFailImmediately = 0x1
+
+// tryLockFile is lockFile without waiting, to tell whether the file is locked
+func tryLockFile(f *os.File) bool {
+	var overlapped syscall.Overlapped
+	r, _, _ := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	return r != 0
+}
+
+func TestLockFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.sql")
+
+	first, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, outFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	second, err := os.OpenFile(filename, os.O_WRONLY, outFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	err = lockFile(first)
+	if err != nil {
+		t.Fatalf("lockFile() = %v", err)
+	}
+
+	if tryLockFile(second) {
+		t.Fatalf("file locked twice")
+	}
+
+	err = unlockFile(first)
+	if err != nil {
+		t.Fatalf("unlockFile() = %v", err)
+	}
+
+	if !tryLockFile(second) {
+		t.Fatalf("file still locked after unlockFile()")
+	}
+	unlockFile(second)
+}
+
+func TestProtectFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "creds.json")
+
+	err := os.WriteFile(filename, []byte("{}"), outFileMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = protectFile(filename)
+	if err != nil {
+		t.Fatalf("protectFile() = %v", err)
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("icacls", filename).CombinedOutput()
+	if err != nil {
+		t.Fatalf("icacls: %v: %s", err, out)
+	}
+
+	// icacls lists the file name, then one entry per line, then a summary
+	var entries []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(out), filename, ""), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, ":(") {
+			entries = append(entries, line)
+		}
+	}
+
+	if len(entries) != 1 || !strings.EqualFold(entries[0], u.Username+":(F)") {
+		t.Errorf("access entries = %q, want only %s:(F)", entries, u.Username)
+	}
+}
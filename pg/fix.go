@@ -0,0 +1,115 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// Partitions are regular tables: queries through the parent only check the
+// parent's privileges, but direct access to a partition checks its own. New
+// partitions get the owner's default privileges only when the owner creates
+// them, not when a maintenance job such as pg_partman runs as another role,
+// so they are granted explicitly like tables created by the owner.
+func partitionGrants(partition string, tenantGroups SchemaGroups) []string {
+	return []string{
+		fmt.Sprintf("GRANT ALL ON %s TO %s;", partition, tenantGroups.Admin),
+		fmt.Sprintf("GRANT SELECT, INSERT, UPDATE, DELETE ON %s TO %s;", partition, tenantGroups.ReadWrite),
+		fmt.Sprintf("GRANT SELECT ON %s TO %s;", partition, tenantGroups.ReadOnly),
+	}
+}
+
+// FixTenantSchemaPermissions re-applies the schema grants and default
+// privileges, then grants on partitions the readonly group can't read yet,
+// and on the configured foreign servers and large objects.
+// With partitionsOnly only the partitions are touched, which is cheap enough
+// to run on a schedule.
+func (pg *Postgres) FixTenantSchemaPermissions(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig, partitionsOnly bool) (err error) {
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	if connConfig.RoleName == "" {
+		connConfig.RoleName = tenantOwnerName(roleNamePrefix)
+	}
+
+	tenantGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName}
+
+	if !partitionsOnly {
+		grants, defaultPrivileges := tenantSchemaGrants(schemaName, tenantGroups)
+
+		err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+			pg.annotate(ctx, conn, "fix-permissions", append(operation, "phase=grants")...)
+
+			for _, grant := range grants {
+				pg.RunExec(ctx, conn, grant)
+			}
+
+			pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
+
+			return
+		})
+
+		if err != nil {
+			return
+		}
+	}
+
+	// partitions may be owned by other roles, so the tool's role grants on them
+	var partitions []string
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		partitions, err = collectNames(ctx, conn,
+			`SELECT format('%I.%I', n.nspname, c.relname) FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relispartition AND c.relkind IN ('r', 'p') AND n.nspname = $1
+AND NOT has_table_privilege($2, c.oid, 'SELECT')
+ORDER BY 1;`,
+			schemaName, tenantGroups.ReadOnly,
+		)
+		if err != nil {
+			err = fmt.Errorf("unable to list partitions: %w", err)
+		}
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	// each partition has its own ACL, so partitions can be granted on in parallel
+	err = pg.fanOut(ctx, ConnectDBConfig{DBName: dbName}, "fix-permissions", append(operation, "phase=partitions"), partitions, func(conn PGConnQuerier, partition string) (err error) {
+		for _, grant := range partitionGrants(partition, tenantGroups) {
+			_, err = pg.RunExec(ctx, conn, grant)
+			if err != nil {
+				return fmt.Errorf("unable to grant on partition %s: %w", partition, err)
+			}
+		}
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	logf("granted privileges on %d partitions\n", len(partitions))
+
+	return pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		for _, grant := range tenantSchemaObjectGrants(tenantGroups) {
+			_, err = pg.RunExec(ctx, conn, grant)
+			if err != nil {
+				err = fmt.Errorf("unable to grant on foreign servers and large objects: %w", err)
+				return
+			}
+		}
+
+		return
+	})
+}
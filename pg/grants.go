@@ -0,0 +1,192 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tenantSchemaGrants returns the statements that give the schema groups their
+// privileges on the schema and on existing objects, and the default
+// privileges for objects the owner creates later. They are all idempotent.
+func tenantSchemaGrants(schemaName string, tenantGroups SchemaGroups) (grants []string, defaultPrivileges []string) {
+	matrix := currentGrantMatrix()
+
+	// admin privileges
+
+	grantSchemaAdminCreate := fmt.Sprintf("GRANT USAGE, CREATE ON SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
+	grantSchemaAdminTables := fmt.Sprintf("GRANT ALL ON ALL TABLES IN SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
+	grantSchemaAdminSequences := fmt.Sprintf("GRANT ALL ON ALL SEQUENCES IN SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
+
+	// basic privileges
+
+	grantSchemaUsage := fmt.Sprintf(
+		"GRANT USAGE ON SCHEMA %s TO %s;",
+		schemaName, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
+	)
+
+	grantTablesRead := fmt.Sprintf(
+		"GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s;",
+		schemaName, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
+	)
+
+	sequenceGroups := tenantGroups.ReadWrite
+	if matrix.readOnlySequences {
+		sequenceGroups = fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly)
+	}
+
+	grantSequencesRead := fmt.Sprintf(
+		"GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA %s TO %s;",
+		schemaName, sequenceGroups,
+	)
+
+	// default privileges
+
+	// partial cmd
+	defaultAlter := fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s", schemaName)
+
+	grantDefaultSequencesRead := fmt.Sprintf(
+		"%s GRANT USAGE, SELECT ON SEQUENCES TO %s;",
+		defaultAlter, sequenceGroups,
+	)
+
+	grantDefaultSequencesWrite := fmt.Sprintf(
+		"%s GRANT UPDATE ON SEQUENCES TO %s;",
+		defaultAlter, tenantGroups.ReadWrite,
+	)
+
+	grantDefaultTablesRead := fmt.Sprintf(
+		"%s GRANT SELECT ON TABLES TO %s;",
+		defaultAlter, tenantGroups.ReadOnly,
+	)
+
+	grantDefaultTablesReadWrite := fmt.Sprintf(
+		"%s GRANT %s ON TABLES TO %s;",
+		defaultAlter, strings.Join(matrix.readWriteTables, ", "), tenantGroups.ReadWrite,
+	)
+
+	grants = []string{
+		grantSchemaAdminCreate,
+		grantSchemaAdminTables,
+		grantSchemaAdminSequences,
+		grantSchemaUsage,
+		grantTablesRead,
+		grantSequencesRead,
+	}
+
+	defaultPrivileges = []string{
+		grantDefaultSequencesRead,
+		grantDefaultSequencesWrite,
+		grantDefaultTablesRead,
+		grantDefaultTablesReadWrite,
+	}
+
+	// pg_dump --schema needs SELECT on every table and sequence it dumps, and
+	// pg_read_all_data is cluster-wide and only exists from PostgreSQL 14, so
+	// the admin group gets the equivalent scoped to the schema: existing
+	// objects are covered above, objects created later by the owner here.
+	if dumpCompat() {
+		defaultPrivileges = append(defaultPrivileges,
+			fmt.Sprintf("%s GRANT ALL ON TABLES TO %s;", defaultAlter, tenantGroups.Admin),
+			fmt.Sprintf("%s GRANT ALL ON SEQUENCES TO %s;", defaultAlter, tenantGroups.Admin),
+			fmt.Sprintf("%s GRANT EXECUTE ON FUNCTIONS TO %s;", defaultAlter, tenantGroups.Admin),
+			fmt.Sprintf("%s GRANT USAGE ON TYPES TO %s;", defaultAlter, tenantGroups.Admin),
+		)
+	}
+
+	auditGrants, auditDefaultPrivileges := pgauditGrants(schemaName)
+	grants = append(grants, auditGrants...)
+	defaultPrivileges = append(defaultPrivileges, auditDefaultPrivileges...)
+
+	// UPDATE on a sequence allows setval, which is how a non-owner restarts it:
+	// ALTER SEQUENCE ... RESTART always requires ownership
+	switch os.Getenv(envVarRWSequences) {
+	case rwSequencesSetval:
+		grants = append(grants, fmt.Sprintf("GRANT UPDATE ON ALL SEQUENCES IN SCHEMA %s TO %s;", schemaName, tenantGroups.ReadWrite))
+	case rwSequencesDeny:
+		grants = append(grants, fmt.Sprintf("REVOKE UPDATE ON ALL SEQUENCES IN SCHEMA %s FROM %s;", schemaName, tenantGroups.ReadWrite))
+		for i, sql := range defaultPrivileges {
+			if sql == grantDefaultSequencesWrite {
+				defaultPrivileges[i] = fmt.Sprintf("%s REVOKE UPDATE ON SEQUENCES FROM %s;", defaultAlter, tenantGroups.ReadWrite)
+			}
+		}
+	}
+
+	// functions are executable by PUBLIC unless revoked, and PUBLIC includes
+	// every other tenant's roles. Per-schema default privileges can't take
+	// away a global default, so the owner's default for the whole database
+	// is changed, and the schema groups are granted what PUBLIC had.
+	allGroups := fmt.Sprintf("%s, %s, %s", tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly)
+	grants = append(grants,
+		fmt.Sprintf("REVOKE EXECUTE ON ALL FUNCTIONS IN SCHEMA %s FROM PUBLIC;", schemaName),
+		fmt.Sprintf("GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA %s TO %s;", schemaName, allGroups),
+	)
+	defaultPrivileges = append(defaultPrivileges,
+		"ALTER DEFAULT PRIVILEGES REVOKE EXECUTE ON FUNCTIONS FROM PUBLIC;",
+		fmt.Sprintf("%s GRANT EXECUTE ON FUNCTIONS TO %s;", defaultAlter, allGroups),
+	)
+
+	// a stricter preset applied to an existing schema takes away what it
+	// leaves out
+	if !matrix.readOnlySequences {
+		grants = append(grants, fmt.Sprintf("REVOKE ALL ON ALL SEQUENCES IN SCHEMA %s FROM %s;", schemaName, tenantGroups.ReadOnly))
+		defaultPrivileges = append(defaultPrivileges, fmt.Sprintf("%s REVOKE ALL ON SEQUENCES FROM %s;", defaultAlter, tenantGroups.ReadOnly))
+	}
+
+	return
+}
+
+func dumpCompat() bool {
+	return os.Getenv(envVarDumpCompat) != ""
+}
+
+func foreignServers() (servers []string) {
+	for _, server := range strings.Split(os.Getenv(envVarFDWServers), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	return
+}
+
+func largeObjects() bool {
+	return os.Getenv(envVarLargeObjs) != ""
+}
+
+// tenantSchemaObjectGrants covers objects that live outside the schema and
+// that the tenant owner can't grant on, so the tool's role runs them. Foreign
+// tables are already covered by ALL TABLES and the table default privileges;
+// the admin group additionally gets USAGE on the configured foreign servers
+// to create its own foreign tables. Large objects belong to no schema, so
+// those owned by the schema admins are granted like tables. Before
+// PostgreSQL 18 large objects have no default privileges, so new ones are
+// only covered by the next fix-permissions run.
+func tenantSchemaObjectGrants(tenantGroups SchemaGroups) (grants []string) {
+	for _, server := range foreignServers() {
+		grants = append(grants, fmt.Sprintf("GRANT USAGE ON FOREIGN SERVER %s TO %s;", server, tenantGroups.Admin))
+	}
+
+	if largeObjects() {
+		grants = append(grants, fmt.Sprintf(
+			`DO $$
+DECLARE
+	lo oid;
+BEGIN
+	FOR lo IN
+		SELECT m.oid FROM pg_largeobject_metadata m
+		WHERE m.lomowner IN (
+			SELECT oid FROM pg_roles WHERE rolname = '%[1]s'
+			UNION SELECT am.member FROM pg_auth_members am JOIN pg_roles g ON g.oid = am.roleid WHERE g.rolname = '%[1]s'
+		)
+	LOOP
+		EXECUTE format('GRANT SELECT, UPDATE ON LARGE OBJECT %%s TO %[1]s, %[2]s', lo);
+		EXECUTE format('GRANT SELECT ON LARGE OBJECT %%s TO %[3]s', lo);
+	END LOOP;
+END
+$$;`,
+			tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly,
+		))
+	}
+
+	return
+}
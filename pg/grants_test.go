@@ -0,0 +1,33 @@
+package pg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTenantSchemaGrantsSequencesDeny(t *testing.T) {
+	t.Setenv(envVarRWSequences, rwSequencesDeny)
+	t.Setenv(envVarDumpCompat, "true")
+	t.Setenv(envVarPgauditRole, "auditor")
+
+	groups := tenantSchemaGroupNames("acme", "app")
+	_, defaultPrivileges := tenantSchemaGrants("app", groups)
+
+	for _, want := range []string{
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app REVOKE UPDATE ON SEQUENCES FROM " + groups.ReadWrite + ";",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT ALL ON TABLES TO " + groups.Admin + ";",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT ALL ON SEQUENCES TO " + groups.Admin + ";",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT EXECUTE ON FUNCTIONS TO " + groups.Admin + ";",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT USAGE ON TYPES TO " + groups.Admin + ";",
+		"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO auditor;",
+	} {
+		if !slices.Contains(defaultPrivileges, want) {
+			t.Errorf("missing default privilege %q in %q", want, defaultPrivileges)
+		}
+	}
+
+	unwanted := "ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT UPDATE ON SEQUENCES TO " + groups.ReadWrite + ";"
+	if slices.Contains(defaultPrivileges, unwanted) {
+		t.Errorf("unexpected default privilege %q", unwanted)
+	}
+}
@@ -0,0 +1,142 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Label string `json:"label"`
+}
+
+// TenantGraph is the access model of a tenant schema as it is in the
+// catalog: users point to the groups they are members of, groups and the
+// owner point to the schema and database they have privileges on.
+type TenantGraph struct {
+	Database string      `json:"database"`
+	Schema   string      `json:"schema"`
+	Edges    []GraphEdge `json:"edges"`
+}
+
+func (pg *Postgres) TenantGraph(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (graph TenantGraph, err error) {
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+	tenantGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	groups := []string{tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly}
+
+	graph.Database = dbName
+	graph.Schema = schemaName
+
+	rows, err := pg.db.Query(ctx,
+		`SELECT u.rolname, g.rolname FROM pg_auth_members m
+JOIN pg_roles u ON u.oid = m.member
+JOIN pg_roles g ON g.oid = m.roleid
+WHERE g.rolname = ANY($1)
+ORDER BY g.rolname, u.rolname;`,
+		append(groups, ownerRole),
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list memberships: %w", err)
+		return
+	}
+
+	for rows.Next() {
+		var edge GraphEdge
+		err = rows.Scan(&edge.From, &edge.To)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		edge.Label = "member"
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		for _, role := range append([]string{ownerRole}, groups...) {
+			var dbPrivileges, schemaPrivileges []string
+			err = conn.QueryRow(ctx,
+				`SELECT
+	array_remove(ARRAY[
+		CASE WHEN d.datdba = r.oid THEN 'OWNER' END,
+		CASE WHEN has_database_privilege(r.oid, d.oid, 'CONNECT') THEN 'CONNECT' END,
+		CASE WHEN has_database_privilege(r.oid, d.oid, 'CREATE') THEN 'CREATE' END,
+		CASE WHEN has_database_privilege(r.oid, d.oid, 'TEMPORARY') THEN 'TEMPORARY' END
+	], NULL),
+	array_remove(ARRAY[
+		CASE WHEN n.nspowner = r.oid THEN 'OWNER' END,
+		CASE WHEN has_schema_privilege(r.oid, n.oid, 'USAGE') THEN 'USAGE' END,
+		CASE WHEN has_schema_privilege(r.oid, n.oid, 'CREATE') THEN 'CREATE' END
+	], NULL)
+FROM pg_roles r, pg_database d, pg_namespace n
+WHERE r.rolname = $1 AND d.datname = current_database() AND n.nspname = $2;`,
+				role, schemaName,
+			).Scan(&dbPrivileges, &schemaPrivileges)
+			if err != nil {
+				err = fmt.Errorf("unable to get privileges of %s: %w", role, err)
+				return
+			}
+
+			if len(dbPrivileges) > 0 {
+				graph.Edges = append(graph.Edges, GraphEdge{From: role, To: "database " + dbName, Label: strings.Join(dbPrivileges, ", ")})
+			}
+
+			if len(schemaPrivileges) > 0 {
+				graph.Edges = append(graph.Edges, GraphEdge{From: role, To: "schema " + schemaName, Label: strings.Join(schemaPrivileges, ", ")})
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+func (g TenantGraph) DOT() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %q {\n", g.Database+"."+g.Schema)
+	fmt.Fprintf(&b, "  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  %q [shape=cylinder];\n", "database "+g.Database)
+	fmt.Fprintf(&b, "  %q [shape=folder];\n", "schema "+g.Schema)
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", e.From, e.To, e.Label)
+	}
+
+	fmt.Fprintf(&b, "}\n")
+
+	return b.String()
+}
+
+func (g TenantGraph) Mermaid() string {
+	var b strings.Builder
+
+	// mermaid node ids can't contain spaces or dots
+	id := func(name string) string {
+		return strings.NewReplacer(" ", "_", ".", "_", "-", "_").Replace(name)
+	}
+
+	fmt.Fprintf(&b, "graph LR\n")
+	fmt.Fprintf(&b, "  %s[(%s)]\n", id("database "+g.Database), "database "+g.Database)
+	fmt.Fprintf(&b, "  %s[/%s/]\n", id("schema "+g.Schema), "schema "+g.Schema)
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", id(e.From), e.Label, id(e.To))
+	}
+
+	return b.String()
+}
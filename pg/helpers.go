@@ -1,19 +1,111 @@
 package pg
 
 import (
-	"crypto/rand"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"math/big"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
+var passwordLiteral = regexp.MustCompile(`(?i)PASSWORD\s+'[^']*'`)
+
+// PostgreSQL silently truncates identifiers to 63 bytes, so two long tenant
+// and schema combinations could end up with the same role names. Names that
+// would not fit are cut short and get a stable hash of the full name instead.
+func fitIdentifier(name string, maxLen int) string {
+	if len(name) <= maxLen {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := "_" + hex.EncodeToString(sum[:])[:shortHashLen]
+	short := name[:maxLen-len(hash)] + hash
+
+	verbosef("role name prefix %s shortened to %s\n", name, short)
+
+	return short
+}
+
+// withShortenedFrom adds the full name behind a shortened role name to the
+// role's comment, keeping the rest of it, e.g. the rotation history
+func withShortenedFrom(comment string, name string) string {
+	line := shortenedFromComment + "=" + name
+	for _, l := range strings.Split(comment, "\n") {
+		if l == line {
+			return comment
+		}
+	}
+
+	if comment == "" {
+		return line
+	}
+	return line + "\n" + comment
+}
+
+// recordShortenedName keeps the full name of a role whose name had to be
+// shortened in its comment, since the name only has a hash of it
+func (pg *Postgres) recordShortenedName(ctx context.Context, roleName string, name string, maxLen int) (err error) {
+	if len(name) <= maxLen {
+		return
+	}
+
+	var comment string
+	err = pg.db.QueryRow(ctx,
+		"SELECT coalesce((SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1), '');",
+		roleName,
+	).Scan(&comment)
+	if err != nil {
+		err = fmt.Errorf("unable to read comment of %s: %w", roleName, err)
+		return
+	}
+
+	updated := withShortenedFrom(comment, name)
+	if updated == comment {
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("COMMENT ON ROLE %s IS '%s';", roleName, strings.ReplaceAll(updated, "'", "''")))
+	if err != nil {
+		err = fmt.Errorf("unable to record the full name of %s: %w", roleName, err)
+	}
+	return
+}
+
+// recordShortenedOwnerName is recordShortenedName for the owner role
+func (pg *Postgres) recordShortenedOwnerName(ctx context.Context, roleNamePrefix string) error {
+	return pg.recordShortenedName(ctx, tenantOwnerName(roleNamePrefix), roleNamePrefix, maxIdentifierLen-len(ownerSuffix))
+}
+
+// recordShortenedGroupNames is recordShortenedName for the groups of a
+// tenant schema; users are found through their group
+func (pg *Postgres) recordShortenedGroupNames(ctx context.Context, roleNamePrefix string, schemaName string) error {
+	name := fmt.Sprintf("%s_%s", roleNamePrefix, schemaName)
+	groups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+
+	for _, groupname := range []string{groups.Admin, groups.ReadWrite, groups.ReadOnly} {
+		err := pg.recordShortenedName(ctx, groupname, name, maxIdentifierLen-maxRoleSuffixLen)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func tenantOwnerName(roleNamePrefix string) string {
-	return fmt.Sprintf("%s%s", roleNamePrefix, ownerSuffix)
+	return fmt.Sprintf("%s%s", fitIdentifier(roleNamePrefix, maxIdentifierLen-len(ownerSuffix)), ownerSuffix)
 }
 
+// the prefix leaves room for the longest role suffix, e.g. _schadm_usr_alt
 func tenantSchemaPrefix(roleNamePrefix string, schemaName string) string {
-	return fmt.Sprintf("%s_%s", roleNamePrefix, schemaName)
+	return fitIdentifier(fmt.Sprintf("%s_%s", roleNamePrefix, schemaName), maxIdentifierLen-maxRoleSuffixLen)
 }
 
 func tenantSchemaGroupNames(roleNamePrefix string, schemaName string) SchemaGroups {
@@ -34,13 +126,13 @@ func newTenantSchemaUserCredentials(roleNamePrefix string, schemaName string) Sc
 	tenantSchemaPrefix := tenantSchemaPrefix(roleNamePrefix, schemaName)
 
 	adminUsername := fmt.Sprintf("%s%s%s", tenantSchemaPrefix, schemaAdminSuffix, userSuffix)
-	adminPassword, _ := GenerateRandomPassword(PasswordConfig{})
+	adminPassword, _ := initialPassword()
 
 	rwUsername := fmt.Sprintf("%s%s%s", tenantSchemaPrefix, rwSuffix, userSuffix)
-	rwPassword, _ := GenerateRandomPassword(PasswordConfig{})
+	rwPassword, _ := initialPassword()
 
 	roUsername := fmt.Sprintf("%s%s%s", tenantSchemaPrefix, roSuffix, userSuffix)
-	roPassword, _ := GenerateRandomPassword(PasswordConfig{})
+	roPassword, _ := initialPassword()
 
 	admin := UserCredentials{
 		Username: adminUsername,
@@ -64,71 +156,264 @@ func newTenantSchemaUserCredentials(roleNamePrefix string, schemaName string) Sc
 	}
 }
 
-func GenerateRandomPassword(config PasswordConfig) (string, error) {
-	const (
-		letters       = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-		numbers       = "0123456789"
-		specialChars  = "!#$%^&*()-_=+[]{}|;:,.<>?~`"
-		defaultLength = 32
-	)
+func tenantSchemaRoleNames(roleNamePrefix string, schemaName string, role string) (username string, groupname string, err error) {
+	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
 
-	var charset string
+	switch role {
+	case roleAdmin:
+		return schemaUsers.Admin.Username, schemaGroups.Admin, nil
+	case roleReadWrite:
+		return schemaUsers.ReadWrite.Username, schemaGroups.ReadWrite, nil
+	case roleReadOnly:
+		return schemaUsers.ReadOnly.Username, schemaGroups.ReadOnly, nil
+	}
+
+	err = fmt.Errorf("unknown role %q, must be one of %s, %s, %s", role, roleAdmin, roleReadWrite, roleReadOnly)
+	return
+}
 
-	if config.UseLetters {
-		charset += letters
+func credentialsStdout() bool {
+	return os.Getenv(envVarCredsStdout) != ""
+}
+
+func splitCredentials() bool {
+	return os.Getenv(envVarSplitCreds) != ""
+}
+
+// creds.json becomes creds.admin.json, creds.readwrite.json and creds.readonly.json
+func splitCredentialsFileName(filename string, role string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(filename, ext), role, ext)
+}
+
+// CredentialsFiles lists the files credentials may be written to for a
+// credentials file: the file itself and, with split credentials, the file of
+// each schema role next to it.
+func CredentialsFiles(filename string) []string {
+	files := []string{filename}
+	if splitCredentials() {
+		for _, role := range []string{roleAdmin, roleReadWrite, roleReadOnly, roleCDC} {
+			files = append(files, splitCredentialsFileName(filename, role))
+		}
 	}
+	return files
+}
 
-	if config.UseNum {
-		charset += numbers
+func splitSchemaCredentials(credentials any) (split []roleCredentials, ok bool) {
+	switch users := credentials.(type) {
+	case SchemaUsers:
+		split = []roleCredentials{
+			{roleAdmin, users.Admin},
+			{roleReadWrite, users.ReadWrite},
+			{roleReadOnly, users.ReadOnly},
+		}
+		if users.CDC != nil {
+			split = append(split, roleCredentials{roleCDC, *users.CDC})
+		}
+	case DualSchemaUsers:
+		split = []roleCredentials{
+			{roleAdmin, users.Admin},
+			{roleReadWrite, users.ReadWrite},
+			{roleReadOnly, users.ReadOnly},
+		}
+		if users.CDC != nil {
+			split = append(split, roleCredentials{roleCDC, *users.CDC})
+		}
+	default:
+		return nil, false
+	}
+
+	return split, true
+}
+
+func writeRoleCredentials(filename string, role string, creds any) {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to marshal %s credentials: %v\n", role, err)
+		return
 	}
 
-	if config.UseSpecial {
-		charset += specialChars
+	err = writeFileAtomic(splitCredentialsFileName(filename, role), data, outFileMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write %s credentials: %v\n", role, err)
+	}
+}
+
+func outputCredentials(credentials any) {
+	outCredsFile := os.Getenv(envVarOutCredsFile)
+
+	// dry-run passwords are never set on any role
+	if dryRun() {
+		return
 	}
 
-	if config.ExcludeSpecial != "" {
-		for _, char := range config.ExcludeSpecial {
-			charset = strings.ReplaceAll(charset, string(char), "")
+	if noCredentialsOutput() {
+		outputUsernames(credentials)
+		return
+	}
+
+	if outCredsFile == "" && !credentialsStdout() {
+		return
+	}
+
+	if split, ok := splitSchemaCredentials(credentials); ok && outCredsFile != "" && splitCredentials() && !credentialsStdout() {
+		for _, rc := range split {
+			writeRoleCredentials(outCredsFile, rc.role, rc.creds)
 		}
+		return
 	}
 
-	if charset == "" {
-		charset += letters
-		charset += numbers
+	credentialsData, err := json.Marshal(credentials)
+	if err != nil {
+		err = fmt.Errorf("unable to marshal tenant users data: %w", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
 	}
 
-	if config.Length == 0 {
-		config.Length = defaultLength
+	// stdout mode never touches the disk
+	if credentialsStdout() {
+		fmt.Fprintf(os.Stdout, "%s\n", credentialsData)
+		return
 	}
 
-	password := make([]byte, config.Length)
-	for i := range password {
-		randomIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		if err != nil {
-			return "", fmt.Errorf("unable to generate random index: %w", err)
+	err = writeFileAtomic(outCredsFile, credentialsData, outFileMode)
+	if err != nil {
+		err = fmt.Errorf("unable to write tenant users data: %w", err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+// outputUsernames prints the credentials to stdout with the passwords left
+// out, for flows where passwords are set later from a secure enclave
+func outputUsernames(credentials any) {
+	usernames, err := withholdPasswords(credentials)
+	if err == nil {
+		var usernamesData []byte
+		usernamesData, err = json.Marshal(usernames)
+		if err == nil {
+			fmt.Fprintf(os.Stdout, "%s\n", usernamesData)
+			return
 		}
-		password[i] = charset[randomIndex.Int64()]
 	}
 
-	return string(password), nil
+	fmt.Fprintf(os.Stderr, "unable to marshal tenant users data: %v\n", err)
 }
 
-func appendToFile(filename string, content string) {
-	f, err := os.OpenFile(filename,
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, outFileMode)
+// withholdPasswords returns the JSON form of credentials without any password
+func withholdPasswords(credentials any) (usernames any, err error) {
+	credentialsData, err := json.Marshal(credentials)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
 	}
 
-	defer f.Close()
+	err = json.Unmarshal(credentialsData, &usernames)
+	if err != nil {
+		return
+	}
 
-	if _, err := f.WriteString(content); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+	return dropPasswords(usernames), nil
+}
+
+func dropPasswords(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		delete(v, "password")
+		for k, child := range v {
+			v[k] = dropPasswords(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = dropPasswords(child)
+		}
+	}
+	return v
+}
+
+func outputRoleCredentials(role string, creds any) {
+	outCredsFile := os.Getenv(envVarOutCredsFile)
+
+	if dryRun() {
+		return
+	}
+
+	if outCredsFile != "" && splitCredentials() && !credentialsStdout() && !noCredentialsOutput() {
+		writeRoleCredentials(outCredsFile, role, creds)
+		return
+	}
+
+	outputCredentials(creds)
+}
+
+func noCredentialsOutput() bool {
+	return os.Getenv(envVarNoCreds) != ""
+}
+
+func dualUsers() bool {
+	return os.Getenv(envVarDualUsers) != ""
+}
+
+func dryRun() bool {
+	return os.Getenv(envVarDryRun) != ""
+}
+
+func quiet() bool {
+	return os.Getenv(envVarQuiet) != ""
+}
+
+func verbose() bool {
+	return os.Getenv(envVarVerbose) != "" && !quiet()
+}
+
+// informational messages, silenced by quiet mode
+func logf(format string, a ...any) {
+	if !quiet() {
+		fmt.Fprintf(os.Stderr, format, a...)
 	}
 }
 
-func truncateFile(filename string) {
-	if err := os.Truncate(filename, 0); err != nil {
-		fmt.Fprintf(os.Stderr, "failed: %v\n", err)
+// warnings are printed even in quiet mode
+func warnf(format string, a ...any) {
+	fmt.Fprintf(os.Stderr, "warning: "+format, a...)
+}
+
+func verbosef(format string, a ...any) {
+	if verbose() {
+		fmt.Fprintf(os.Stderr, format, a...)
 	}
 }
+
+func redactSQL(sql string) string {
+	return passwordLiteral.ReplaceAllString(sql, "PASSWORD '********'")
+}
+
+// Timeouts already present in the connection string take precedence, so that
+// a blocked DROP SCHEMA ... CASCADE fails fast instead of hanging.
+func setSessionTimeouts(connConfig *pgx.ConnConfig) {
+	timeouts := map[string]string{
+		"lock_timeout":      defaultLockTimeout,
+		"statement_timeout": defaultStmtTimeout,
+	}
+
+	if v := os.Getenv(envVarLockTimeout); v != "" {
+		timeouts["lock_timeout"] = v
+	}
+
+	if v := os.Getenv(envVarStmtTimeout); v != "" {
+		timeouts["statement_timeout"] = v
+	}
+
+	for param, value := range timeouts {
+		if _, ok := connConfig.RuntimeParams[param]; !ok {
+			connConfig.RuntimeParams[param] = value
+		}
+	}
+}
+
+func TenantOwnerName(tenantName string) string {
+	return tenantOwnerName(tenantName)
+}
+
+func TenantSchemaGroupNames(tenantName string, schemaName string) SchemaGroups {
+	return tenantSchemaGroupNames(tenantName, schemaName)
+}
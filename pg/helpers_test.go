@@ -0,0 +1,118 @@
+package pg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTenantSchemaGroupNamesFitIdentifiers(t *testing.T) {
+	long := strings.Repeat("t", 40)
+
+	tests := []struct {
+		name           string
+		roleNamePrefix string
+		schemaName     string
+		wantAdmin      string
+	}{
+		{"short", "acme", "app", "acme_app_schadm_grp"},
+		{"longest that fits", long, "billing", long + "_billing_schadm_grp"},
+		{"shortened", long, "billing_archive", strings.Repeat("t", 39) + "_b2c4b338_schadm_grp"},
+	}
+
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := tenantSchemaGroupNames(tt.roleNamePrefix, tt.schemaName)
+
+			if groups.Admin != tt.wantAdmin {
+				t.Errorf("admin group = %q, want %q", groups.Admin, tt.wantAdmin)
+			}
+
+			prefix := tenantSchemaPrefix(tt.roleNamePrefix, tt.schemaName)
+			if len(prefix)+maxRoleSuffixLen > maxIdentifierLen {
+				t.Errorf("prefix %q leaves no room for the role suffixes", prefix)
+			}
+
+			for _, name := range []string{groups.Admin, groups.ReadWrite, groups.ReadOnly, tenantOwnerName(tt.roleNamePrefix)} {
+				if len(name) > maxIdentifierLen {
+					t.Errorf("%q is longer than %d characters", name, maxIdentifierLen)
+				}
+			}
+
+			if again := tenantSchemaGroupNames(tt.roleNamePrefix, tt.schemaName); again != groups {
+				t.Errorf("names are not stable: %v, then %v", groups, again)
+			}
+
+			if other, ok := seen[groups.Admin]; ok {
+				t.Errorf("%q is also the admin group of %s", groups.Admin, other)
+			}
+			seen[groups.Admin] = tt.name
+		})
+	}
+}
+
+func TestFitIdentifier(t *testing.T) {
+	name := strings.Repeat("a", 70)
+
+	got := fitIdentifier(name, maxIdentifierLen)
+	if len(got) != maxIdentifierLen {
+		t.Fatalf("len(fitIdentifier()) = %d, want %d", len(got), maxIdentifierLen)
+	}
+
+	cut, hash, ok := strings.Cut(got[maxIdentifierLen-shortHashLen-1:], "_")
+	if !ok || cut != "" || len(hash) != shortHashLen {
+		t.Errorf("fitIdentifier() = %q, want a _<%d hex digits> suffix", got, shortHashLen)
+	}
+
+	if fitIdentifier(name[:60], maxIdentifierLen) != name[:60] {
+		t.Errorf("names that fit are changed")
+	}
+}
+
+func TestTenantOwnerNameFitsIdentifier(t *testing.T) {
+	if got, want := tenantOwnerName("acme"), "acme_owner"; got != want {
+		t.Errorf("tenantOwnerName() = %q, want %q", got, want)
+	}
+
+	if got, want := tenantOwnerName(strings.Repeat("t", 70)), strings.Repeat("t", 48)+"_a75c6749_owner"; got != want {
+		t.Errorf("tenantOwnerName() = %q, want %q", got, want)
+	}
+}
+
+func TestWithShortenedFrom(t *testing.T) {
+	name := strings.Repeat("t", 40) + "_billing_archive"
+	line := shortenedFromComment + "=" + name
+	rotation := rotatedAtComment + "=2026-01-02T03:04:05Z by=ci user=u"
+
+	tests := []struct {
+		name    string
+		comment string
+		want    string
+	}{
+		{"no comment", "", line},
+		{"rotation history", rotation, line + "\n" + rotation},
+		{"already recorded", line + "\n" + rotation, line + "\n" + rotation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withShortenedFrom(tt.comment, name); got != tt.want {
+				t.Errorf("withShortenedFrom(%q) = %q, want %q", tt.comment, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsFiles(t *testing.T) {
+	if got, want := CredentialsFiles("out/creds.json"), []string{"out/creds.json"}; !slices.Equal(got, want) {
+		t.Errorf("CredentialsFiles() = %v, want %v", got, want)
+	}
+
+	t.Setenv(envVarSplitCreds, "true")
+
+	want := []string{"out/creds.json", "out/creds.admin.json", "out/creds.readwrite.json", "out/creds.readonly.json", "out/creds.cdc.json"}
+	if got := CredentialsFiles("out/creds.json"); !slices.Equal(got, want) {
+		t.Errorf("CredentialsFiles() with split credentials = %v, want %v", got, want)
+	}
+}
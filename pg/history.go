@@ -0,0 +1,143 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RotationEvent is a password rotation of a tenant schema user.
+type RotationEvent struct {
+	SchemaName string    `json:"schema"`
+	Role       string    `json:"role"`
+	Username   string    `json:"username"`
+	RotatedAt  time.Time `json:"rotatedAt"`
+	RotatedBy  string    `json:"rotatedBy"`
+}
+
+// There is no registry to record rotations in, so each schema group keeps the
+// latest rotations of its users in its comment, one per line, after whatever
+// else the comment holds. Rotated users can be renamed or replaced, the group
+// stays. Older rotations are dropped: this is a recent history, not an audit
+// trail.
+const maxRotationHistory = 20
+
+func rotationLine(event RotationEvent) string {
+	return fmt.Sprintf("%s=%s by=%s user=%s",
+		rotatedAtComment, event.RotatedAt.UTC().Format(time.RFC3339), url.QueryEscape(event.RotatedBy), event.Username)
+}
+
+func parseRotationLine(line string) (event RotationEvent, ok bool) {
+	for _, field := range strings.Fields(line) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case rotatedAtComment:
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return
+			}
+			event.RotatedAt = t
+			ok = true
+		case "by":
+			event.RotatedBy, _ = url.QueryUnescape(value)
+		case "user":
+			event.Username = value
+		}
+	}
+	return
+}
+
+// appendRotation adds a rotation line to a group comment, keeping the other
+// content of the comment and only the latest rotations
+func appendRotation(comment string, rotation string) string {
+	var other, rotations []string
+	for _, line := range strings.Split(comment, "\n") {
+		if _, ok := parseRotationLine(line); ok {
+			rotations = append(rotations, line)
+		} else if line != "" {
+			other = append(other, line)
+		}
+	}
+
+	rotations = append(rotations, rotation)
+	if len(rotations) > maxRotationHistory {
+		rotations = rotations[len(rotations)-maxRotationHistory:]
+	}
+
+	return strings.Join(append(other, rotations...), "\n")
+}
+
+// recordRotation adds a rotation to the history in the group's comment. The
+// password is already rotated, so failing to record it is only a warning.
+func (pg *Postgres) recordRotation(ctx context.Context, groupname string, username string) {
+	var comment, rotatedBy string
+	err := pg.db.QueryRow(ctx,
+		`SELECT coalesce(shobj_description(oid, 'pg_authid'), ''), coalesce(nullif(current_setting('app.operator', true), ''), session_user)
+FROM pg_roles WHERE rolname = $1;`,
+		groupname,
+	).Scan(&comment, &rotatedBy)
+	if err != nil {
+		warnf("unable to record rotation of %s: %v\n", username, err)
+		return
+	}
+
+	comment = appendRotation(comment, rotationLine(RotationEvent{
+		Username:  username,
+		RotatedAt: time.Now(),
+		RotatedBy: rotatedBy,
+	}))
+
+	_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("COMMENT ON ROLE %s IS '%s';", groupname, strings.ReplaceAll(comment, "'", "''")))
+	if err != nil {
+		warnf("unable to record rotation of %s: %v\n", username, err)
+	}
+}
+
+// RotationHistory lists the recorded password rotations of a tenant schema's
+// users, oldest first.
+func (pg *Postgres) RotationHistory(ctx context.Context, schemaName string, tenantName string, dbName string) (events []RotationEvent, err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+
+	for _, group := range []struct {
+		role string
+		name string
+	}{
+		{roleAdmin, schemaGroups.Admin},
+		{roleReadWrite, schemaGroups.ReadWrite},
+		{roleReadOnly, schemaGroups.ReadOnly},
+	} {
+		var comment string
+		err = pg.db.QueryRow(ctx,
+			"SELECT coalesce((SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1), '');",
+			group.name,
+		).Scan(&comment)
+		if err != nil {
+			err = fmt.Errorf("unable to read rotation history of %s: %w", group.name, err)
+			return
+		}
+
+		for _, line := range strings.Split(comment, "\n") {
+			event, ok := parseRotationLine(line)
+			if !ok {
+				continue
+			}
+			event.SchemaName = schemaName
+			event.Role = group.role
+			events = append(events, event)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].RotatedAt.Before(events[j].RotatedAt)
+	})
+
+	return
+}
@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendRotationKeepsOtherContent(t *testing.T) {
+	rotatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var comment strings.Builder
+	comment.WriteString("owned by the billing team\ncontact: ops@example.com")
+	for i := range maxRotationHistory {
+		comment.WriteString("\n" + rotationLine(RotationEvent{
+			Username:  fmt.Sprintf("user%d", i),
+			RotatedAt: rotatedAt,
+			RotatedBy: "ci",
+		}))
+	}
+
+	latest := rotationLine(RotationEvent{Username: "latest", RotatedAt: rotatedAt, RotatedBy: "ci"})
+	lines := strings.Split(appendRotation(comment.String(), latest), "\n")
+
+	if lines[0] != "owned by the billing team" || lines[1] != "contact: ops@example.com" {
+		t.Errorf("other comment content not kept: %q", lines[:2])
+	}
+
+	if got := len(lines) - 2; got != maxRotationHistory {
+		t.Errorf("kept %d rotations, want %d", got, maxRotationHistory)
+	}
+
+	if strings.Contains(strings.Join(lines, "\n"), "user=user0") {
+		t.Errorf("oldest rotation not dropped")
+	}
+
+	if lines[len(lines)-1] != latest {
+		t.Errorf("last line = %q, want %q", lines[len(lines)-1], latest)
+	}
+}
+
+func TestParseRotationLine(t *testing.T) {
+	rotatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		line   string
+		want   RotationEvent
+		wantOk bool
+	}{
+		{
+			name:   "rotation",
+			line:   rotatedAtComment + "=2026-01-02T03:04:05Z by=ci user=acme_app_rw_usr",
+			want:   RotationEvent{RotatedAt: rotatedAt, RotatedBy: "ci", Username: "acme_app_rw_usr"},
+			wantOk: true,
+		},
+		{
+			name:   "escaped operator",
+			line:   rotationLine(RotationEvent{RotatedAt: rotatedAt, RotatedBy: "Jane Doe <jane@example.com>", Username: "u"}),
+			want:   RotationEvent{RotatedAt: rotatedAt, RotatedBy: "Jane Doe <jane@example.com>", Username: "u"},
+			wantOk: true,
+		},
+		{
+			name: "other comment",
+			line: "owned by the billing team",
+		},
+		{
+			name: "bad timestamp",
+			line: rotatedAtComment + "=yesterday by=ci user=u",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRotationLine(tt.line)
+			if ok != tt.wantOk {
+				t.Fatalf("parseRotationLine(%q) ok = %t, want %t", tt.line, ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseRotationLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
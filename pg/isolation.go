@@ -0,0 +1,304 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type IsolationViolation struct {
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"`
+	// Target is the tenant whose database or schema the role can reach
+	Target    string `json:"target"`
+	Database  string `json:"database"`
+	Schema    string `json:"schema,omitempty"`
+	Privilege string `json:"privilege"`
+	// Via is direct, PUBLIC, superuser, or the roles holding the privilege
+	// that the role is a member of, possibly through a chain of memberships
+	Via string `json:"via"`
+}
+
+type tenantSchema struct {
+	dbName     string
+	schemaName string
+	tenant     string
+}
+
+// ScanIsolation checks every managed role for privileges on the databases and
+// schemas of other tenants, and for memberships in their roles. Tenants are
+// told apart by their owner roles: the schemas a tenant owner owns, in any
+// database, are the tenant's, and their managed roles are derived from the
+// owner role name. Tenants whose names were shortened to fit get other role
+// names and are missed.
+func (pg *Postgres) ScanIsolation(ctx context.Context) (violations []IsolationViolation, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT d.datname, r.rolname FROM pg_database d
+JOIN pg_roles r ON r.oid = d.datdba
+WHERE d.datallowconn AND r.rolname LIKE $1
+ORDER BY d.datname;`,
+		`%`+strings.ReplaceAll(ownerSuffix, "_", `\_`),
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list tenant databases: %w", err)
+		return
+	}
+
+	// the tenant each managed role belongs to, and the tenants with schemas
+	// in each database, which shared databases have several of
+	roleTenants := map[string]string{}
+	dbTenants := map[string]map[string]bool{}
+
+	var dbNames []string
+	for rows.Next() {
+		var dbName, owner string
+		err = rows.Scan(&dbName, &owner)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		if !inNamespace(dbName) {
+			continue
+		}
+
+		tenant := strings.TrimSuffix(owner, ownerSuffix)
+		roleTenants[owner] = tenant
+		dbTenants[dbName] = map[string]bool{tenant: true}
+		dbNames = append(dbNames, dbName)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("unable to list tenant databases: %w", err)
+		return
+	}
+
+	var schemas []tenantSchema
+	for _, dbName := range dbNames {
+		err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+			rows, err := conn.Query(ctx,
+				`SELECT n.nspname, r.rolname FROM pg_namespace n
+JOIN pg_roles r ON r.oid = n.nspowner
+WHERE r.rolname LIKE $1
+ORDER BY n.nspname;`,
+				`%`+strings.ReplaceAll(ownerSuffix, "_", `\_`),
+			)
+			if err != nil {
+				return
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				s := tenantSchema{dbName: dbName}
+				var owner string
+				err = rows.Scan(&s.schemaName, &owner)
+				if err != nil {
+					return
+				}
+				s.tenant = strings.TrimSuffix(owner, ownerSuffix)
+				schemas = append(schemas, s)
+			}
+
+			return rows.Err()
+		})
+
+		if err != nil {
+			err = fmt.Errorf("unable to list tenant schemas of database %s: %w", dbName, err)
+			return
+		}
+	}
+
+	for _, s := range schemas {
+		roleTenants[tenantOwnerName(s.tenant)] = s.tenant
+		for _, roleName := range managedRoleNames(s.tenant, s.schemaName) {
+			roleTenants[roleName] = s.tenant
+		}
+
+		dbTenants[s.dbName][s.tenant] = true
+	}
+
+	var roleNames []string
+	for roleName := range roleTenants {
+		roleNames = append(roleNames, roleName)
+	}
+	sort.Strings(roleNames)
+
+	memberships, err := pg.scanMemberships(ctx, roleNames, roleTenants)
+	if err != nil {
+		return
+	}
+	violations = append(violations, memberships...)
+
+	databases, err := pg.scanDatabasePrivileges(ctx, dbNames, roleNames, roleTenants, dbTenants)
+	if err != nil {
+		return
+	}
+	violations = append(violations, databases...)
+
+	for _, dbName := range dbNames {
+		var schemaViolations []IsolationViolation
+		schemaViolations, err = pg.scanSchemaPrivileges(ctx, dbName, roleNames, roleTenants)
+		if err != nil {
+			return
+		}
+		violations = append(violations, schemaViolations...)
+	}
+
+	return
+}
+
+func (pg *Postgres) scanMemberships(ctx context.Context, roleNames []string, roleTenants map[string]string) (violations []IsolationViolation, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT r.rolname, g.rolname FROM pg_roles r, pg_roles g
+WHERE r.rolname = ANY($1) AND g.rolname = ANY($1) AND r.oid <> g.oid
+AND pg_has_role(r.oid, g.oid, 'MEMBER')
+ORDER BY r.rolname, g.rolname;`,
+		roleNames,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to scan role memberships: %w", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roleName, groupName string
+		err = rows.Scan(&roleName, &groupName)
+		if err != nil {
+			return
+		}
+
+		if roleTenants[roleName] == roleTenants[groupName] {
+			continue
+		}
+
+		violations = append(violations, IsolationViolation{
+			Role:      roleName,
+			Tenant:    roleTenants[roleName],
+			Target:    roleTenants[groupName],
+			Privilege: "MEMBER",
+			Via:       groupName,
+		})
+	}
+
+	return violations, rows.Err()
+}
+
+// scanDatabasePrivileges finds roles with privileges on databases none of
+// their tenant's schemas are in. A NULL ACL is the default, which grants
+// CONNECT and TEMPORARY to PUBLIC.
+func (pg *Postgres) scanDatabasePrivileges(ctx context.Context, dbNames []string, roleNames []string, roleTenants map[string]string, dbTenants map[string]map[string]bool) (violations []IsolationViolation, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT r.rolname, d.datname, p.privilege,
+	CASE
+		WHEN r.rolsuper THEN 'superuser'
+		WHEN EXISTS (SELECT 1 FROM aclexplode(d.datacl) a WHERE a.grantee = r.oid AND a.privilege_type = p.privilege) THEN 'direct'
+		WHEN d.datacl IS NULL AND p.privilege <> 'CREATE' THEN 'PUBLIC'
+		WHEN EXISTS (SELECT 1 FROM aclexplode(d.datacl) a WHERE a.grantee = 0 AND a.privilege_type = p.privilege) THEN 'PUBLIC'
+		ELSE (SELECT string_agg(g.rolname, ' ' ORDER BY g.rolname) FROM aclexplode(d.datacl) a JOIN pg_roles g ON g.oid = a.grantee
+			WHERE a.privilege_type = p.privilege AND g.oid <> r.oid AND pg_has_role(r.oid, g.oid, 'USAGE'))
+	END
+FROM pg_roles r, pg_database d, unnest(ARRAY['CONNECT', 'CREATE', 'TEMPORARY']) AS p(privilege)
+WHERE r.rolname = ANY($1) AND d.datname = ANY($2)
+AND has_database_privilege(r.oid, d.oid, p.privilege)
+ORDER BY d.datname, r.rolname, p.privilege;`,
+		roleNames, dbNames,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to scan database privileges: %w", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v IsolationViolation
+		var via *string
+		err = rows.Scan(&v.Role, &v.Database, &v.Privilege, &via)
+		if err != nil {
+			return
+		}
+
+		v.Tenant = roleTenants[v.Role]
+		if dbTenants[v.Database][v.Tenant] {
+			continue
+		}
+
+		v.Target = strings.Join(sortedTenants(dbTenants[v.Database]), " ")
+		if via != nil {
+			v.Via = *via
+		}
+
+		violations = append(violations, v)
+	}
+
+	return violations, rows.Err()
+}
+
+func sortedTenants(tenants map[string]bool) (names []string) {
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// scanSchemaPrivileges finds roles with privileges on the schemas of other
+// tenants in one database. A NULL ACL is the default, which grants nothing
+// to PUBLIC.
+func (pg *Postgres) scanSchemaPrivileges(ctx context.Context, dbName string, roleNames []string, roleTenants map[string]string) (violations []IsolationViolation, err error) {
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		rows, err := conn.Query(ctx,
+			`SELECT r.rolname, n.nspname, o.rolname, p.privilege,
+	CASE
+		WHEN r.rolsuper THEN 'superuser'
+		WHEN EXISTS (SELECT 1 FROM aclexplode(n.nspacl) a WHERE a.grantee = r.oid AND a.privilege_type = p.privilege) THEN 'direct'
+		WHEN EXISTS (SELECT 1 FROM aclexplode(n.nspacl) a WHERE a.grantee = 0 AND a.privilege_type = p.privilege) THEN 'PUBLIC'
+		ELSE (SELECT string_agg(g.rolname, ' ' ORDER BY g.rolname) FROM pg_roles g
+			WHERE g.oid <> r.oid AND pg_has_role(r.oid, g.oid, 'USAGE')
+			AND (g.oid = n.nspowner OR EXISTS (SELECT 1 FROM aclexplode(n.nspacl) a WHERE a.grantee = g.oid AND a.privilege_type = p.privilege)))
+	END
+FROM pg_roles r, pg_namespace n
+JOIN pg_roles o ON o.oid = n.nspowner, unnest(ARRAY['USAGE', 'CREATE']) AS p(privilege)
+WHERE r.rolname = ANY($1) AND o.rolname LIKE $2
+AND has_schema_privilege(r.oid, n.oid, p.privilege)
+ORDER BY n.nspname, r.rolname, p.privilege;`,
+			roleNames, `%`+strings.ReplaceAll(ownerSuffix, "_", `\_`),
+		)
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			v := IsolationViolation{Database: dbName}
+			var owner string
+			var via *string
+			err = rows.Scan(&v.Role, &v.Schema, &owner, &v.Privilege, &via)
+			if err != nil {
+				return
+			}
+
+			v.Tenant = roleTenants[v.Role]
+			v.Target = strings.TrimSuffix(owner, ownerSuffix)
+			if v.Tenant == v.Target {
+				continue
+			}
+
+			if via != nil {
+				v.Via = *via
+			}
+
+			violations = append(violations, v)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to scan schema privileges in database %s: %w", dbName, err)
+	}
+
+	return
+}
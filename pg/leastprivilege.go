@@ -0,0 +1,19 @@
+package pg
+
+import "os"
+
+// Least-privilege mode runs under a control role with CREATEDB, CREATEROLE and
+// pg_signal_backend, as created by bootstrap. Everything the tool generates
+// works under such a role once it is a member of the roles it creates, which
+// bootstrap arranges through createrole_self_grant on PostgreSQL 16 and
+// later, except:
+//
+//   - CREATE EXTENSION citus, which needs a superuser
+//   - pg_drop_replication_slot, which needs REPLICATION
+//   - the REPLICATION attribute and schema-wide publications of CDC users
+//
+// These are skipped with a warning, or refused when skipping would leave a
+// broken tenant behind.
+func leastPrivilege() bool {
+	return os.Getenv(envVarLeastPriv) != ""
+}
@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var namespacePattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+func namespace() string {
+	return os.Getenv(envVarNamespace)
+}
+
+func ValidateNamespace(ns string) error {
+	if ns != "" && !namespacePattern.MatchString(ns) {
+		return fmt.Errorf("namespace %q must be lowercase letters and digits, starting with a letter", ns)
+	}
+	return nil
+}
+
+// Namespaced prefixes a database, schema or tenant name with the configured
+// namespace, e.g. staging_acme, so that environments sharing a cluster never
+// collide. Role names derive from tenant names and get the prefix with them.
+func Namespaced(name string) string {
+	if ns := namespace(); ns != "" && name != "" {
+		return ns + "_" + name
+	}
+	return name
+}
+
+// inNamespace tells whether a name belongs to the configured namespace, so
+// that commands scanning the whole cluster leave other environments alone
+func inNamespace(name string) bool {
+	ns := namespace()
+	return ns == "" || strings.HasPrefix(name, ns+"_")
+}
+
+func stripNamespace(name string) string {
+	if ns := namespace(); ns != "" {
+		return strings.TrimPrefix(name, ns+"_")
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// An operation is one run of the tool, or one call of a service embedding
+// the package: the rollback script undoes the statements of an operation, and
+// only inverts grants to the roles it created. Calls on a context without an
+// operation share the instance's, which Connect starts.
+type operation struct {
+	// header identifies the operation in the output files
+	header string
+
+	mu       sync.Mutex
+	rollback []rollbackStatement
+	created  map[string]bool
+}
+
+type operationKey struct{}
+
+func newOperation() *operation {
+	return &operation{
+		header:  fmt.Sprintf("-- run %s pid %d", time.Now().UTC().Format(time.RFC3339Nano), os.Getpid()),
+		created: map[string]bool{},
+	}
+}
+
+// NewOperation returns a context whose statements are rolled back apart from
+// those of other calls on the same instance.
+func NewOperation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, operationKey{}, newOperation())
+}
+
+func (pg *Postgres) operation(ctx context.Context) *operation {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		return op
+	}
+	return pg.run
+}
+
+// A statementLog collects the statements a call executes, for its result.
+// Logs nest: statements are also added to the logs of the enclosing calls.
+type statementLog struct {
+	parent *statementLog
+
+	mu         sync.Mutex
+	statements []string
+}
+
+type statementLogKey struct{}
+
+func withStatementLog(ctx context.Context) (context.Context, *statementLog) {
+	parent, _ := ctx.Value(statementLogKey{}).(*statementLog)
+	log := &statementLog{parent: parent}
+	return context.WithValue(ctx, statementLogKey{}, log), log
+}
+
+func logStatement(ctx context.Context, sql string) {
+	log, _ := ctx.Value(statementLogKey{}).(*statementLog)
+	for ; log != nil; log = log.parent {
+		log.mu.Lock()
+		log.statements = append(log.statements, sql)
+		log.mu.Unlock()
+	}
+}
+
+func (log *statementLog) list() []string {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	return slices.Clone(log.statements)
+}
@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type nopExecutor struct{}
+
+func (nopExecutor) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+// run with go test -race
+func TestStatementLogConcurrent(t *testing.T) {
+	pg := &Postgres{run: newOperation(), sessionRoles: map[*pgx.Conn]string{}}
+
+	const calls, statements = 8, 50
+
+	logs := make([]*statementLog, calls)
+	var wg sync.WaitGroup
+	for i := range calls {
+		ctx, log := withStatementLog(context.Background())
+		logs[i] = log
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range statements {
+				_, err := pg.RunExec(ctx, nopExecutor{}, fmt.Sprintf("SELECT %d, %d;", i, j))
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, log := range logs {
+		got := log.list()
+		if len(got) != statements {
+			t.Fatalf("call %d logged %d statements, want %d", i, len(got), statements)
+		}
+		for j, sql := range got {
+			if want := fmt.Sprintf("SELECT %d, %d;", i, j); sql != want {
+				t.Errorf("call %d statement %d = %q, want %q", i, j, sql, want)
+			}
+		}
+	}
+}
+
+func TestStatementLogNested(t *testing.T) {
+	pg := &Postgres{run: newOperation(), sessionRoles: map[*pgx.Conn]string{}}
+
+	ctx, outer := withStatementLog(context.Background())
+	pg.RunExec(ctx, nopExecutor{}, "SELECT 1;")
+
+	inner := func(ctx context.Context) []string {
+		ctx, log := withStatementLog(ctx)
+		pg.RunExec(ctx, nopExecutor{}, "SELECT 2;")
+		return log.list()
+	}
+
+	if got := inner(ctx); len(got) != 1 || got[0] != "SELECT 2;" {
+		t.Errorf("inner log = %q, want [SELECT 2;]", got)
+	}
+
+	if got := outer.list(); len(got) != 2 {
+		t.Errorf("outer log = %q, want both statements", got)
+	}
+}
@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Option func(o *options)
+
+// options are what Connect applies its Options to. The operator is kept apart
+// from the hook that sets it, so that Connect can compare it.
+type options struct {
+	config   *pgxpool.Config
+	operator string
+}
+
+func WithMaxConns(maxConns int32) Option {
+	return func(o *options) {
+		o.config.MaxConns = maxConns
+	}
+}
+
+func WithApplicationName(name string) Option {
+	return func(o *options) {
+		o.config.ConnConfig.RuntimeParams["application_name"] = name
+	}
+}
+
+func WithConnectTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.config.ConnConfig.ConnectTimeout = timeout
+	}
+}
+
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		config := o.config
+		config.ConnConfig.TLSConfig = tlsConfig
+		for _, fallback := range config.ConnConfig.Fallbacks {
+			fallback.TLSConfig = tlsConfig
+		}
+	}
+}
+
+// WithOperator records who is provisioning on every session, so that pgaudit
+// and log_line_prefix can attribute the DDL to a person.
+func WithOperator(operator string) Option {
+	return func(o *options) {
+		o.operator = operator
+
+		config := o.config
+		setOperator := fmt.Sprintf(`SET SESSION "app.operator" = '%s';`, strings.ReplaceAll(operator, "'", "''"))
+
+		afterConnect := config.AfterConnect
+		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) (err error) {
+			if afterConnect != nil {
+				err = afterConnect(ctx, conn)
+				if err != nil {
+					return
+				}
+			}
+
+			_, err = conn.Exec(ctx, setOperator)
+			return
+		}
+	}
+}
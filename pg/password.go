@@ -0,0 +1,326 @@
+package pg
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	lowercaseChars        = "abcdefghijklmnopqrstuvwxyz"
+	uppercaseChars        = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numberChars           = "0123456789"
+	specialChars          = "!#$%^&*()-_=+[]{}|;:,.<>?~`"
+	defaultPasswordLength = 32
+	minPasswordLength     = 16
+	defaultPassphraseLen  = 8
+	minPassphraseLen      = 4
+	defaultSeparator      = "-"
+)
+
+//go:embed wordlist.txt
+var wordlistFile string
+
+var wordlist = strings.Fields(wordlistFile)
+
+// PasswordPolicy is the generator configuration read as the rules a password
+// has to follow, so that externally supplied passwords can be held to the same
+// standard as generated ones.
+type PasswordPolicy = PasswordConfig
+
+// passwordConfig is the generator configuration for every generated password,
+// with the policy taken from the environment. Downstream validators often
+// insist on one character of each class and on a fixed prefix or suffix, which
+// purely random passwords only satisfy by chance.
+func passwordConfig() (config PasswordConfig, err error) {
+	if v := os.Getenv(envVarPwClasses); v != "" {
+		for _, class := range strings.Split(v, ",") {
+			switch strings.TrimSpace(class) {
+			case "letters":
+				config.UseLetters = true
+			case "numbers":
+				config.UseNum = true
+			case "special":
+				config.UseSpecial = true
+			default:
+				err = fmt.Errorf("unknown password character class %q, must be one of letters, numbers, special", class)
+				return
+			}
+		}
+	}
+
+	config.RequireEachClass = os.Getenv(envVarPwRequire) != ""
+	config.Prefix = os.Getenv(envVarPwPrefix)
+	config.Suffix = os.Getenv(envVarPwSuffix)
+
+	config.Style = os.Getenv(envVarPwStyle)
+	if config.Style != "" && config.Style != pwStyleRandom && config.Style != pwStylePassphrase {
+		err = fmt.Errorf("unknown password style %q, must be %s or %s", config.Style, pwStyleRandom, pwStylePassphrase)
+		return
+	}
+
+	if v := os.Getenv(envVarPwWords); v != "" {
+		config.Words, err = strconv.Atoi(v)
+		if err != nil {
+			err = fmt.Errorf("invalid passphrase word count: %w", err)
+			return
+		}
+	}
+
+	config.Separator = os.Getenv(envVarPwSeparator)
+
+	// passwords are interpolated into SQL string literals
+	if strings.Contains(config.Prefix+config.Suffix+config.Separator, "'") {
+		err = fmt.Errorf("password prefix, suffix and passphrase separator must not contain single quotes")
+		return
+	}
+
+	return
+}
+
+// ValidatePasswordPolicy checks the configured password policy before any SQL
+// runs.
+func ValidatePasswordPolicy() error {
+	config, err := passwordConfig()
+	if err != nil {
+		return err
+	}
+
+	return config.check()
+}
+
+// generatePassword generates a password with the configured policy
+func generatePassword() (string, error) {
+	config, err := passwordConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if config.Style == pwStylePassphrase {
+		return GeneratePassphrase(config)
+	}
+
+	return GenerateRandomPassword(config)
+}
+
+// initialPassword is the password of a newly created user, or none when
+// passwords are withheld
+func initialPassword() (string, error) {
+	if noCredentialsOutput() {
+		return "", nil
+	}
+
+	return generatePassword()
+}
+
+// passwordClause sets a role's password. A withheld password leaves the role
+// unable to log in until rotate-credentials sets one.
+func passwordClause(password string) string {
+	if password == "" {
+		return "PASSWORD NULL"
+	}
+
+	return fmt.Sprintf("PASSWORD '%s'", password)
+}
+
+// classes returns the character classes selected by the config after the
+// exclusions. Letters count as two classes, lower and upper case.
+func (c PasswordConfig) classes() (classes []string) {
+	if c.UseLetters {
+		classes = append(classes, lowercaseChars, uppercaseChars)
+	}
+
+	if c.UseNum {
+		classes = append(classes, numberChars)
+	}
+
+	if c.UseSpecial {
+		classes = append(classes, specialChars)
+	}
+
+	if len(classes) == 0 {
+		classes = append(classes, lowercaseChars, uppercaseChars, numberChars)
+	}
+
+	for i := range classes {
+		for _, char := range c.ExcludeSpecial {
+			classes[i] = strings.ReplaceAll(classes[i], string(char), "")
+		}
+	}
+
+	return
+}
+
+func (c PasswordConfig) length() int {
+	if c.Length == 0 {
+		return defaultPasswordLength
+	}
+	return c.Length
+}
+
+func (c PasswordConfig) words() int {
+	if c.Words == 0 {
+		return defaultPassphraseLen
+	}
+	return c.Words
+}
+
+func (c PasswordConfig) separator() string {
+	if c.Separator == "" {
+		return defaultSeparator
+	}
+	return c.Separator
+}
+
+// check rejects configurations that can't generate passwords or would
+// generate weak ones
+func (c PasswordConfig) check() error {
+	if c.Style == pwStylePassphrase {
+		if c.words() < minPassphraseLen {
+			return fmt.Errorf("passphrases need at least %d words, got %d", minPassphraseLen, c.words())
+		}
+		return nil
+	}
+
+	classes := c.classes()
+	for _, class := range classes {
+		if class == "" && c.RequireEachClass {
+			return fmt.Errorf("a required character class is empty after excluding %q", c.ExcludeSpecial)
+		}
+	}
+
+	if strings.Join(classes, "") == "" {
+		return fmt.Errorf("no characters left to generate passwords from after excluding %q", c.ExcludeSpecial)
+	}
+
+	if c.length() < minPasswordLength {
+		return fmt.Errorf("passwords need at least %d random characters, got %d", minPasswordLength, c.length())
+	}
+
+	if c.RequireEachClass && c.length() < len(classes) {
+		return fmt.Errorf("password length %d is too short to contain each of %d character classes", c.length(), len(classes))
+	}
+
+	return nil
+}
+
+// Validate checks an externally supplied password against the policy: the
+// prefix and suffix, at least as many random characters or words as the
+// generator would produce, and each character class when required.
+func (p PasswordPolicy) Validate(password string) error {
+	if strings.Contains(password, "'") {
+		return fmt.Errorf("password must not contain single quotes")
+	}
+
+	body, ok := strings.CutPrefix(password, p.Prefix)
+	if !ok {
+		return fmt.Errorf("password must start with the required prefix")
+	}
+
+	body, ok = strings.CutSuffix(body, p.Suffix)
+	if !ok {
+		return fmt.Errorf("password must end with the required suffix")
+	}
+
+	if p.Style == pwStylePassphrase {
+		if n := len(strings.Split(body, p.separator())); n < p.words() {
+			return fmt.Errorf("passphrase must have at least %d words, got %d", p.words(), n)
+		}
+		return nil
+	}
+
+	if len(body) < p.length() {
+		return fmt.Errorf("password must have at least %d characters besides the prefix and suffix, got %d", p.length(), len(body))
+	}
+
+	if p.RequireEachClass && !containsEachClass(body, p.classes()) {
+		return fmt.Errorf("password must contain at least one character of each required class")
+	}
+
+	return nil
+}
+
+// randomIndex draws uniformly from [0, n). crypto/rand.Int rejects and redraws
+// instead of reducing modulo n, so there is no bias towards low indexes.
+func randomIndex(n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("unable to pick from an empty set")
+	}
+
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to generate random index: %w", err)
+	}
+
+	return int(i.Int64()), nil
+}
+
+func GenerateRandomPassword(config PasswordConfig) (string, error) {
+	const maxAttempts = 1000
+
+	config.Style = pwStyleRandom
+	if err := config.check(); err != nil {
+		return "", err
+	}
+
+	classes := config.classes()
+
+	// each character appears in exactly one class, so every character of the
+	// charset is equally likely
+	charset := strings.Join(classes, "")
+
+	// redrawing whole passwords until every class shows up keeps the
+	// distribution uniform over the passwords that satisfy the policy
+	for range maxAttempts {
+		password := make([]byte, config.length())
+		for i := range password {
+			j, err := randomIndex(len(charset))
+			if err != nil {
+				return "", err
+			}
+			password[i] = charset[j]
+		}
+
+		if !config.RequireEachClass || containsEachClass(string(password), classes) {
+			return config.Prefix + string(password) + config.Suffix, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to generate a password containing each character class")
+}
+
+func containsEachClass(password string, classes []string) bool {
+	for _, class := range classes {
+		if class != "" && !strings.ContainsAny(password, class) {
+			return false
+		}
+	}
+	return true
+}
+
+// GeneratePassphrase generates a diceware-style passphrase from the embedded
+// wordlist, for credentials that people occasionally have to type. With about
+// ten bits per word, the default of eight words gives roughly 80 bits. The
+// character class settings don't apply; use Prefix or Suffix to satisfy
+// validators that insist on digits or symbols.
+func GeneratePassphrase(config PasswordConfig) (string, error) {
+	config.Style = pwStylePassphrase
+	if err := config.check(); err != nil {
+		return "", err
+	}
+
+	words := make([]string, config.words())
+	for i := range words {
+		j, err := randomIndex(len(wordlist))
+		if err != nil {
+			return "", err
+		}
+		words[i] = wordlist[j]
+	}
+
+	return config.Prefix + strings.Join(words, config.separator()) + config.Suffix, nil
+}
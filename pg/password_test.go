@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRandomPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PasswordConfig
+		wantLen int
+		wantErr bool
+	}{
+		{"default", PasswordConfig{}, defaultPasswordLength, false},
+		{"length", PasswordConfig{Length: 20}, 20, false},
+		{"prefix and suffix", PasswordConfig{Prefix: "pre-", Suffix: "-suf"}, defaultPasswordLength + 8, false},
+		{"each class", PasswordConfig{UseLetters: true, UseNum: true, UseSpecial: true, RequireEachClass: true, ExcludeSpecial: "@/"}, defaultPasswordLength, false},
+		{"numbers only", PasswordConfig{UseNum: true, Length: 16}, 16, false},
+		{"too short", PasswordConfig{Length: minPasswordLength - 1}, 0, true},
+		{"required class emptied", PasswordConfig{UseNum: true, RequireEachClass: true, ExcludeSpecial: numberChars}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password, err := GenerateRandomPassword(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateRandomPassword() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(password) != tt.wantLen {
+				t.Errorf("len(%q) = %d, want %d", password, len(password), tt.wantLen)
+			}
+
+			if err := tt.config.Validate(password); err != nil {
+				t.Errorf("generated password fails its own policy: %v", err)
+			}
+
+			body := strings.TrimSuffix(strings.TrimPrefix(password, tt.config.Prefix), tt.config.Suffix)
+			if strings.ContainsAny(body, tt.config.ExcludeSpecial+"'") {
+				t.Errorf("%q contains an excluded character", password)
+			}
+
+			if other, _ := GenerateRandomPassword(tt.config); other == password {
+				t.Errorf("two passwords are the same: %q", password)
+			}
+		})
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    PasswordConfig
+		wantWords int
+		wantErr   bool
+	}{
+		{"default", PasswordConfig{}, defaultPassphraseLen, false},
+		{"words and separator", PasswordConfig{Words: 5, Separator: "."}, 5, false},
+		{"too few words", PasswordConfig{Words: minPassphraseLen - 1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passphrase, err := GeneratePassphrase(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GeneratePassphrase() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if n := len(strings.Split(passphrase, tt.config.separator())); n != tt.wantWords {
+				t.Errorf("%q has %d words, want %d", passphrase, n, tt.wantWords)
+			}
+		})
+	}
+}
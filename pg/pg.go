@@ -2,53 +2,202 @@ package pg
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Postgres is safe for concurrent use: db and roleName are set before the
+// instance is returned and never change, Reconnect returns a new instance
+// instead, and the statement log and pool cache have their own locks. The
+// statements of a call are collected through its context, apart from those of
+// concurrent calls.
 type Postgres struct {
-	db       *pgxpool.Pool
-	roleName string
+	db         *pgxpool.Pool
+	roleName   string
+	sslMode    string
+	connString string
+	config     *pgxpool.Config
+	operator   string
+
+	connMu sync.Mutex
+	closed bool
+
+	statementsMu sync.Mutex
+	statements   []statementStat
+
+	// the operation of calls whose context has none
+	run *operation
+
+	// roles set with SET ROLE on each connection, so the inverse runs as the
+	// same role, which matters for default privileges
+	sessionMu    sync.Mutex
+	sessionRoles map[*pgx.Conn]string
+
+	// single-connection pools to other databases, kept for the lifetime of
+	// the instance so bulk runs don't reconnect for every schema
+	poolsMu sync.Mutex
+	pools   map[ConnectDBConfig]*pgxpool.Pool
 }
 
 var (
-	pgInstance    *Postgres
-	pgOnce        sync.Once
-	pgCurrentRole string
+	pgInstance *Postgres
+	pgMu       sync.Mutex
 )
 
-func Connect(ctx context.Context, connString string) (*Postgres, error) {
-	pgOnce.Do(func() {
-		db, err := pgxpool.New(ctx, connString)
-		if err != nil {
-			err = fmt.Errorf("unable to create connection pool: %w", err)
-			return
-		}
+// Exit ends the process when a statement is refused in read-only mode or fails
+// with halt-on-error set. The command line replaces it to finish its outputs
+// first.
+var Exit = os.Exit
+
+// Connect returns the shared instance for connString, creating it on first
+// use. A failed attempt is not remembered, so callers can retry, and a closed
+// instance is replaced by a new one. An instance for another connection string
+// stops being the shared one but stays open for the callers holding it, who
+// close it. Options only apply to a new instance: asking for other options on
+// an open one is an error.
+func Connect(ctx context.Context, connString string, opts ...Option) (*Postgres, error) {
+	err := ValidateConnString(connString)
+	if err != nil {
+		return nil, err
+	}
 
-		var currentRole string
-		err = db.QueryRow(ctx, "SELECT current_role").Scan(&currentRole)
-		if err != nil {
-			return
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse connection string: %w", err)
+	}
+
+	setSessionTimeouts(config.ConnConfig)
+	setReadOnly(config.ConnConfig)
+
+	if citusMode() {
+		config.ConnConfig.RuntimeParams["citus.enable_create_database_propagation"] = "on"
+	}
+
+	o := options{config: config}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	pgMu.Lock()
+	defer pgMu.Unlock()
+
+	previous := pgInstance
+	if previous != nil && !previous.isClosed() && previous.connString == connString {
+		if len(opts) > 0 && configSettings(o) != configSettings(options{config: previous.config, operator: previous.operator}) {
+			return nil, fmt.Errorf("already connected with other options, close the connection first")
 		}
+		return previous, nil
+	}
 
-		pgInstance = &Postgres{db, currentRole}
-	})
+	// ConnectDB copies this config, fallback hosts and target_session_attrs included
+	if hosts, err := ConnHosts(connString); err == nil && len(hosts) > 1 {
+		verbosef("-- candidate hosts: %v\n", hosts)
+	}
 
+	instance, err := open(ctx, connString, config, o.operator, newOperation())
+	if err != nil {
+		return nil, err
+	}
+
+	pgInstance = instance
+
+	// runs share the SQL log, each under its own header
 	outSQLFile := os.Getenv(envVarOutSQLFile)
-	if outSQLFile != "" {
-		truncateFile(outSQLFile)
+	if outSQLFile != "" && !credentialsStdout() && !dryRun() {
+		startSQLLog(outSQLFile, instance.run.header)
 	}
 
 	return pgInstance, nil
 }
 
+// configSettings describes what the options set on a config, to tell whether
+// an open instance has them. TLS and hooks other than the operator's are only
+// compared by presence.
+func configSettings(o options) string {
+	config := o.config
+
+	params := make([]string, 0, len(config.ConnConfig.RuntimeParams))
+	for key, value := range config.ConnConfig.RuntimeParams {
+		params = append(params, key+"="+value)
+	}
+	sort.Strings(params)
+
+	return fmt.Sprintf("max_conns=%d connect_timeout=%s tls=%t after_connect=%t operator=%q params=%q",
+		config.MaxConns,
+		config.ConnConfig.ConnectTimeout,
+		config.ConnConfig.TLSConfig != nil,
+		config.AfterConnect != nil,
+		o.operator,
+		params,
+	)
+}
+
+// open creates an instance with its pool from the parsed config, so that
+// Reconnect can do it again after Close
+func open(ctx context.Context, connString string, config *pgxpool.Config, operator string, run *operation) (*Postgres, error) {
+	db, err := pgxpool.NewWithConfig(ctx, config.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
+	}
+
+	var currentRole string
+	err = db.QueryRow(ctx, "SELECT current_role").Scan(&currentRole)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
+	}
+
+	return &Postgres{
+		db:           db,
+		roleName:     currentRole,
+		config:       config,
+		connString:   connString,
+		operator:     operator,
+		sslMode:      connStringSSLMode(connString),
+		run:          run,
+		sessionRoles: map[*pgx.Conn]string{},
+	}, nil
+}
+
+func (pg *Postgres) isClosed() bool {
+	pg.connMu.Lock()
+	defer pg.connMu.Unlock()
+
+	return pg.closed
+}
+
+// Reconnect closes the instance and returns a new one with the same settings,
+// after Close or when the server went away, e.g. on a failover. The new
+// instance keeps the operation, so the rollback covers both, and becomes the
+// shared one if this one was.
+func (pg *Postgres) Reconnect(ctx context.Context) (*Postgres, error) {
+	if !pg.isClosed() {
+		pg.closeConnections()
+	}
+
+	instance, err := open(ctx, pg.connString, pg.config, pg.operator, pg.run)
+	if err != nil {
+		return nil, err
+	}
+
+	pgMu.Lock()
+	if pgInstance == pg {
+		pgInstance = instance
+	}
+	pgMu.Unlock()
+
+	return instance, nil
+}
+
 func (pg *Postgres) ConnectDB(ctx context.Context, connConfig ConnectDBConfig) (pool *pgxpool.Pool, err error) {
 	config := pg.db.Config().Copy()
 	if connConfig.DBName != "" {
@@ -56,24 +205,36 @@ func (pg *Postgres) ConnectDB(ctx context.Context, connConfig ConnectDBConfig) (
 	}
 
 	outSQLFile := os.Getenv(envVarOutSQLFile)
+	if credentialsStdout() {
+		outSQLFile = ""
+	}
 
 	config.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) (err error) {
 		if outSQLFile != "" {
 			appendToFile(outSQLFile, fmt.Sprintf("-- connecting to database %s\n", connConfig.Database))
 		}
+		verbosef("-- connecting to database %s\n", connConfig.Database)
 		return
 	}
 
 	if connConfig.RoleName != "" {
+		afterConnect := config.AfterConnect
 		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) (err error) {
+			if afterConnect != nil {
+				err = afterConnect(ctx, conn)
+				if err != nil {
+					return
+				}
+			}
+
 			setRole := fmt.Sprintf("SET ROLE %s;", connConfig.RoleName)
-			_, err = pg.RunExec(conn, ctx, setRole)
+			_, err = pg.RunExec(ctx, conn, setRole)
 			return
 		}
 
 		config.BeforeClose = func(conn *pgx.Conn) {
 			resetRole := fmt.Sprintf("RESET ROLE;")
-			pg.RunExec(conn, ctx, resetRole)
+			pg.RunExec(ctx, conn, resetRole)
 			if outSQLFile != "" {
 				appendToFile(outSQLFile, fmt.Sprintf("-- closing connection to database %s\n", conn.Config().Database))
 			}
@@ -86,8 +247,11 @@ func (pg *Postgres) ConnectDB(ctx context.Context, connConfig ConnectDBConfig) (
 		}
 	}
 
-	config.MaxConns = 1
-	config.MinConns = 1
+	config.MaxConns = connConfig.MaxConns
+	if config.MaxConns == 0 {
+		config.MaxConns = poolMaxConns()
+	}
+	config.MinConns = min(poolMinConns(), config.MaxConns)
 
 	pool, err = pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
@@ -98,141 +262,493 @@ func (pg *Postgres) ConnectDB(ctx context.Context, connConfig ConnectDBConfig) (
 	return
 }
 
-func (pg *Postgres) RunExec(x PGConnExecutor, ctx context.Context, sql string, arguments ...any) (tag pgconn.CommandTag, err error) {
+func (pg *Postgres) withDB(ctx context.Context, connConfig ConnectDBConfig, fn func(conn PGConnQuerier) error) (err error) {
+	// nothing is executed in dry-run mode, so the target database may not exist yet
+	if dryRun() {
+		fmt.Fprintf(os.Stdout, "-- connecting to database %s\n", connConfig.DBName)
+		if connConfig.RoleName != "" {
+			fmt.Fprintf(os.Stdout, "SET ROLE %s;\n", connConfig.RoleName)
+		}
+		return fn(pg.db)
+	}
+
+	pool, err := pg.dbPool(ctx, connConfig)
+	if err != nil {
+		err = fmt.Errorf("unable to connect to database: %w", err)
+		return
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire connection: %w", err)
+		return
+	}
+
+	defer conn.Release()
+
+	// other pools open new connections, which a load balancer may route to a replica
+	err = ensurePrimary(ctx, conn)
+	if err != nil {
+		return
+	}
+
+	return fn(conn)
+}
+
+// withSessionDB is withDB for statements that may change the session, like
+// SET ROLE or SET in an operator's file: the connection is closed afterwards
+// instead of going back to the pool, so none of it leaks into later work
+func (pg *Postgres) withSessionDB(ctx context.Context, connConfig ConnectDBConfig, fn func(conn PGConnQuerier) error) (err error) {
+	return pg.withDB(ctx, connConfig, func(conn PGConnQuerier) error {
+		if pooled, ok := conn.(*pgxpool.Conn); ok {
+			defer func() {
+				session := pooled.Hijack()
+
+				pg.sessionMu.Lock()
+				delete(pg.sessionRoles, session)
+				pg.sessionMu.Unlock()
+
+				if err := session.Close(ctx); err != nil {
+					warnf("unable to close connection: %v\n", err)
+				}
+			}()
+		}
+
+		return fn(conn)
+	})
+}
+
+func (pg *Postgres) dbPool(ctx context.Context, connConfig ConnectDBConfig) (pool *pgxpool.Pool, err error) {
+	pg.poolsMu.Lock()
+	defer pg.poolsMu.Unlock()
+
+	pool, ok := pg.pools[connConfig]
+	if ok {
+		return
+	}
+
+	pool, err = pg.ConnectDB(ctx, connConfig)
+	if err != nil {
+		return
+	}
+
+	if pg.pools == nil {
+		pg.pools = make(map[ConnectDBConfig]*pgxpool.Pool)
+	}
+	pg.pools[connConfig] = pool
+
+	return
+}
+
+// closePools closes the cached pools matching the filter, before the database
+// or role they use is dropped
+func (pg *Postgres) closePools(match func(connConfig ConnectDBConfig) bool) {
+	var closing []*pgxpool.Pool
+
+	pg.poolsMu.Lock()
+	for connConfig, pool := range pg.pools {
+		if match(connConfig) {
+			closing = append(closing, pool)
+			delete(pg.pools, connConfig)
+		}
+	}
+	pg.poolsMu.Unlock()
+
+	// closing runs BeforeClose hooks, which execute statements
+	for _, pool := range closing {
+		pool.Close()
+	}
+}
+
+func (pg *Postgres) recordStatement(stat statementStat) {
+	pg.statementsMu.Lock()
+	defer pg.statementsMu.Unlock()
+
+	pg.statements = append(pg.statements, stat)
+}
+
+func (pg *Postgres) RunExec(ctx context.Context, x PGConnExecutor, sql string, arguments ...any) (tag pgconn.CommandTag, err error) {
+	if dryRun() {
+		fmt.Fprintf(os.Stdout, "%s\n", sql)
+		return
+	}
+
+	if readOnly() {
+		fmt.Fprintf(os.Stderr, "refusing to execute in read-only mode:\n%s\n", redactSQL(sql))
+		Exit(1)
+	}
+
+	start := time.Now()
 	tag, err = x.Exec(ctx, sql, arguments...)
+	duration := time.Since(start)
+	pg.recordStatement(statementStat{sql: redactSQL(sql), duration: duration, failed: err != nil})
+	verbosef("%s -- %s\n", redactSQL(sql), duration.Round(time.Microsecond))
 	if err != nil {
-		err = fmt.Errorf("%w\nwith sql:\n%s", err, sql)
+		verbosef("-- failed: %v\n", err)
+		err = fmt.Errorf("%w\nwith sql:\n%s", err, redactSQL(sql))
 		haltOnError := os.Getenv(envVarHaltOnError)
 		if haltOnError != "" {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(1)
+			Exit(1)
 		}
+	} else {
+		logStatement(ctx, redactSQL(sql))
+		pg.recordRollback(ctx, x, sql)
 	}
 
 	outSQLFile := os.Getenv(envVarOutSQLFile)
-	if outSQLFile != "" {
+	if outSQLFile != "" && !credentialsStdout() {
 		appendToFile(outSQLFile, fmt.Sprintf("%s\n", sql))
 	}
 
 	return
 }
 
+// Operation markers are sent to the server, not only written to the SQL
+// file, so they show up in server logs and pgaudit output next to the DDL.
+// A bare comment is not logged by the server, hence the SET.
+func (pg *Postgres) annotate(ctx context.Context, x PGConnExecutor, operation string, fields ...string) {
+	marker := strings.TrimSpace(fmt.Sprintf("%s %s", operation, strings.Join(fields, " ")))
+	annotation := fmt.Sprintf(
+		"-- operation: %s\nSET SESSION \"app.operation\" = '%s';",
+		marker, strings.ReplaceAll(marker, "'", "''"),
+	)
+	pg.RunExec(ctx, x, annotation)
+}
+
+func ensurePrimary(ctx context.Context, conn PGConnQuerier) (err error) {
+	var inRecovery bool
+	err = conn.QueryRow(ctx, "SELECT pg_is_in_recovery();").Scan(&inRecovery)
+	if err != nil {
+		err = fmt.Errorf("unable to check if server is a primary: %w", err)
+		return
+	}
+
+	if inRecovery {
+		err = fmt.Errorf("connected to a read-only replica, tenants can only be provisioned on a primary")
+	}
+
+	return
+}
+
+func (pg *Postgres) EnsurePrimary(ctx context.Context) error {
+	return ensurePrimary(ctx, pg.db)
+}
+
 func (pg *Postgres) Ping(ctx context.Context) error {
 	return pg.db.Ping(ctx)
 }
 
 func (pg *Postgres) Close() {
+	if os.Getenv(envVarSummary) != "" {
+		fmt.Fprint(os.Stderr, pg.Summary())
+	}
+	pg.closeConnections()
+}
+
+func (pg *Postgres) closeConnections() {
+	pg.closePools(func(ConnectDBConfig) bool { return true })
 	pg.db.Close()
+
+	pg.connMu.Lock()
+	pg.closed = true
+	pg.connMu.Unlock()
+}
+
+func (pg *Postgres) CheckIfRoleExists(ctx context.Context, roleName string) (exists bool, err error) {
+	err = pg.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1);",
+		roleName,
+	).Scan(&exists)
+	if err != nil {
+		err = fmt.Errorf("unable to check if role %s exists: %w", roleName, err)
+	}
+	return
 }
 
-func (pg *Postgres) CheckIfRoleExists(ctx context.Context, roleName string) bool {
-	exists := false
-	var res int
-	err := pg.db.QueryRow(ctx, fmt.Sprintf("SELECT 1 FROM pg_roles WHERE rolname='%s';", roleName)).Scan(&res)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+func (pg *Postgres) CheckIfDBExists(ctx context.Context, dbName string) (exists bool, err error) {
+	err = pg.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1);",
+		dbName,
+	).Scan(&exists)
+	if err != nil {
+		err = fmt.Errorf("unable to check if database %s exists: %w", dbName, err)
 	}
-	if res == 1 {
-		exists = true
+	return
+}
+
+func (pg *Postgres) CheckIfSchemaExists(ctx context.Context, dbName string, schemaName string) (exists bool, err error) {
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) error {
+		return conn.QueryRow(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1);",
+			schemaName,
+		).Scan(&exists)
+	})
+	if err != nil {
+		err = fmt.Errorf("unable to check if schema %s exists: %w", schemaName, err)
 	}
-	return exists
+	return
 }
 
-func (pg *Postgres) CheckIfDBExists(ctx context.Context, dbName string) bool {
-	exists := false
-	var res int
-	err := pg.db.QueryRow(ctx, fmt.Sprintf("SELECT 1 FROM pg_database WHERE datname='%s';", dbName)).Scan(&res)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+func (pg *Postgres) CheckIfUserIsMember(ctx context.Context, username string, groupname string) (member bool, err error) {
+	err = pg.db.QueryRow(ctx,
+		`SELECT EXISTS (
+SELECT 1 FROM pg_roles u, pg_roles g
+WHERE u.rolname = $1 AND g.rolname = $2 AND pg_has_role(u.oid, g.oid, 'MEMBER')
+);`,
+		username, groupname,
+	).Scan(&member)
+	if err != nil {
+		err = fmt.Errorf("unable to check if %s is a member of %s: %w", username, groupname, err)
 	}
-	if res == 1 {
-		exists = true
+	return
+}
+
+func (pg *Postgres) GetRoleAttributes(ctx context.Context, roleName string) (attrs RoleAttributes, err error) {
+	err = pg.db.QueryRow(ctx,
+		`SELECT rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin,
+rolreplication, rolbypassrls, rolconnlimit, rolvaliduntil
+FROM pg_roles WHERE rolname = $1;`,
+		roleName,
+	).Scan(
+		&attrs.Superuser, &attrs.Inherit, &attrs.CreateRole, &attrs.CreateDB, &attrs.Login,
+		&attrs.Replication, &attrs.BypassRLS, &attrs.ConnectionLimit, &attrs.ValidUntil,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = fmt.Errorf("role %s does not exist", roleName)
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("unable to get attributes of role %s: %w", roleName, err)
 	}
-	return exists
+	return
 }
 
-func (pg *Postgres) DropRole(ctx context.Context, roleName string) {
+func (pg *Postgres) DropRole(ctx context.Context, roleName string) (err error) {
 	dropOwnedByRole := fmt.Sprintf("REASSIGN OWNED BY %s TO %s; SET ROLE %s; DROP OWNED BY %s; RESET ROLE;", roleName, pg.roleName, roleName, roleName)
 	dropRole := fmt.Sprintf("DROP ROLE IF EXISTS %s;", roleName)
 
-	roleExists := pg.CheckIfRoleExists(ctx, roleName)
-	if roleExists {
-		pg.RunExec(pg.db, ctx, dropOwnedByRole)
-		pg.RunExec(pg.db, ctx, dropRole)
+	roleExists, err := pg.CheckIfRoleExists(ctx, roleName)
+	if err != nil || !roleExists {
+		return
+	}
+
+	pg.closePools(func(connConfig ConnectDBConfig) bool { return connConfig.RoleName == roleName })
+
+	if terminateConnections() {
+		err = pg.TerminateRoleSessions(ctx, roleName)
+		if err != nil {
+			err = fmt.Errorf("unable to terminate sessions of role %s: %w", roleName, err)
+			return
+		}
 	}
+
+	// REASSIGN OWNED and DROP OWNED only act on the current database
+	dbNames, err := pg.roleDependentDatabases(ctx, roleName)
+	if err != nil {
+		return
+	}
+
+	currentDB := pg.db.Config().ConnConfig.Database
+	var touched []string
+	for _, dbName := range dbNames {
+		if dbName == currentDB {
+			continue
+		}
+
+		err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+			_, err = pg.RunExec(ctx, conn, dropOwnedByRole)
+			return
+		})
+		if err != nil {
+			err = fmt.Errorf("unable to drop objects of role %s in database %s: %w", roleName, dbName, err)
+			return
+		}
+
+		touched = append(touched, dbName)
+	}
+
+	if len(touched) > 0 {
+		logf("cleaned up objects of role %s in databases: %s\n", roleName, strings.Join(touched, ", "))
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, dropOwnedByRole)
+	if err != nil {
+		err = fmt.Errorf("unable to drop objects of role %s: %w", roleName, err)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, dropRole)
+	if err != nil {
+		err = fmt.Errorf("unable to drop role %s: %w", roleName, err)
+	}
+
+	return
 }
 
-func (pg *Postgres) DropTenantSchemaUsers(ctx context.Context, roleNamePrefix string, schemaName string) {
+func (pg *Postgres) roleDependentDatabases(ctx context.Context, roleName string) (dbNames []string, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT DISTINCT d.datname FROM pg_shdepend s
+JOIN pg_database d ON d.oid = s.dbid
+JOIN pg_roles r ON r.oid = s.refobjid
+WHERE s.refclassid = 'pg_authid'::regclass AND r.rolname = $1 AND d.datallowconn
+ORDER BY d.datname;`,
+		roleName,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list databases depending on role %s: %w", roleName, err)
+		return
+	}
+
+	dbNames, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		err = fmt.Errorf("unable to list databases depending on role %s: %w", roleName, err)
+	}
+
+	return
+}
+
+func (pg *Postgres) dropRoles(ctx context.Context, roleNames ...string) (err error) {
+	for _, roleName := range roleNames {
+		err = pg.DropRole(ctx, roleName)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (pg *Postgres) DropTenantSchemaUsers(ctx context.Context, roleNamePrefix string, schemaName string) (err error) {
 	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
 
-	pg.DropRole(ctx, schemaUsers.ReadOnly.Username)
-	pg.DropRole(ctx, schemaUsers.ReadWrite.Username)
-	pg.DropRole(ctx, schemaUsers.Admin.Username)
+	err = pg.dropRoles(ctx, tenantSchemaCDCUserName(roleNamePrefix, schemaName), schemaUsers.ReadOnly.Username, schemaUsers.ReadWrite.Username, schemaUsers.Admin.Username)
+	if err != nil {
+		return
+	}
+
+	// the other users of the rotation pairs
+	err = pg.dropRoles(ctx, schemaUsers.ReadOnly.Username+graceSuffix, schemaUsers.ReadWrite.Username+graceSuffix, schemaUsers.Admin.Username+graceSuffix)
+	if err != nil {
+		return
+	}
+
+	return pg.DropTenantSchemaDualUsers(ctx, roleNamePrefix, schemaName)
 }
 
-func (pg *Postgres) DropTenantSchemaGroups(ctx context.Context, roleNamePrefix string, schemaName string) {
-	pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+func (pg *Postgres) DropTenantSchemaGroups(ctx context.Context, roleNamePrefix string, schemaName string) (err error) {
+	err = pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
 
 	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
 
-	pg.DropRole(ctx, schemaGroups.ReadOnly)
-	pg.DropRole(ctx, schemaGroups.ReadWrite)
-	pg.DropRole(ctx, schemaGroups.Admin)
+	return pg.dropRoles(ctx, schemaGroups.ReadOnly, schemaGroups.ReadWrite, schemaGroups.Admin)
 }
 
-func (pg *Postgres) DropDB(ctx context.Context, dbName string) {
+func (pg *Postgres) DropDB(ctx context.Context, dbName string) (err error) {
 	alterDB := fmt.Sprintf("ALTER DATABASE %s OWNER TO %s;", dbName, pg.roleName)
 	dropDB := fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE);", dbName)
 
-	dbExists := pg.CheckIfDBExists(ctx, dbName)
-	if dbExists {
-		pg.RunExec(pg.db, ctx, alterDB)
-		pg.RunExec(pg.db, ctx, dropDB)
+	dbExists, err := pg.CheckIfDBExists(ctx, dbName)
+	if err != nil || !dbExists {
+		return
 	}
+
+	pg.closePools(func(connConfig ConnectDBConfig) bool { return connConfig.DBName == dbName })
+
+	_, err = pg.RunExec(ctx, pg.db, alterDB)
+	if err != nil {
+		err = fmt.Errorf("unable to take ownership of database %s: %w", dbName, err)
+		return
+	}
+
+	if yugabyteDialect() {
+		return pg.dropYugabyteDB(ctx, dbName)
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, dropDB)
+	if err != nil {
+		err = fmt.Errorf("unable to drop database %s: %w", dbName, err)
+	}
+
+	return
 }
 
 func (pg *Postgres) CreateGroup(ctx context.Context, groupname string) (err error) {
-	createGroup := fmt.Sprintf("CREATE ROLE %s WITH NOLOGIN;", groupname)
-	_, err = pg.RunExec(pg.db, ctx, createGroup)
+	attrs, err := roleAttributes(groupname)
+	if err != nil {
+		return
+	}
+
+	createGroup := fmt.Sprintf("CREATE ROLE %s WITH NOLOGIN %s;", groupname, attrs)
+	_, err = pg.RunExec(ctx, pg.db, createGroup)
 	return
 }
 
-func (pg *Postgres) NewTenantSchemaGroups(ctx context.Context, roleNamePrefix string, schemaName string) SchemaGroups {
-	pg.DropTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+func (pg *Postgres) NewTenantSchemaGroups(ctx context.Context, roleNamePrefix string, schemaName string) (schemaGroups SchemaGroups, err error) {
+	err = pg.DropTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
 
-	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	schemaGroups = tenantSchemaGroupNames(roleNamePrefix, schemaName)
 
-	pg.CreateGroup(ctx, schemaGroups.Admin)
-	pg.CreateGroup(ctx, schemaGroups.ReadWrite)
-	pg.CreateGroup(ctx, schemaGroups.ReadOnly)
+	for _, groupname := range []string{schemaGroups.Admin, schemaGroups.ReadWrite, schemaGroups.ReadOnly} {
+		err = pg.CreateGroup(ctx, groupname)
+		if err != nil {
+			return
+		}
+	}
 
-	return schemaGroups
+	err = pg.recordShortenedGroupNames(ctx, roleNamePrefix, schemaName)
+
+	return
 }
 
 func (pg *Postgres) CreateUser(ctx context.Context, user UserCredentials, groupname string) (err error) {
-	createUser := fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD '%s';", user.Username, user.Password)
+	attrs, err := roleAttributes(user.Username)
+	if err != nil {
+		return
+	}
+
+	createUser := fmt.Sprintf("CREATE ROLE %s WITH LOGIN %s %s;", user.Username, attrs, passwordClause(user.Password))
 	grantGroup := fmt.Sprintf("GRANT %s TO %s;", groupname, user.Username)
 
-	_, err = pg.RunExec(pg.db, ctx, createUser)
+	_, err = pg.RunExec(ctx, pg.db, createUser)
+	if err != nil {
+		return
+	}
 
 	if groupname != "" {
-		_, err = pg.RunExec(pg.db, ctx, grantGroup)
+		_, err = pg.RunExec(ctx, pg.db, grantGroup)
 	}
 
 	return
 }
 
-func (pg *Postgres) NewTenantSchemaUsers(ctx context.Context, roleNamePrefix string, schemaName string) SchemaUsers {
-	pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+func (pg *Postgres) NewTenantSchemaUsers(ctx context.Context, roleNamePrefix string, schemaName string) (schemaUsers SchemaUsers, err error) {
+	err = pg.DropTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
 
 	schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
-	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+	schemaUsers = newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+
+	err = pg.CreateUser(ctx, schemaUsers.Admin, schemaGroups.Admin)
+	if err != nil {
+		return
+	}
+
+	err = pg.CreateUser(ctx, schemaUsers.ReadWrite, schemaGroups.ReadWrite)
+	if err != nil {
+		return
+	}
 
-	pg.CreateUser(ctx, schemaUsers.Admin, schemaGroups.Admin)
-	pg.CreateUser(ctx, schemaUsers.ReadWrite, schemaGroups.ReadWrite)
-	pg.CreateUser(ctx, schemaUsers.ReadOnly, schemaGroups.ReadOnly)
+	err = pg.CreateUser(ctx, schemaUsers.ReadOnly, schemaGroups.ReadOnly)
 
-	return schemaUsers
+	return
 }
 
 func (pg *Postgres) NewTenantDB(ctx context.Context, dbName string, tenantName string) (err error) {
@@ -242,6 +758,15 @@ func (pg *Postgres) NewTenantDB(ctx context.Context, dbName string, tenantName s
 		roleNamePrefix = dbName
 	}
 
+	err = ValidateTenantName(roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	if supabaseProfile() {
+		return pg.newSupabaseTenantDB(ctx, dbName, roleNamePrefix)
+	}
+
 	ownerRole := tenantOwnerName(roleNamePrefix)
 
 	// begin definitions
@@ -255,8 +780,17 @@ func (pg *Postgres) NewTenantDB(ctx context.Context, dbName string, tenantName s
 
 	// begin executions
 
-	pg.DropDB(ctx, dbName)
-	pg.DropRole(ctx, ownerRole)
+	pg.annotate(ctx, pg.db, "create-database", "tenant="+roleNamePrefix, "database="+dbName)
+
+	err = pg.DropDB(ctx, dbName)
+	if err != nil {
+		return
+	}
+
+	err = pg.DropRole(ctx, ownerRole)
+	if err != nil {
+		return
+	}
 
 	err = pg.CreateGroup(ctx, ownerRole)
 	if err != nil {
@@ -264,14 +798,20 @@ func (pg *Postgres) NewTenantDB(ctx context.Context, dbName string, tenantName s
 		return
 	}
 
-	_, err = pg.RunExec(pg.db, ctx, createDB)
+	err = pg.recordShortenedOwnerName(ctx, roleNamePrefix)
+	if err != nil {
+		pg.DropRole(ctx, ownerRole)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, createDB)
 	if err != nil {
 		err = fmt.Errorf("unable to create database: %w", err)
 		pg.DropRole(ctx, ownerRole)
 		return
 	}
 
-	_, err = pg.RunExec(pg.db, ctx, alterDB)
+	_, err = pg.RunExec(ctx, pg.db, alterDB)
 	if err != nil {
 		err = fmt.Errorf("unable to set database owner: %w", err)
 		pg.DropDB(ctx, dbName)
@@ -280,204 +820,333 @@ func (pg *Postgres) NewTenantDB(ctx context.Context, dbName string, tenantName s
 	}
 
 	// execute revoke all privileges from PUBLIC
-	pg.RunExec(pg.db, ctx, revokeDBPublic)
-	err = func() (err error) {
-		tmpPool, err := pg.ConnectDB(ctx, ConnectDBConfig{DBName: dbName})
-		if err != nil {
-			return
+	pg.RunExec(ctx, pg.db, revokeDBPublic)
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "create-database", "tenant="+roleNamePrefix, "database="+dbName, "phase=lockdown")
+		pg.RunExec(ctx, conn, revokeSchemaPublic)
+
+		if citusMode() && leastPrivilege() {
+			warnf("least-privilege mode: skipping CREATE EXTENSION citus in %s, a superuser must create it\n", dbName)
+		} else if citusMode() {
+			_, err = pg.RunExec(ctx, conn, "CREATE EXTENSION IF NOT EXISTS citus;")
+			if err != nil {
+				err = fmt.Errorf("unable to create citus extension: %w", err)
+			}
 		}
 
-		defer tmpPool.Close()
+		return
+	})
+
+	return
+}
+
+// NewSharedDB prepares a database meant to host many tenant schemas: the
+// database is locked down like a tenant database, and gets a control schema
+// owned by the database owner for bookkeeping tables.
+func (pg *Postgres) NewSharedDB(ctx context.Context, dbName string, tenantName string, controlSchema string, pgcrypto bool) (err error) {
+	err = pg.NewTenantDB(ctx, dbName, tenantName)
+	if err != nil {
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
 
-		conn, err := tmpPool.Acquire(ctx)
+	createSchema := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", controlSchema)
+	revokeSchema := fmt.Sprintf("REVOKE ALL ON SCHEMA %s FROM PUBLIC;", controlSchema)
+	createPgcrypto := fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA %s;", controlSchema)
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName, RoleName: tenantOwnerName(roleNamePrefix)}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "create-shared-db", "tenant="+roleNamePrefix, "database="+dbName, "phase=control")
+
+		_, err = pg.RunExec(ctx, conn, createSchema)
 		if err != nil {
-			err = fmt.Errorf("unable to acquire connection: %w", err)
+			err = fmt.Errorf("unable to create control schema: %w", err)
 			return
 		}
 
-		defer conn.Release()
+		pg.RunExec(ctx, conn, revokeSchema)
 
-		pg.RunExec(conn, ctx, revokeSchemaPublic)
+		if pgcrypto {
+			_, err = pg.RunExec(ctx, conn, createPgcrypto)
+			if err != nil {
+				err = fmt.Errorf("unable to create pgcrypto extension: %w", err)
+			}
+		}
 
 		return
-	}()
+	})
 
 	return
 }
 
-func (pg *Postgres) NewTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+type SchemaProvisionResult struct {
+	DBName     string `json:"db"`
+	SchemaName string `json:"schema"`
+	// Users is SchemaUsers, or DualSchemaUsers with --dual-users
+	Users      any          `json:"users,omitempty"`
+	Groups     SchemaGroups `json:"groups"`
+	Statements []string     `json:"statements"`
+	// PoolerConfig holds the schema's entries for the configured pooler
+	PoolerConfig string `json:"poolerConfig,omitempty"`
+}
+
+// NewTenantSchema creates a tenant schema with its groups and users. Nothing
+// is written out: the result carries the credentials, which are set even when
+// a later step fails, so callers should keep them whenever Users is not nil.
+func (pg *Postgres) NewTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (result SchemaProvisionResult, err error) {
+	return pg.provisionTenantSchema(ctx, schemaName, tenantName, connConfig, blueprint())
+}
+
+func (pg *Postgres) provisionTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig, blueprintPath string) (result SchemaProvisionResult, err error) {
+	result.DBName = connConfig.DBName
+	result.SchemaName = schemaName
+
+	ctx, log := withStatementLog(ctx)
+	credentials, err := pg.newTenantSchema(ctx, schemaName, tenantName, connConfig, blueprintPath)
+	result.Statements = log.list()
+
+	if credentials == nil {
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = connConfig.DBName
+	}
+
+	result.Users = credentials
+	result.Groups = tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	result.PoolerConfig, _ = pg.poolerConfig(credentials, connConfig.DBName, schemaName, tenantName)
+
+	return
+}
+
+// OutputCredentials writes credentials to the configured credentials file or
+// stdout, split per role with --split-credentials
+func OutputCredentials(credentials any) {
+	outputCredentials(credentials)
+}
+
+// WritePoolerConfig writes the pooler configuration of the given schemas to
+// the configured pooler config file
+func WritePoolerConfig(pools []string) {
+	writePoolerConfig(pools)
+}
+
+// newTenantSchema returns the credentials of the schema users instead of
+// writing them out, so that batches can be consolidated in one output.
+func (pg *Postgres) newTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig, blueprintPath string) (credentials any, err error) {
 
 	if connConfig.DBName == "" {
-		err = fmt.Errorf("missing database name: %w", err)
+		err = fmt.Errorf("missing database name")
 		return
 	}
 
 	dbName := connConfig.DBName
 
+	defer func() {
+		if credentials != nil && withDSN() {
+			credentials = pg.addDSNs(credentials, dbName)
+		}
+	}()
+
 	roleNamePrefix := tenantName
 	if roleNamePrefix == "" {
 		roleNamePrefix = dbName
 	}
 
+	err = ValidateTenantName(roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	if supabaseProfile() {
+		err = checkSupabaseRoleName(roleNamePrefix)
+		if err != nil {
+			return
+		}
+	}
+
 	ownerRole := tenantOwnerName(roleNamePrefix)
 
 	if connConfig.RoleName == "" {
 		connConfig.RoleName = ownerRole
 	}
 
+	schemaTTL, err := ttl()
+	if err != nil {
+		return
+	}
+
 	dropSchema := fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;", schemaName)
 	createSchema := fmt.Sprintf("CREATE SCHEMA %s;", schemaName)
 	revokeCreateOnSchema := fmt.Sprintf("REVOKE CREATE ON SCHEMA %s FROM PUBLIC;", schemaName)
 
-	err = func() (err error) {
-		tmpPool, err := pg.ConnectDB(ctx, connConfig)
+	if terminateConnections() {
+		schemaGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+		err = pg.TerminateGroupSessions(ctx, dbName, schemaGroups.Admin, schemaGroups.ReadWrite, schemaGroups.ReadOnly)
 		if err != nil {
-			err = fmt.Errorf("unable to connect to database: %w", err)
+			err = fmt.Errorf("unable to terminate schema sessions: %w", err)
 			return
 		}
+	}
+
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName}
 
-		defer tmpPool.Close()
+	err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "create-schema", append(operation, "phase=schema")...)
+		pg.RunExec(ctx, conn, dropSchema)
 
-		conn, err := tmpPool.Acquire(ctx)
+		_, err = pg.RunExec(ctx, conn, createSchema)
 		if err != nil {
-			err = fmt.Errorf("unable to acquire connection: %w", err)
+			err = fmt.Errorf("unable to create schema: %w", err)
 			return
 		}
 
-		defer conn.Release()
+		pg.RunExec(ctx, conn, revokeCreateOnSchema)
 
-		pg.RunExec(conn, ctx, dropSchema)
-
-		_, err = pg.RunExec(conn, ctx, createSchema)
-		if err != nil {
-			err = fmt.Errorf("unable to create schema: %w", err)
-			return
+		// recorded first, so that reap cleans up if a later step fails
+		if schemaTTL > 0 {
+			err = pg.expireSchema(ctx, conn, schemaName, roleNamePrefix, time.Now().Add(schemaTTL))
+			if err != nil {
+				return
+			}
 		}
 
-		pg.RunExec(conn, ctx, revokeCreateOnSchema)
+		// the grants phase below covers the blueprint's objects too
+		if blueprintPath != "" {
+			err = pg.applyBlueprint(ctx, conn, schemaName, blueprintPath)
+		}
 
 		return
-	}()
+	})
 
 	if err != nil {
 		return
 	}
 
-	tenantGroups := pg.NewTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+	pg.annotate(ctx, pg.db, "create-schema", append(operation, "phase=groups")...)
 
-	// grant basic privileges
-	grantDBAccess := fmt.Sprintf(
-		"GRANT CONNECT, TEMPORARY ON DATABASE %s TO %s;",
-		dbName, fmt.Sprintf("%s, %s, %s", tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly),
-	)
-	pg.RunExec(pg.db, ctx, grantDBAccess)
-
-	// admin privileges
-
-	grantSchemaAdminCreate := fmt.Sprintf("GRANT USAGE, CREATE ON SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
-	grantSchemaAdminTables := fmt.Sprintf("GRANT ALL ON ALL TABLES IN SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
-	grantSchemaAdminSequences := fmt.Sprintf("GRANT ALL ON ALL SEQUENCES IN SCHEMA %s TO %s;", schemaName, tenantGroups.Admin)
+	tenantGroups, err := pg.NewTenantSchemaGroups(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		err = fmt.Errorf("unable to create schema groups: %w", err)
+		return
+	}
 
-	// basic privileges
+	// grant basic privileges
+	dbGrants, err := databaseGrants(dbName, tenantGroups)
+	if err != nil {
+		return
+	}
 
-	grantSchemaUsage := fmt.Sprintf(
-		"GRANT USAGE ON SCHEMA %s TO %s;",
-		schemaName, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
-	)
+	for _, grant := range dbGrants {
+		pg.RunExec(ctx, pg.db, grant)
+	}
 
-	grantTablesRead := fmt.Sprintf(
-		"GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s;",
-		schemaName, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
-	)
+	grants, defaultPrivileges := tenantSchemaGrants(schemaName, tenantGroups)
 
-	grantSequencesRead := fmt.Sprintf(
-		"GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA %s TO %s;",
-		schemaName, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
-	)
+	// begin executions
 
-	// default privileges
+	err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "create-schema", append(operation, "phase=grants")...)
 
-	// partial cmd
-	defaultAlter := fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s", schemaName)
+		for _, grant := range grants {
+			pg.RunExec(ctx, conn, grant)
+		}
 
-	grantDefaultSequencesRead := fmt.Sprintf(
-		"%s GRANT USAGE, SELECT ON SEQUENCES TO %s;",
-		defaultAlter, fmt.Sprintf("%s, %s", tenantGroups.ReadWrite, tenantGroups.ReadOnly),
-	)
+		pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
 
-	grantDefaultSequencesWrite := fmt.Sprintf(
-		"%s GRANT UPDATE ON SEQUENCES TO %s;",
-		defaultAlter, tenantGroups.ReadWrite,
-	)
+		if citusDistributeSchema() {
+			distributeSchema := fmt.Sprintf("SELECT citus_schema_distribute('%s');", schemaName)
+			_, err = pg.RunExec(ctx, conn, distributeSchema)
+			if err != nil {
+				err = fmt.Errorf("unable to distribute schema: %w", err)
+			}
+		}
 
-	grantDefaultTablesRead := fmt.Sprintf(
-		"%s GRANT SELECT ON TABLES TO %s;",
-		defaultAlter, tenantGroups.ReadOnly,
-	)
+		return
+	})
 
-	grantDefaultTablesReadWrite := fmt.Sprintf(
-		"%s GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO %s;",
-		defaultAlter, tenantGroups.ReadWrite,
-	)
+	if err != nil {
+		return
+	}
 
-	// begin executions
+	if objectGrants := tenantSchemaObjectGrants(tenantGroups); len(objectGrants) > 0 {
+		err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+			for _, grant := range objectGrants {
+				_, err = pg.RunExec(ctx, conn, grant)
+				if err != nil {
+					return
+				}
+			}
+			return
+		})
 
-	err = func() (err error) {
-		tmpPool, err := pg.ConnectDB(ctx, connConfig)
 		if err != nil {
-			err = fmt.Errorf("unable to connect to database: %w", err)
+			err = fmt.Errorf("unable to grant on foreign servers and large objects: %w", err)
 			return
 		}
+	}
 
-		defer tmpPool.Close()
+	pg.annotate(ctx, pg.db, "create-schema", append(operation, "phase=users")...)
 
-		conn, err := tmpPool.Acquire(ctx)
+	if dualUsers() {
+		var tenantDualUsers DualSchemaUsers
+		tenantDualUsers, err = pg.NewTenantSchemaDualUsers(ctx, roleNamePrefix, schemaName)
 		if err != nil {
-			err = fmt.Errorf("unable to acquire connection: %w", err)
+			err = fmt.Errorf("unable to create schema users: %w", err)
 			return
 		}
 
-		defer conn.Release()
+		credentials = tenantDualUsers
 
-		pg.RunExec(conn, ctx, grantSchemaAdminCreate)
-		pg.RunExec(conn, ctx, grantSchemaAdminTables)
-		pg.RunExec(conn, ctx, grantSchemaAdminSequences)
+		var usernames []string
+		for _, dual := range []DualUserCredentials{tenantDualUsers.Admin, tenantDualUsers.ReadWrite, tenantDualUsers.ReadOnly} {
+			usernames = append(usernames, dual.A.Username, dual.B.Username)
+		}
 
-		pg.RunExec(conn, ctx, grantSchemaUsage)
-		pg.RunExec(conn, ctx, grantTablesRead)
-		pg.RunExec(conn, ctx, grantSequencesRead)
+		err = pg.setPgauditLog(ctx, usernames...)
+		if err != nil {
+			return
+		}
 
-		pg.RunExec(conn, ctx, grantDefaultSequencesRead)
-		pg.RunExec(conn, ctx, grantDefaultSequencesWrite)
-		pg.RunExec(conn, ctx, grantDefaultTablesRead)
-		pg.RunExec(conn, ctx, grantDefaultTablesReadWrite)
+		if tempSchema() {
+			err = pg.ensureTenantTempSchema(ctx, dbName, schemaName, tenantGroups, tenantDualUsers.ReadWrite.A.Username, tenantDualUsers.ReadWrite.B.Username)
+			if err != nil {
+				return
+			}
+		}
 
+		tenantDualUsers.CDC, err = pg.newCDCUser(ctx, roleNamePrefix, schemaName, dbName)
+		credentials = tenantDualUsers
 		return
-	}()
+	}
 
+	tenantUsers, err := pg.NewTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
 	if err != nil {
+		err = fmt.Errorf("unable to create schema users: %w", err)
 		return
 	}
 
-	tenantUsers := pg.NewTenantSchemaUsers(ctx, roleNamePrefix, schemaName)
-
-	func() {
-		outCredsFile := os.Getenv(envVarOutCredsFile)
+	credentials = tenantUsers
 
-		if outCredsFile != "" {
-			tenantUsersData, err := json.Marshal(tenantUsers)
-			if err != nil {
-				err = fmt.Errorf("unable to marshal tenant users data: %w", err)
-				fmt.Fprintf(os.Stderr, "%v\n", err)
-			}
+	err = pg.setPgauditLog(ctx, tenantUsers.Admin.Username, tenantUsers.ReadWrite.Username, tenantUsers.ReadOnly.Username)
+	if err != nil {
+		return
+	}
 
-			err = os.WriteFile(outCredsFile, tenantUsersData, outFileMode)
-			if err != nil {
-				err = fmt.Errorf("unable to write tenant users data: %w", err)
-				fmt.Fprintf(os.Stderr, "%v\n", err)
-			}
+	if tempSchema() {
+		err = pg.ensureTenantTempSchema(ctx, dbName, schemaName, tenantGroups, tenantUsers.ReadWrite.Username)
+		if err != nil {
+			return
 		}
-	}()
+	}
+
+	tenantUsers.CDC, err = pg.newCDCUser(ctx, roleNamePrefix, schemaName, dbName)
+	credentials = tenantUsers
 
 	return
 }
@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestConfigSettings(t *testing.T) {
+	settings := func(opts ...Option) string {
+		config, err := pgxpool.ParseConfig("postgres://app@db/acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := options{config: config}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		return configSettings(o)
+	}
+
+	base := settings(WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(4))
+
+	if got := settings(WithMaxConns(4), WithApplicationName("pg-tenant-setup/v1.0.0")); got != base {
+		t.Errorf("same options compare as different: %q != %q", got, base)
+	}
+
+	for name, opts := range map[string][]Option{
+		"application name": {WithApplicationName("other"), WithMaxConns(4)},
+		"max conns":        {WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(8)},
+		"connect timeout":  {WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(4), WithConnectTimeout(time.Second)},
+		"operator":         {WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(4), WithOperator("alice")},
+	} {
+		if settings(opts...) == base {
+			t.Errorf("%s: different options compare as the same", name)
+		}
+	}
+
+	alice := settings(WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(4), WithOperator("alice"))
+	bob := settings(WithApplicationName("pg-tenant-setup/v1.0.0"), WithMaxConns(4), WithOperator("bob"))
+	if alice == bob {
+		t.Errorf("different operators compare as the same: %q", alice)
+	}
+}
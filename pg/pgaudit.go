@@ -0,0 +1,61 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+func pgauditLog() string {
+	return os.Getenv(envVarPgauditLog)
+}
+
+func pgauditRole() string {
+	return os.Getenv(envVarPgauditRole)
+}
+
+// pgaudit object auditing logs statements on objects the role named by
+// pgaudit.role has privileges on, so the audit role gets the same privileges
+// as the readwrite group on the tenant schema.
+func pgauditGrants(schemaName string) (grants []string, defaultPrivileges []string) {
+	auditor := pgauditRole()
+	if auditor == "" {
+		return
+	}
+
+	grants = []string{
+		fmt.Sprintf("GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA %s TO %s;", schemaName, auditor),
+	}
+
+	defaultPrivileges = []string{
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA %s GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO %s;", schemaName, auditor),
+	}
+
+	return
+}
+
+// setPgauditLog turns on session auditing for the tenant's login roles.
+// pgaudit.log can only be set by a superuser, and role settings are not
+// inherited through groups, so it is set on every user.
+func (pg *Postgres) setPgauditLog(ctx context.Context, usernames ...string) (err error) {
+	classes := pgauditLog()
+	if classes == "" {
+		return
+	}
+
+	if leastPrivilege() {
+		warnf("least-privilege mode: skipping pgaudit.log, a superuser must set it on the tenant users\n")
+		return
+	}
+
+	for _, username := range usernames {
+		setLog := fmt.Sprintf("ALTER ROLE %s SET pgaudit.log = '%s';", username, classes)
+		_, err = pg.RunExec(ctx, pg.db, setLog)
+		if err != nil {
+			err = fmt.Errorf("unable to set pgaudit.log on %s: %w", username, err)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,84 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func pooler() string {
+	return os.Getenv(envVarPooler)
+}
+
+func tomlString(s string) string {
+	return strconv.Quote(s)
+}
+
+// pgcatPool renders a pgcat pool for the users of one tenant schema. The pool
+// is named after the schema's role prefix, which is what clients use as the
+// database name when connecting through pgcat, so that schemas sharing a
+// database still get pools of their own. CDC users stream from the server
+// directly and are left out.
+func (pg *Postgres) pgcatPool(credentials any, dbName string, poolName string) string {
+	var users []UserCredentials
+	switch creds := credentials.(type) {
+	case SchemaUsers:
+		users = []UserCredentials{creds.Admin, creds.ReadWrite, creds.ReadOnly}
+	case DualSchemaUsers:
+		for _, dual := range []DualUserCredentials{creds.Admin, creds.ReadWrite, creds.ReadOnly} {
+			users = append(users, dual.A, dual.B)
+		}
+	}
+
+	config := pg.db.Config().ConnConfig
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[pools.%s]\n", tomlString(poolName))
+	fmt.Fprintf(&b, "pool_mode = \"transaction\"\n\n")
+
+	for i, user := range users {
+		fmt.Fprintf(&b, "[pools.%s.users.%d]\n", tomlString(poolName), i)
+		fmt.Fprintf(&b, "username = %s\n", tomlString(user.Username))
+		// withheld passwords are left for pgcat's auth_query
+		if user.Password != "" {
+			fmt.Fprintf(&b, "password = %s\n", tomlString(user.Password))
+		}
+		fmt.Fprintf(&b, "pool_size = 10\n\n")
+	}
+
+	fmt.Fprintf(&b, "[pools.%s.shards.0]\n", tomlString(poolName))
+	fmt.Fprintf(&b, "servers = [[%s, %d, \"primary\"]]\n", tomlString(config.Host), config.Port)
+	fmt.Fprintf(&b, "database = %s\n", tomlString(dbName))
+
+	return b.String()
+}
+
+// poolerConfig renders the configured pooler's entries for a tenant schema
+func (pg *Postgres) poolerConfig(credentials any, dbName string, schemaName string, tenantName string) (config string, ok bool) {
+	if pooler() != poolerPgcat || credentials == nil {
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	return pg.pgcatPool(credentials, dbName, tenantSchemaPrefix(roleNamePrefix, schemaName)), true
+}
+
+// writePoolerConfig writes the pooler configuration of the schemas created
+// in this run, one pool per schema, to be included in the pooler's config
+// file. The file holds passwords, so it gets the credentials file mode.
+func writePoolerConfig(pools []string) {
+	filename := os.Getenv(envVarPoolerFile)
+	if dryRun() || filename == "" || len(pools) == 0 {
+		return
+	}
+
+	err := writeFileAtomic(filename, []byte(strings.Join(pools, "\n")), outFileMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write pooler config: %v\n", err)
+	}
+}
@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const defaultPoolConns = 1
+
+func poolConns(key string) (n int32) {
+	n = defaultPoolConns
+	if v := os.Getenv(key); v != "" {
+		i, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || i < 1 {
+			warnf("ignoring invalid %s %q\n", key, v)
+			return
+		}
+		n = int32(i)
+	}
+	return
+}
+
+// poolMaxConns sizes the pools to other databases. One connection keeps the
+// statements of a run in order, more let bulk runs fan out where that's safe.
+func poolMaxConns() int32 {
+	return poolConns(envVarPoolMaxConns)
+}
+
+func poolMinConns() int32 {
+	return min(poolConns(envVarPoolMinConns), poolMaxConns())
+}
+
+// ValidatePoolSize checks the pool sizing settings before any connection is
+// made.
+func ValidatePoolSize() error {
+	for _, key := range []string{envVarPoolMaxConns, envVarPoolMinConns} {
+		if v := os.Getenv(key); v != "" {
+			if i, err := strconv.ParseInt(v, 10, 32); err != nil || i < 1 {
+				return fmt.Errorf("invalid connection pool size %q, must be a positive number", v)
+			}
+		}
+	}
+	return nil
+}
+
+// fanOut runs fn for each item over up to MaxConns connections to the same
+// database. Only statements that never touch the same catalog row may fan
+// out: concurrent grants on one object fail with "tuple concurrently
+// updated". Every connection gets the operation annotation. The first error
+// stops the remaining items.
+func (pg *Postgres) fanOut(ctx context.Context, connConfig ConnectDBConfig, operation string, fields []string, items []string, fn func(conn PGConnQuerier, item string) error) (err error) {
+	if connConfig.MaxConns == 0 {
+		connConfig.MaxConns = poolMaxConns()
+	}
+
+	workers := min(int(connConfig.MaxConns), len(items))
+	if dryRun() || workers <= 1 {
+		return pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+			pg.annotate(ctx, conn, operation, fields...)
+			for _, item := range items {
+				err = fn(conn, item)
+				if err != nil {
+					return
+				}
+			}
+			return
+		})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan string)
+	errs := make(chan error, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+				pg.annotate(ctx, conn, operation, fields...)
+				for item := range queue {
+					err = fn(conn, item)
+					if err != nil {
+						return
+					}
+				}
+				return
+			})
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}()
+	}
+
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+
+	wg.Wait()
+	close(errs)
+
+	// the other workers fail with context.Canceled once one fails
+	for e := range errs {
+		if e != nil && (err == nil || errors.Is(err, context.Canceled)) {
+			err = e
+		}
+	}
+	return
+}
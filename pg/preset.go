@@ -0,0 +1,167 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// grantMatrix is what the schema groups may do besides using the schema; the
+// admin group always gets ALL on the schema's tables and sequences. Presets
+// are named matrices.
+type grantMatrix struct {
+	// database privileges of each schema group, CONNECT is always granted
+	database map[string][]string
+	// privileges of the readwrite group on tables the owner creates
+	readWriteTables []string
+	// whether the readonly group may read sequences
+	readOnlySequences bool
+}
+
+var grantPresets = map[string]grantMatrix{
+	// no temporary tables, and sequences are only for the groups that write
+	presetStrict: {
+		readWriteTables: []string{"SELECT", "INSERT", "UPDATE", "DELETE"},
+	},
+	presetStandard: {
+		database:          allGroups("TEMPORARY"),
+		readWriteTables:   []string{"SELECT", "INSERT", "UPDATE", "DELETE"},
+		readOnlySequences: true,
+	},
+	// the readwrite group may also empty tables and reference them in
+	// foreign keys of its own
+	presetPermissive: {
+		database:          allGroups("TEMPORARY"),
+		readWriteTables:   []string{"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES"},
+		readOnlySequences: true,
+	},
+}
+
+func allGroups(privileges ...string) map[string][]string {
+	return map[string][]string{
+		roleAdmin:     privileges,
+		roleReadWrite: privileges,
+		roleReadOnly:  privileges,
+	}
+}
+
+func ValidatePreset(preset string) error {
+	if preset == "" {
+		return nil
+	}
+
+	if _, ok := grantPresets[preset]; !ok {
+		return fmt.Errorf("unknown preset %q, supported presets: %s, %s, %s", preset, presetStrict, presetStandard, presetPermissive)
+	}
+
+	return nil
+}
+
+func currentGrantMatrix() grantMatrix {
+	if matrix, ok := grantPresets[os.Getenv(envVarPreset)]; ok {
+		return matrix
+	}
+	return grantPresets[presetStandard]
+}
+
+func databasePrivilegesEnvVar(kind string) string {
+	switch kind {
+	case roleAdmin:
+		return envVarAdminDBPrivs
+	case roleReadWrite:
+		return envVarRWDBPrivs
+	case roleReadOnly:
+		return envVarRODBPrivs
+	}
+
+	return ""
+}
+
+// databasePrivileges returns the database privileges of a schema group
+// besides CONNECT: the configured ones (e.g. "CONNECT,TEMPORARY"), or those
+// of the preset. CREATE would let the group create schemas outside its own.
+// With a temp schema the preset's TEMPORARY is left out, since the temp
+// schema replaces it.
+func databasePrivileges(kind string) (privileges []string, err error) {
+	envVar := databasePrivilegesEnvVar(kind)
+
+	value := os.Getenv(envVar)
+	if value == "" {
+		for _, privilege := range currentGrantMatrix().database[kind] {
+			if tempSchema() && privilege == "TEMPORARY" {
+				continue
+			}
+			privileges = append(privileges, privilege)
+		}
+		return
+	}
+
+	for _, privilege := range strings.Split(value, ",") {
+		switch privilege = strings.ToUpper(strings.TrimSpace(privilege)); privilege {
+		case "", "CONNECT":
+		case "TEMPORARY", "TEMP":
+			privileges = append(privileges, "TEMPORARY")
+		case "CREATE":
+			err = fmt.Errorf("CREATE on the database is never granted to schema groups, remove it from %s", envVar)
+			return
+		default:
+			err = fmt.Errorf("unsupported database privilege %s in %s", privilege, envVar)
+			return
+		}
+	}
+
+	return
+}
+
+// databaseGrants gives each schema group CONNECT and its database privileges,
+// and takes away TEMPORARY from the groups that don't get it, so that
+// reconciling applies a stricter configuration
+func databaseGrants(dbName string, tenantGroups SchemaGroups) (grants []string, err error) {
+	var order []string
+	granted := map[string][]string{}
+	var revoked []string
+
+	for _, group := range []struct {
+		kind string
+		name string
+	}{
+		{roleAdmin, tenantGroups.Admin},
+		{roleReadWrite, tenantGroups.ReadWrite},
+		{roleReadOnly, tenantGroups.ReadOnly},
+	} {
+		var privileges []string
+		privileges, err = databasePrivileges(group.kind)
+		if err != nil {
+			return
+		}
+
+		privilegeList := strings.Join(append([]string{"CONNECT"}, privileges...), ", ")
+		if _, ok := granted[privilegeList]; !ok {
+			order = append(order, privilegeList)
+		}
+		granted[privilegeList] = append(granted[privilegeList], group.name)
+
+		if !containsPrivilege(privileges, "TEMPORARY") {
+			revoked = append(revoked, group.name)
+		}
+	}
+
+	for _, privilegeList := range order {
+		grants = append(grants, fmt.Sprintf("GRANT %s ON DATABASE %s TO %s;", privilegeList, dbName, strings.Join(granted[privilegeList], ", ")))
+	}
+
+	if len(revoked) > 0 {
+		grants = append(grants, fmt.Sprintf("REVOKE TEMPORARY ON DATABASE %s FROM %s;", dbName, strings.Join(revoked, ", ")))
+	}
+
+	return
+}
+
+func containsPrivilege(privileges []string, privilege string) bool {
+	for _, p := range privileges {
+		if strings.EqualFold(p, privilege) {
+			return true
+		}
+	}
+	return false
+}
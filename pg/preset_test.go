@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDatabaseGrantsTempSchema(t *testing.T) {
+	groups := tenantSchemaGroupNames("acme", "app")
+	all := groups.Admin + ", " + groups.ReadWrite + ", " + groups.ReadOnly
+
+	tests := []struct {
+		name       string
+		tempSchema string
+		rwPrivs    string
+		want       []string
+	}{
+		{
+			name: "standard preset",
+			want: []string{"GRANT CONNECT, TEMPORARY ON DATABASE acme TO " + all + ";"},
+		},
+		{
+			name:       "temp schema",
+			tempSchema: "true",
+			want: []string{
+				"GRANT CONNECT ON DATABASE acme TO " + all + ";",
+				"REVOKE TEMPORARY ON DATABASE acme FROM " + all + ";",
+			},
+		},
+		{
+			name:       "temp schema with explicit privileges",
+			tempSchema: "true",
+			rwPrivs:    "CONNECT,TEMPORARY",
+			want: []string{
+				"GRANT CONNECT ON DATABASE acme TO " + groups.Admin + ", " + groups.ReadOnly + ";",
+				"GRANT CONNECT, TEMPORARY ON DATABASE acme TO " + groups.ReadWrite + ";",
+				"REVOKE TEMPORARY ON DATABASE acme FROM " + groups.Admin + ", " + groups.ReadOnly + ";",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envVarPreset, "")
+			t.Setenv(envVarTempSchema, tt.tempSchema)
+			t.Setenv(envVarRWDBPrivs, tt.rwPrivs)
+
+			got, err := databaseGrants("acme", groups)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("databaseGrants() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
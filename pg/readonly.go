@@ -0,0 +1,20 @@
+package pg
+
+import (
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// readOnly restricts the tool to catalog queries, for drift reports against
+// production: RunExec refuses every statement, and the server rejects writes
+// from any query that slips past it.
+func readOnly() bool {
+	return os.Getenv(envVarReadOnly) != ""
+}
+
+func setReadOnly(connConfig *pgx.ConnConfig) {
+	if readOnly() {
+		connConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+}
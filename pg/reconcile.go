@@ -0,0 +1,249 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReconcileTenantSchema re-asserts the expected state of one tenant schema
+// without dropping anything: missing roles and the schema are created,
+// ownership, memberships, grants and default privileges are applied again.
+// Only users that had to be created get a password, and only their
+// credentials are written out.
+func (pg *Postgres) ReconcileTenantSchema(ctx context.Context, schemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	err = ValidateTenantName(roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	if connConfig.RoleName == "" {
+		connConfig.RoleName = ownerRole
+	}
+
+	dbExists, err := pg.CheckIfDBExists(ctx, dbName)
+	if err != nil {
+		return
+	}
+
+	if !dbExists {
+		err = fmt.Errorf("database %s does not exist", dbName)
+		return
+	}
+
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName}
+
+	pg.annotate(ctx, pg.db, "reconcile", append(operation, "phase=roles")...)
+
+	tenantGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+
+	for _, groupname := range []string{ownerRole, tenantGroups.Admin, tenantGroups.ReadWrite, tenantGroups.ReadOnly} {
+		err = pg.ensureGroup(ctx, groupname)
+		if err != nil {
+			return
+		}
+	}
+
+	err = pg.recordShortenedOwnerName(ctx, roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	err = pg.recordShortenedGroupNames(ctx, roleNamePrefix, schemaName)
+	if err != nil {
+		return
+	}
+
+	// the supabase profile uses a database it doesn't own
+	if supabaseProfile() {
+		warnf("supabase profile: skipping ALTER DATABASE %s OWNER TO %s\n", dbName, ownerRole)
+	} else {
+		_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s;", dbName, ownerRole))
+		if err != nil {
+			err = fmt.Errorf("unable to set database owner: %w", err)
+			return
+		}
+	}
+
+	dbGrants, err := databaseGrants(dbName, tenantGroups)
+	if err != nil {
+		return
+	}
+
+	for _, grant := range dbGrants {
+		_, err = pg.RunExec(ctx, pg.db, grant)
+		if err != nil {
+			err = fmt.Errorf("unable to grant database privileges: %w", err)
+			return
+		}
+	}
+
+	// the schema may be owned by someone else, so the tool's role fixes it
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "reconcile", append(operation, "phase=schema")...)
+
+		_, err = pg.RunExec(ctx, conn, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s;", schemaName, ownerRole))
+		if err != nil {
+			err = fmt.Errorf("unable to create schema: %w", err)
+			return
+		}
+
+		_, err = pg.RunExec(ctx, conn, fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s;", schemaName, ownerRole))
+		if err != nil {
+			err = fmt.Errorf("unable to set schema owner: %w", err)
+			return
+		}
+
+		_, err = pg.RunExec(ctx, conn, fmt.Sprintf("REVOKE CREATE ON SCHEMA %s FROM PUBLIC;", schemaName))
+		if err != nil {
+			err = fmt.Errorf("unable to revoke schema privileges: %w", err)
+			return
+		}
+
+		for _, grant := range tenantSchemaObjectGrants(tenantGroups) {
+			_, err = pg.RunExec(ctx, conn, grant)
+			if err != nil {
+				err = fmt.Errorf("unable to grant schema privileges: %w", err)
+				return
+			}
+		}
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	grants, defaultPrivileges := tenantSchemaGrants(schemaName, tenantGroups)
+
+	err = pg.withDB(ctx, connConfig, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "reconcile", append(operation, "phase=grants")...)
+
+		for _, grant := range grants {
+			_, err = pg.RunExec(ctx, conn, grant)
+			if err != nil {
+				err = fmt.Errorf("unable to grant privileges: %w", err)
+				return
+			}
+		}
+
+		pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	pg.annotate(ctx, pg.db, "reconcile", append(operation, "phase=users")...)
+
+	schemaUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+	users := []struct {
+		role      string
+		username  string
+		groupname string
+	}{
+		{roleAdmin, schemaUsers.Admin.Username, tenantGroups.Admin},
+		{roleReadWrite, schemaUsers.ReadWrite.Username, tenantGroups.ReadWrite},
+		{roleReadOnly, schemaUsers.ReadOnly.Username, tenantGroups.ReadOnly},
+	}
+
+	created := make(map[string]UserCredentials)
+
+	for _, u := range users {
+		usernames := []string{u.username}
+		if dualUsers() {
+			a, b := dualUserNames(u.username)
+			usernames = []string{a, b}
+		}
+
+		for _, username := range usernames {
+			var user UserCredentials
+			var wasCreated bool
+			user, wasCreated, err = pg.ensureUser(ctx, username, u.groupname)
+			if err != nil {
+				err = fmt.Errorf("unable to reconcile user %s: %w", username, err)
+				break
+			}
+
+			if wasCreated {
+				created[username] = user
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	// passwords of users created so far are already set
+	if len(created) > 0 {
+		logf("created %d missing users\n", len(created))
+		outputCredentials(created)
+	}
+
+	if err == nil && tempSchema() {
+		readWriteUsers := []string{schemaUsers.ReadWrite.Username}
+		if dualUsers() {
+			a, b := dualUserNames(schemaUsers.ReadWrite.Username)
+			readWriteUsers = []string{a, b}
+		}
+
+		err = pg.ensureTenantTempSchema(ctx, dbName, schemaName, tenantGroups, readWriteUsers...)
+	}
+
+	return
+}
+
+func (pg *Postgres) ensureGroup(ctx context.Context, groupname string) (err error) {
+	exists, err := pg.CheckIfRoleExists(ctx, groupname)
+	if err != nil || exists {
+		return
+	}
+
+	err = pg.CreateGroup(ctx, groupname)
+	if err != nil {
+		err = fmt.Errorf("unable to create group %s: %w", groupname, err)
+	}
+
+	return
+}
+
+func (pg *Postgres) ensureUser(ctx context.Context, username string, groupname string) (user UserCredentials, created bool, err error) {
+	user.Username = username
+
+	exists, err := pg.CheckIfRoleExists(ctx, username)
+	if err != nil {
+		return
+	}
+
+	if exists {
+		_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("GRANT %s TO %s;", groupname, username))
+		return
+	}
+
+	user.Password, err = initialPassword()
+	if err != nil {
+		return
+	}
+
+	err = pg.CreateUser(ctx, user, groupname)
+	created = err == nil
+
+	return
+}
@@ -0,0 +1,254 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// RenameTenantSchema renames a tenant schema together with the roles named
+// after it, so that later commands still find them. Grants and default
+// privileges reference roles and schemas by OID and survive the rename, but
+// they are re-asserted afterwards for schemas whose privileges were edited by
+// hand. PostgreSQL clears MD5 passwords when a role is renamed, SCRAM ones are
+// kept.
+func (pg *Postgres) RenameTenantSchema(ctx context.Context, schemaName string, newSchemaName string, tenantName string, connConfig ConnectDBConfig) (err error) {
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	dbName := connConfig.DBName
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	if connConfig.RoleName == "" {
+		connConfig.RoleName = tenantOwnerName(roleNamePrefix)
+	}
+
+	oldGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	newGroups := tenantSchemaGroupNames(roleNamePrefix, newSchemaName)
+	oldUsers := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+	newUsers := newTenantSchemaUserCredentials(roleNamePrefix, newSchemaName)
+
+	renames := [][2]string{
+		{oldGroups.Admin, newGroups.Admin},
+		{oldGroups.ReadWrite, newGroups.ReadWrite},
+		{oldGroups.ReadOnly, newGroups.ReadOnly},
+		{tenantSchemaCDCUserName(roleNamePrefix, schemaName), tenantSchemaCDCUserName(roleNamePrefix, newSchemaName)},
+	}
+
+	for _, users := range [][2]UserCredentials{
+		{oldUsers.Admin, newUsers.Admin},
+		{oldUsers.ReadWrite, newUsers.ReadWrite},
+		{oldUsers.ReadOnly, newUsers.ReadOnly},
+	} {
+		oldA, oldB := dualUserNames(users[0].Username)
+		newA, newB := dualUserNames(users[1].Username)
+		renames = append(renames, [2]string{users[0].Username, users[1].Username}, [2]string{oldA, newA}, [2]string{oldB, newB},
+			[2]string{users[0].Username + graceSuffix, users[1].Username + graceSuffix})
+	}
+
+	err = validateNewSchemaName(newSchemaName)
+	if err != nil {
+		return
+	}
+
+	oldPublication := tenantSchemaPublicationName(roleNamePrefix, schemaName)
+	newPublication := tenantSchemaPublicationName(roleNamePrefix, newSchemaName)
+
+	operation := []string{"tenant=" + roleNamePrefix, "database=" + dbName, "schema=" + schemaName, "new-schema=" + newSchemaName}
+
+	if terminateConnections() {
+		err = pg.TerminateGroupSessions(ctx, dbName, oldGroups.Admin, oldGroups.ReadWrite, oldGroups.ReadOnly)
+		if err != nil {
+			err = fmt.Errorf("unable to terminate schema sessions: %w", err)
+			return
+		}
+	}
+
+	grants, defaultPrivileges := tenantSchemaGrants(newSchemaName, newGroups)
+
+	// roles are shared by the cluster but renaming them is transactional, so
+	// the schema, its roles and its publication are renamed in one
+	// transaction on a connection to the tenant database; the schema is owned
+	// by the owner role, the rest by the tool's role
+	return pg.withSessionDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		pg.annotate(ctx, conn, "rename-schema", operation...)
+
+		_, err = pg.RunExec(ctx, conn, "BEGIN;")
+		if err != nil {
+			return
+		}
+
+		defer func() {
+			if err != nil {
+				pg.RunExec(ctx, conn, "ROLLBACK;")
+			}
+		}()
+
+		renameTempSchema, err := tenantTempSchemaExists(ctx, conn, schemaName, oldGroups)
+		if err != nil {
+			return
+		}
+
+		var roleRenames [][2]string
+		for _, rename := range renames {
+			var exists bool
+			err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1);", rename[0]).Scan(&exists)
+			if err != nil {
+				err = fmt.Errorf("unable to check role %s: %w", rename[0], err)
+				return
+			}
+
+			if exists {
+				roleRenames = append(roleRenames, rename)
+			}
+		}
+
+		var renamePublication bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1);", oldPublication).Scan(&renamePublication)
+		if err != nil {
+			err = fmt.Errorf("unable to check publication %s: %w", oldPublication, err)
+			return
+		}
+
+		err = checkRenameTargetsFree(ctx, conn, newSchemaName, renameTempSchema, roleRenames, renamePublication, newPublication)
+		if err != nil {
+			return
+		}
+
+		statements := []string{
+			fmt.Sprintf("SET ROLE %s;", connConfig.RoleName),
+			fmt.Sprintf("ALTER SCHEMA %s RENAME TO %s;", schemaName, newSchemaName),
+			"RESET ROLE;",
+		}
+
+		// the temp schema is owned by the readwrite group, not the owner
+		if renameTempSchema {
+			statements = append(statements, fmt.Sprintf("ALTER SCHEMA %s RENAME TO %s;", tenantTempSchemaName(schemaName), tenantTempSchemaName(newSchemaName)))
+		}
+
+		for _, rename := range roleRenames {
+			statements = append(statements, fmt.Sprintf("ALTER ROLE %s RENAME TO %s;", rename[0], rename[1]))
+		}
+
+		// publications are owned by the tool's role
+		if renamePublication {
+			statements = append(statements, fmt.Sprintf("ALTER PUBLICATION %s RENAME TO %s;", oldPublication, newPublication))
+		}
+
+		for _, sql := range statements {
+			_, err = pg.RunExec(ctx, conn, sql)
+			if err != nil {
+				err = fmt.Errorf("unable to rename tenant schema: %w", err)
+				return
+			}
+		}
+
+		_, err = pg.RunExec(ctx, conn, fmt.Sprintf("SET ROLE %s;", connConfig.RoleName))
+		if err != nil {
+			return
+		}
+
+		for _, grant := range grants {
+			_, err = pg.RunExec(ctx, conn, grant)
+			if err != nil {
+				err = fmt.Errorf("unable to grant privileges: %w", err)
+				return
+			}
+		}
+
+		tag, err := pg.RunExec(ctx, conn, "COMMIT;")
+		if err != nil {
+			return
+		}
+
+		// the server answers COMMIT of a failed transaction with ROLLBACK
+		if tag.String() == "ROLLBACK" {
+			err = fmt.Errorf("unable to rename tenant schema: transaction rolled back")
+			return
+		}
+
+		for _, rename := range roleRenames {
+			logf("renamed role %s to %s\n", rename[0], rename[1])
+		}
+
+		// default privileges are best-effort, so they stay out of the
+		// transaction where a failure would undo the renames
+		pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
+
+		return
+	})
+}
+
+// validateNewSchemaName checks the name a schema is renamed to like the names
+// of streamed requests, and that it fits an identifier, since PostgreSQL
+// would silently truncate it
+func validateNewSchemaName(newSchemaName string) error {
+	policy, err := tenantNamePolicy()
+	if err != nil {
+		return err
+	}
+
+	err = policy.validate("schema name", stripNamespace(newSchemaName))
+	if err != nil {
+		return err
+	}
+
+	if len(newSchemaName) > maxIdentifierLen {
+		return fmt.Errorf("schema name %s is longer than %d characters", newSchemaName, maxIdentifierLen)
+	}
+
+	return nil
+}
+
+// checkRenameTargetsFree fails before anything is renamed when one of the new
+// names is taken, instead of halfway through
+func checkRenameTargetsFree(ctx context.Context, conn PGConnQuerier, newSchemaName string, renameTempSchema bool, roleRenames [][2]string, renamePublication bool, newPublication string) (err error) {
+	schemas := []string{newSchemaName}
+	if renameTempSchema {
+		tempSchemaName := tenantTempSchemaName(newSchemaName)
+		if len(tempSchemaName) > maxIdentifierLen {
+			return fmt.Errorf("temp schema name %s is longer than %d characters", tempSchemaName, maxIdentifierLen)
+		}
+		schemas = append(schemas, tempSchemaName)
+	}
+
+	for _, schema := range schemas {
+		var taken bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1);", schema).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("unable to check schema %s: %w", schema, err)
+		}
+		if taken {
+			return fmt.Errorf("schema %s already exists", schema)
+		}
+	}
+
+	for _, rename := range roleRenames {
+		var taken bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1);", rename[1]).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("unable to check role %s: %w", rename[1], err)
+		}
+		if taken {
+			return fmt.Errorf("role %s already exists", rename[1])
+		}
+	}
+
+	if renamePublication {
+		var taken bool
+		err = conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1);", newPublication).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("unable to check publication %s: %w", newPublication, err)
+		}
+		if taken {
+			return fmt.Errorf("publication %s already exists", newPublication)
+		}
+	}
+
+	return nil
+}
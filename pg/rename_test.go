@@ -0,0 +1,31 @@
+package pg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateNewSchemaName(t *testing.T) {
+	t.Setenv(envVarNameMaxLen, "100")
+
+	tests := []struct {
+		name          string
+		newSchemaName string
+		wantErr       bool
+	}{
+		{"valid", "billing", false},
+		{"injection", "billing; DROP SCHEMA public", true},
+		{"reserved", "pg_billing", true},
+		{"longest", strings.Repeat("b", maxIdentifierLen), false},
+		{"too long", strings.Repeat("b", maxIdentifierLen+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNewSchemaName(tt.newSchemaName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNewSchemaName(%q) = %v, want error %t", tt.newSchemaName, err, tt.wantErr)
+			}
+		})
+	}
+}
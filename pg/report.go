@@ -0,0 +1,123 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type AccessEntry struct {
+	Database         string     `json:"database"`
+	Schema           string     `json:"schema"`
+	Role             string     `json:"role"`
+	Login            bool       `json:"login"`
+	MemberOf         []string   `json:"memberOf"`
+	SchemaPrivileges []string   `json:"schemaPrivileges"`
+	TablePrivileges  []string   `json:"tablePrivileges"`
+	ValidUntil       *time.Time `json:"validUntil,omitempty"`
+	LastRotatedAt    *time.Time `json:"lastRotatedAt,omitempty"`
+}
+
+// managedRoleNames lists every role name this tool may have created for a
+// tenant schema, whether or not it exists
+func managedRoleNames(roleNamePrefix string, schemaName string) (names []string) {
+	groups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+	users := newTenantSchemaUserCredentials(roleNamePrefix, schemaName)
+
+	names = append(names, groups.Admin, groups.ReadWrite, groups.ReadOnly)
+	for _, user := range []UserCredentials{users.Admin, users.ReadWrite, users.ReadOnly} {
+		a, b := dualUserNames(user.Username)
+		names = append(names, user.Username, a, b, user.Username+graceSuffix)
+	}
+	names = append(names, tenantSchemaCDCUserName(roleNamePrefix, schemaName))
+
+	return
+}
+
+// AccessReport lists the managed roles of every schema owned by the tenant
+// in a database, with their memberships and effective privileges. Table
+// privileges are the ones a role holds on every table of the schema.
+func (pg *Postgres) AccessReport(ctx context.Context, dbName string, tenantName string) (entries []AccessEntry, err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		schemaNames, err := tenantSchemaNames(ctx, conn, ownerRole)
+		if err != nil {
+			err = fmt.Errorf("unable to list tenant schemas: %w", err)
+			return
+		}
+
+		for _, schemaName := range schemaNames {
+			lastRotatedAt, err := pg.lastRotations(ctx, schemaName, tenantName, dbName)
+			if err != nil {
+				return err
+			}
+
+			rows, err := conn.Query(ctx,
+				`SELECT r.rolname, r.rolcanlogin, r.rolvaliduntil,
+	coalesce((SELECT array_agg(g.rolname ORDER BY g.rolname) FROM pg_auth_members m JOIN pg_roles g ON g.oid = m.roleid WHERE m.member = r.oid), '{}'),
+	array_remove(ARRAY[
+		CASE WHEN has_schema_privilege(r.oid, n.oid, 'USAGE') THEN 'USAGE' END,
+		CASE WHEN has_schema_privilege(r.oid, n.oid, 'CREATE') THEN 'CREATE' END
+	], NULL),
+	array_remove(ARRAY(
+		SELECT CASE WHEN count(c.oid) > 0 AND bool_and(has_table_privilege(r.oid, c.oid, p.privilege)) THEN p.privilege END
+		FROM unnest(ARRAY['SELECT', 'INSERT', 'UPDATE', 'DELETE', 'TRUNCATE']) WITH ORDINALITY AS p(privilege, ord)
+		LEFT JOIN pg_class c ON c.relnamespace = n.oid AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		GROUP BY p.privilege, p.ord ORDER BY p.ord
+	), NULL)
+FROM pg_roles r, pg_namespace n
+WHERE r.rolname = ANY($1) AND n.nspname = $2
+ORDER BY r.rolname;`,
+				managedRoleNames(roleNamePrefix, schemaName), schemaName,
+			)
+			if err != nil {
+				return fmt.Errorf("unable to report on schema %s: %w", schemaName, err)
+			}
+
+			for rows.Next() {
+				entry := AccessEntry{Database: dbName, Schema: schemaName}
+				err = rows.Scan(&entry.Role, &entry.Login, &entry.ValidUntil, &entry.MemberOf, &entry.SchemaPrivileges, &entry.TablePrivileges)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				if t, ok := lastRotatedAt[entry.Role]; ok {
+					entry.LastRotatedAt = &t
+				}
+				entries = append(entries, entry)
+			}
+
+			rows.Close()
+			if err = rows.Err(); err != nil {
+				return err
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+// lastRotations maps the users of a tenant schema to their latest recorded
+// rotation, from the rotation history in the group comments
+func (pg *Postgres) lastRotations(ctx context.Context, schemaName string, tenantName string, dbName string) (map[string]time.Time, error) {
+	events, err := pg.RotationHistory(ctx, schemaName, tenantName, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	// the history is oldest first, so later rotations win
+	last := make(map[string]time.Time)
+	for _, event := range events {
+		last[event.Username] = event.RotatedAt
+	}
+
+	return last, nil
+}
@@ -0,0 +1,285 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The rollback script is the SQL log inverted statement by statement and
+// played backwards: what was created is dropped, what was granted is revoked
+// and what was revoked is granted again. Statements without a safe inverse,
+// such as password changes or anything from a blueprint, are listed as
+// comments for a person to review. Idempotent statements, such as CREATE
+// SCHEMA IF NOT EXISTS or a grant to a role that existed before the run, may
+// have found what they assert in place, so they have no safe inverse either.
+
+type rollbackStatement struct {
+	dbName   string
+	roleName string
+	sql      string
+}
+
+// operations of one process write to the same rollback file
+var rollbackFileMu sync.Mutex
+
+var (
+	createRolePattern     = regexp.MustCompile(`(?is)^CREATE\s+(?:ROLE|USER)\s+(\S+)`)
+	createDatabasePattern = regexp.MustCompile(`(?is)^CREATE\s+DATABASE\s+(\S+?);?$`)
+	createSchemaPattern   = regexp.MustCompile(`(?is)^CREATE\s+SCHEMA\s+(IF\s+NOT\s+EXISTS\s+)?([^\s;]+)`)
+	createPubPattern      = regexp.MustCompile(`(?is)^CREATE\s+PUBLICATION\s+(\S+)`)
+	renamePattern         = regexp.MustCompile(`(?is)^ALTER\s+(ROLE|SCHEMA|PUBLICATION)\s+(\S+)\s+RENAME\s+TO\s+([^\s;]+);?$`)
+	commentPattern        = regexp.MustCompile(`(?is)^COMMENT\s+ON\s+(DATABASE|SCHEMA|ROLE)\s+(\S+)\s+IS\s+'`)
+	grantPattern          = regexp.MustCompile(`(?is)^(ALTER\s+DEFAULT\s+PRIVILEGES\s+.*?)?GRANT\s+(.*)\s+TO\s+(.*?)(?:\s+WITH\s+(?:GRANT|ADMIN|INHERIT|SET)\s+OPTION)?;?$`)
+	revokePattern         = regexp.MustCompile(`(?is)^(ALTER\s+DEFAULT\s+PRIVILEGES\s+.*?)?REVOKE\s+(.*)\s+FROM\s+(.*?)(?:\s+(?:CASCADE|RESTRICT))?;?$`)
+	sessionOnlyPattern    = regexp.MustCompile(`(?is)^(SET|RESET|SELECT|BEGIN|COMMIT|ROLLBACK)\b`)
+	grantOptionForPattern = regexp.MustCompile(`(?is)^(GRANT|ADMIN|INHERIT|SET)\s+OPTION\s+FOR\b`)
+)
+
+// invertStatement returns the statement undoing sql, or ok false when there is
+// no safe inverse. Grants are only inverted when every grantee is one of the
+// roles created by the operation.
+func invertStatement(sql string, created map[string]bool) (inverse string, ok bool) {
+	switch {
+	case createRolePattern.MatchString(sql):
+		m := createRolePattern.FindStringSubmatch(sql)
+		return fmt.Sprintf("DROP ROLE IF EXISTS %s;", m[1]), true
+	case createDatabasePattern.MatchString(sql):
+		m := createDatabasePattern.FindStringSubmatch(sql)
+		return fmt.Sprintf("DROP DATABASE IF EXISTS %s;", m[1]), true
+	case createSchemaPattern.MatchString(sql):
+		m := createSchemaPattern.FindStringSubmatch(sql)
+		if m[1] != "" {
+			return
+		}
+		return fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE;", m[2]), true
+	case createPubPattern.MatchString(sql):
+		m := createPubPattern.FindStringSubmatch(sql)
+		return fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", m[1]), true
+	case renamePattern.MatchString(sql):
+		m := renamePattern.FindStringSubmatch(sql)
+		return fmt.Sprintf("ALTER %s %s RENAME TO %s;", strings.ToUpper(m[1]), m[3], m[2]), true
+	case commentPattern.MatchString(sql):
+		m := commentPattern.FindStringSubmatch(sql)
+		return fmt.Sprintf("COMMENT ON %s %s IS NULL;", strings.ToUpper(m[1]), m[2]), true
+	case grantPattern.MatchString(sql):
+		m := grantPattern.FindStringSubmatch(sql)
+		if !createdRoles(m[3], created) {
+			return
+		}
+		return fmt.Sprintf("%sREVOKE %s FROM %s;", m[1], m[2], m[3]), true
+	case revokePattern.MatchString(sql):
+		m := revokePattern.FindStringSubmatch(sql)
+		// what REVOKE ALL took away depends on what was held before
+		if grantOptionForPattern.MatchString(m[2]) || strings.HasPrefix(strings.ToUpper(m[2]), "ALL ") {
+			return
+		}
+		return fmt.Sprintf("%sGRANT %s TO %s;", m[1], m[2], m[3]), true
+	}
+
+	return
+}
+
+func createdRoles(grantees string, created map[string]bool) bool {
+	for _, grantee := range strings.Split(grantees, ",") {
+		grantee = strings.ToLower(strings.TrimSpace(grantee))
+		grantee = strings.TrimPrefix(grantee, "group ")
+		if !created[grantee] {
+			return false
+		}
+	}
+	return true
+}
+
+func executorConn(x PGConnExecutor) *pgx.Conn {
+	switch c := x.(type) {
+	case *pgxpool.Conn:
+		return c.Conn()
+	case *pgx.Conn:
+		return c
+	}
+	return nil
+}
+
+func (pg *Postgres) executorDatabase(x PGConnExecutor) string {
+	config := pg.db.Config().ConnConfig
+	if conn := executorConn(x); conn != nil {
+		config = conn.Config()
+	}
+
+	if config.Database != "" {
+		return config.Database
+	}
+	return config.User
+}
+
+// recordRollback adds the inverse of an executed statement to the rollback
+// file, which is rewritten every time so that it stays usable when a run
+// fails halfway
+func (pg *Postgres) recordRollback(ctx context.Context, x PGConnExecutor, sql string) {
+	filename := os.Getenv(envVarRollbackFile)
+	if filename == "" || credentialsStdout() {
+		return
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(sql), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	statement := strings.TrimSpace(strings.Join(lines, "\n"))
+	if statement == "" {
+		return
+	}
+
+	conn := executorConn(x)
+
+	pg.sessionMu.Lock()
+	switch upper := strings.ToUpper(statement); {
+	case strings.HasPrefix(upper, "SET ROLE "):
+		pg.sessionRoles[conn] = strings.TrimSuffix(strings.TrimSpace(statement[len("SET ROLE "):]), ";")
+		pg.sessionMu.Unlock()
+		return
+	case strings.HasPrefix(upper, "RESET ROLE"):
+		delete(pg.sessionRoles, conn)
+		pg.sessionMu.Unlock()
+		return
+	case sessionOnlyPattern.MatchString(statement):
+		pg.sessionMu.Unlock()
+		return
+	}
+	roleName := pg.sessionRoles[conn]
+	pg.sessionMu.Unlock()
+
+	op := pg.operation(ctx)
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if m := createRolePattern.FindStringSubmatch(statement); m != nil {
+		op.created[strings.ToLower(m[1])] = true
+	}
+
+	inverse, ok := "", false
+	if strings.Count(strings.TrimSuffix(statement, ";"), ";") == 0 {
+		inverse, ok = invertStatement(statement, op.created)
+	}
+	if !ok {
+		inverse = "-- no inverse: " + strings.ReplaceAll(redactSQL(statement), "\n", "\n-- ")
+	}
+
+	op.rollback = append(op.rollback, rollbackStatement{
+		dbName:   pg.executorDatabase(x),
+		roleName: roleName,
+		sql:      inverse,
+	})
+
+	writeRollbackFile(filename, op.header, op.rollback)
+}
+
+// writeRollbackFile replaces the section of one operation in the rollback
+// file, keeping those of other runs sharing it. The newest run comes first.
+func writeRollbackFile(filename string, header string, statements []rollbackStatement) {
+	rollbackFileMu.Lock()
+	defer rollbackFileMu.Unlock()
+
+	// the file is replaced on every write, so other processes are kept out
+	// with a lock file next to it
+	lock, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_WRONLY, outFileMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write rollback file: %v\n", err)
+		return
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to lock %s: %v\n", filename, err)
+		return
+	}
+	defer unlockFile(lock)
+
+	existing, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "unable to read rollback file: %v\n", err)
+		return
+	}
+
+	sections := rollbackSections(string(existing))
+	section := rollbackSection(header, statements)
+
+	replaced := false
+	for i := range sections {
+		if strings.HasPrefix(sections[i], header+"\n") {
+			sections[i] = section
+			replaced = true
+		}
+	}
+	if !replaced {
+		sections = append([]string{section}, sections...)
+	}
+
+	content := "-- rollback of the statements executed by pg-tenant-setup, newest first\n" + strings.Join(sections, "")
+
+	err = writeFileAtomic(filename, []byte(content), outFileMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write rollback file: %v\n", err)
+	}
+}
+
+// rollbackSections splits a rollback file into the sections of its runs,
+// dropping the file header
+func rollbackSections(content string) (sections []string) {
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(line, "-- run ") {
+			sections = append(sections, "")
+		}
+		if len(sections) > 0 {
+			sections[len(sections)-1] += line
+		}
+	}
+	return
+}
+
+func rollbackSection(header string, statements []rollbackStatement) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", header)
+
+	dbName, roleName := "", ""
+	for i := len(statements) - 1; i >= 0; i-- {
+		s := statements[i]
+
+		if s.dbName != dbName {
+			if roleName != "" {
+				b.WriteString("RESET ROLE;\n")
+				roleName = ""
+			}
+			fmt.Fprintf(&b, "\\connect %s\n", s.dbName)
+			dbName = s.dbName
+		}
+
+		if s.roleName != roleName {
+			if s.roleName == "" {
+				b.WriteString("RESET ROLE;\n")
+			} else {
+				fmt.Fprintf(&b, "SET ROLE %s;\n", s.roleName)
+			}
+			roleName = s.roleName
+		}
+
+		fmt.Fprintf(&b, "%s\n", s.sql)
+	}
+
+	if roleName != "" {
+		b.WriteString("RESET ROLE;\n")
+	}
+
+	b.WriteString("\n")
+
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package pg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInvertStatement(t *testing.T) {
+	created := map[string]bool{"acme_app_rw_grp": true, "acme_app_ro_grp": true, "acme_app_rw_usr": true}
+
+	tests := []struct {
+		name    string
+		sql     string
+		inverse string
+		ok      bool
+	}{
+		{"create role", "CREATE ROLE acme_app_rw_grp WITH NOLOGIN;", "DROP ROLE IF EXISTS acme_app_rw_grp;", true},
+		{"create user", "CREATE USER acme_app_rw_usr WITH PASSWORD 'secret';", "DROP ROLE IF EXISTS acme_app_rw_usr;", true},
+		{"create database", "CREATE DATABASE acme;", "DROP DATABASE IF EXISTS acme;", true},
+		{"create schema", "CREATE SCHEMA app AUTHORIZATION acme_owner;", "DROP SCHEMA IF EXISTS app CASCADE;", true},
+		{"create schema if not exists", "CREATE SCHEMA IF NOT EXISTS app_tmp AUTHORIZATION acme_app_rw_grp;", "", false},
+		{"create publication", "CREATE PUBLICATION acme_app_pub FOR TABLES IN SCHEMA app;", "DROP PUBLICATION IF EXISTS acme_app_pub;", true},
+		{"rename", "ALTER ROLE acme_app_rw_usr RENAME TO acme_app_rw_usr_old;", "ALTER ROLE acme_app_rw_usr_old RENAME TO acme_app_rw_usr;", true},
+		{"comment", "COMMENT ON DATABASE acme IS 'pg-tenant-setup:purge-after=2026-01-01T00:00:00Z';", "COMMENT ON DATABASE acme IS NULL;", true},
+		{"grant to created roles", "GRANT USAGE ON SCHEMA app TO acme_app_rw_grp, acme_app_ro_grp;", "REVOKE USAGE ON SCHEMA app FROM acme_app_rw_grp, acme_app_ro_grp;", true},
+		{"grant membership", "GRANT acme_app_rw_grp TO acme_app_rw_usr;", "REVOKE acme_app_rw_grp FROM acme_app_rw_usr;", true},
+		{"grant to existing role", "GRANT USAGE ON SCHEMA app TO acme_app_rw_grp, acme_app_adm_grp;", "", false},
+		{"grant to PUBLIC", "GRANT CONNECT ON DATABASE acme TO PUBLIC;", "", false},
+		{
+			"default privileges to created role",
+			"ALTER DEFAULT PRIVILEGES IN SCHEMA app GRANT SELECT ON TABLES TO acme_app_ro_grp;",
+			"ALTER DEFAULT PRIVILEGES IN SCHEMA app REVOKE SELECT ON TABLES FROM acme_app_ro_grp;",
+			true,
+		},
+		{"revoke", "REVOKE TEMPORARY ON DATABASE acme FROM acme_app_ro_grp;", "GRANT TEMPORARY ON DATABASE acme TO acme_app_ro_grp;", true},
+		{"revoke all", "REVOKE ALL ON SCHEMA app FROM PUBLIC;", "", false},
+		{"revoke grant option", "REVOKE GRANT OPTION FOR SELECT ON TABLE app.t FROM acme_app_ro_grp;", "", false},
+		{"password", "ALTER ROLE acme_app_rw_usr WITH PASSWORD 'secret';", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inverse, ok := invertStatement(tt.sql, created)
+			if ok != tt.ok || inverse != tt.inverse {
+				t.Errorf("invertStatement(%q) = %q, %v, want %q, %v", tt.sql, inverse, ok, tt.inverse, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWriteRollbackFileKeepsOtherRuns(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "rollback.sql")
+
+	first := []rollbackStatement{{dbName: "acme", sql: "DROP ROLE IF EXISTS a;"}}
+	second := []rollbackStatement{{dbName: "other", sql: "DROP ROLE IF EXISTS b;"}}
+
+	writeRollbackFile(filename, "-- run 1", first)
+	writeRollbackFile(filename, "-- run 2", second)
+	writeRollbackFile(filename, "-- run 1", append(first, rollbackStatement{dbName: "acme", roleName: "acme_owner", sql: "DROP SCHEMA IF EXISTS app CASCADE;"}))
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `-- rollback of the statements executed by pg-tenant-setup, newest first
+-- run 2
+\connect other
+DROP ROLE IF EXISTS b;
+
+-- run 1
+\connect acme
+SET ROLE acme_owner;
+DROP SCHEMA IF EXISTS app CASCADE;
+RESET ROLE;
+DROP ROLE IF EXISTS a;
+
+`
+	if string(data) != want {
+		t.Errorf("rollback file =\n%s\nwant\n%s", data, want)
+	}
+}
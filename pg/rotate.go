@@ -0,0 +1,306 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (pg *Postgres) RotateTenantSchemaUser(ctx context.Context, schemaName string, tenantName string, role string, gracePeriod time.Duration, connConfig ConnectDBConfig) (creds UserCredentials, err error) {
+	creds, err = pg.rotateTenantSchemaUser(ctx, schemaName, tenantName, role, gracePeriod, connConfig)
+	if err != nil {
+		return
+	}
+
+	if withDSN() {
+		pg.setDSNs(&creds, connConfig.DBName)
+	}
+
+	outputRoleCredentials(role, creds)
+
+	return
+}
+
+func (pg *Postgres) RotateTenantSchemaUsers(ctx context.Context, schemaName string, tenantName string, gracePeriod time.Duration, connConfig ConnectDBConfig) (users SchemaUsers, err error) {
+	users.Admin, err = pg.rotateTenantSchemaUser(ctx, schemaName, tenantName, roleAdmin, gracePeriod, connConfig)
+	if err != nil {
+		return
+	}
+
+	users.ReadWrite, err = pg.rotateTenantSchemaUser(ctx, schemaName, tenantName, roleReadWrite, gracePeriod, connConfig)
+	if err != nil {
+		return
+	}
+
+	users.ReadOnly, err = pg.rotateTenantSchemaUser(ctx, schemaName, tenantName, roleReadOnly, gracePeriod, connConfig)
+	if err != nil {
+		return
+	}
+
+	if withDSN() {
+		users = pg.addDSNs(users, connConfig.DBName).(SchemaUsers)
+	}
+
+	outputCredentials(users)
+
+	return
+}
+
+func (pg *Postgres) rotateTenantSchemaUser(ctx context.Context, schemaName string, tenantName string, role string, gracePeriod time.Duration, connConfig ConnectDBConfig) (creds UserCredentials, err error) {
+
+	if noCredentialsOutput() {
+		err = fmt.Errorf("rotated passwords can't be withheld, unset --no-credentials-output")
+		return
+	}
+
+	if connConfig.DBName == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = connConfig.DBName
+	}
+
+	username, groupname, err := tenantSchemaRoleNames(roleNamePrefix, schemaName, role)
+	if err != nil {
+		return
+	}
+
+	pg.annotate(ctx, pg.db, "rotate-credentials", "tenant="+roleNamePrefix, "schema="+schemaName, "role="+role)
+
+	exists, err := pg.CheckIfRoleExists(ctx, username)
+	if err != nil {
+		return
+	}
+
+	if !exists {
+		err = fmt.Errorf("role %s does not exist", username)
+		return
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return
+	}
+
+	pair, err := pg.rotationPair(ctx, username, time.Now())
+	if err != nil {
+		return
+	}
+
+	if gracePeriod == 0 {
+		// the live user of the pair gets the new password at once
+		creds = UserCredentials{
+			Username: pair.live,
+			Password: password,
+		}
+
+		alterPassword := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD '%s';", pair.live, password)
+		_, err = pg.RunExec(ctx, pg.db, alterPassword)
+		if err != nil {
+			err = fmt.Errorf("unable to rotate password: %w", err)
+			return
+		}
+
+		pg.recordRotation(ctx, groupname, pair.live)
+		return
+	}
+
+	// The live user keeps its name and password until the grace period ends,
+	// and the new password goes to the other user of the pair, so clients can
+	// move over at their own pace. The next rotation with a grace period
+	// swaps them back.
+	creds = UserCredentials{
+		Username: pair.next,
+		Password: password,
+	}
+
+	validUntil := time.Now().Add(gracePeriod).UTC().Format(time.RFC3339)
+
+	if pair.nextExists {
+		enableNext := fmt.Sprintf("ALTER ROLE %s WITH LOGIN PASSWORD '%s' VALID UNTIL 'infinity';", pair.next, password)
+		_, err = pg.RunExec(ctx, pg.db, enableNext)
+		if err != nil {
+			err = fmt.Errorf("unable to rotate password: %w", err)
+			return
+		}
+	} else {
+		err = pg.CreateUser(ctx, creds, groupname)
+		if err != nil {
+			err = fmt.Errorf("unable to create rotated user: %w", err)
+			return
+		}
+
+		// what was set up for the user by name has to be set up for the other
+		err = pg.copyRoleSettings(ctx, pair.live, pair.next)
+		if err != nil {
+			return
+		}
+
+		if role == roleReadWrite {
+			tenantGroups := tenantSchemaGroupNames(roleNamePrefix, schemaName)
+
+			var exists bool
+			err = pg.withDB(ctx, ConnectDBConfig{DBName: connConfig.DBName}, func(conn PGConnQuerier) (err error) {
+				exists, err = tenantTempSchemaExists(ctx, conn, schemaName, tenantGroups)
+				return
+			})
+			if err != nil {
+				return
+			}
+
+			if exists {
+				err = pg.ensureTenantTempSchema(ctx, connConfig.DBName, schemaName, tenantGroups, pair.next)
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	// without an expiry the old password would stay valid
+	expireLive := fmt.Sprintf("ALTER ROLE %s VALID UNTIL '%s';", pair.live, validUntil)
+	_, err = pg.RunExec(ctx, pg.db, expireLive)
+	if err != nil {
+		err = fmt.Errorf("unable to expire role %s: %w", pair.live, err)
+		return
+	}
+
+	pg.recordRotation(ctx, groupname, pair.next)
+
+	logf("%s: %s is live, %s expires at %s\n", role, pair.next, pair.live, validUntil)
+
+	return
+}
+
+// A schema user rotated with a grace period has a second login role, named
+// with graceSuffix, and the two take turns being live. The user that is not
+// live has an expiry.
+type rotationPair struct {
+	live       string
+	next       string
+	nextExists bool
+}
+
+// rotationPair finds the live user of a schema user and its other half. It
+// refuses while a grace period is running, since the user whose password
+// would change is still in use.
+func (pg *Postgres) rotationPair(ctx context.Context, username string, now time.Time) (pair rotationPair, err error) {
+	pair = rotationPair{live: username, next: username + graceSuffix}
+
+	rows, err := pg.db.Query(ctx,
+		"SELECT rolname, rolvaliduntil IS NOT NULL AND rolvaliduntil <> 'infinity', coalesce(rolvaliduntil < $3, false), coalesce(to_char(rolvaliduntil AT TIME ZONE 'UTC', 'YYYY-MM-DD\"T\"HH24:MI:SS\"Z\"'), '') FROM pg_roles WHERE rolname IN ($1, $2);",
+		pair.live, pair.next, now,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to read users of %s: %w", username, err)
+		return
+	}
+	defer rows.Close()
+
+	type state struct {
+		expiring  bool
+		expired   bool
+		expiresAt string
+	}
+	states := map[string]state{}
+
+	for rows.Next() {
+		var name string
+		var st state
+		err = rows.Scan(&name, &st.expiring, &st.expired, &st.expiresAt)
+		if err != nil {
+			return
+		}
+		states[name] = st
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = fmt.Errorf("unable to read users of %s: %w", username, err)
+		return
+	}
+
+	next, ok := states[pair.next]
+	if !ok {
+		return
+	}
+	pair.nextExists = true
+
+	// the user with an expiry is the one being retired
+	switch live := states[pair.live]; {
+	case live.expiring && next.expiring:
+		err = fmt.Errorf("both %s and %s expire, set an expiry on only one of them", pair.live, pair.next)
+	case live.expiring && !live.expired:
+		err = fmt.Errorf("%s is still valid until %s, rotate again once its grace period has ended", pair.live, live.expiresAt)
+	case next.expiring && !next.expired:
+		err = fmt.Errorf("%s is still valid until %s, rotate again once its grace period has ended", pair.next, next.expiresAt)
+	case live.expiring:
+		pair.live, pair.next = pair.next, pair.live
+	}
+
+	return
+}
+
+// copyRoleSettings gives a role the settings set on another with ALTER ROLE
+// ... SET, such as pgaudit.log. Only a superuser can set some of them.
+func (pg *Postgres) copyRoleSettings(ctx context.Context, from string, to string) (err error) {
+	settings, err := collectNames(ctx, pg.db,
+		`SELECT unnest(s.setconfig) FROM pg_db_role_setting s
+JOIN pg_roles r ON r.oid = s.setrole
+WHERE r.rolname = $1 AND s.setdatabase = 0;`,
+		from,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to read settings of role %s: %w", from, err)
+		return
+	}
+
+	for _, setting := range settings {
+		name, value, _ := strings.Cut(setting, "=")
+		_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("ALTER ROLE %s SET %s = '%s';", to, name, strings.ReplaceAll(value, "'", "''")))
+		if err != nil {
+			err = fmt.Errorf("unable to copy setting %s to role %s: %w", name, to, err)
+			return
+		}
+	}
+
+	return
+}
+
+// ReapGraceUsers disables the users of rotation pairs whose grace period ended
+// before now: the expiry only stops password logins, and the old password
+// should not come back to life if the expiry is lifted. The next rotation
+// enables the user again with a new password.
+func (pg *Postgres) ReapGraceUsers(ctx context.Context, now time.Time) (reaped []string, err error) {
+	roleNames, err := collectNames(ctx, pg.db,
+		`SELECT r.rolname FROM pg_roles r
+WHERE r.rolcanlogin AND r.rolvaliduntil < $2
+AND (r.rolname LIKE $1 OR EXISTS (SELECT 1 FROM pg_roles p WHERE p.rolname = r.rolname || $3))
+ORDER BY r.rolname;`,
+		"%"+strings.ReplaceAll(userSuffix+graceSuffix, "_", `\_`), now, graceSuffix,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list expired users: %w", err)
+		return
+	}
+
+	for _, roleName := range roleNames {
+		if !inNamespace(roleName) {
+			continue
+		}
+
+		_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("ALTER ROLE %s WITH NOLOGIN PASSWORD NULL;", roleName))
+		if err != nil {
+			err = fmt.Errorf("unable to disable expired user %s: %w", roleName, err)
+			return
+		}
+
+		reaped = append(reaped, roleName)
+	}
+
+	return
+}
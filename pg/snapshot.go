@@ -0,0 +1,113 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ColumnSnapshot struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default,omitempty"`
+}
+
+type IndexSnapshot struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+type TableSnapshot struct {
+	Name    string           `json:"name"`
+	Kind    string           `json:"kind"`
+	Columns []ColumnSnapshot `json:"columns"`
+	Indexes []IndexSnapshot  `json:"indexes"`
+}
+
+type SchemaSnapshot struct {
+	Database string          `json:"database"`
+	Schema   string          `json:"schema"`
+	Tables   []TableSnapshot `json:"tables"`
+}
+
+// SchemaSnapshot describes the tables, views and their columns and indexes
+// of a schema, in a stable order so that snapshots can be diffed.
+func (pg *Postgres) SchemaSnapshot(ctx context.Context, dbName string, schemaName string) (snapshot SchemaSnapshot, err error) {
+	snapshot.Database = dbName
+	snapshot.Schema = schemaName
+	snapshot.Tables = []TableSnapshot{}
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		rows, err := conn.Query(ctx,
+			`SELECT c.relname,
+	CASE c.relkind WHEN 'r' THEN 'table' WHEN 'p' THEN 'partitioned table' WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view' WHEN 'f' THEN 'foreign table' END
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+ORDER BY c.relname;`,
+			schemaName,
+		)
+		if err != nil {
+			return
+		}
+
+		snapshot.Tables, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (t TableSnapshot, err error) {
+			err = row.Scan(&t.Name, &t.Kind)
+			t.Columns = []ColumnSnapshot{}
+			t.Indexes = []IndexSnapshot{}
+			return
+		})
+		if err != nil {
+			return
+		}
+
+		for i := range snapshot.Tables {
+			t := &snapshot.Tables[i]
+
+			rows, err = conn.Query(ctx,
+				`SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull, pg_get_expr(d.adbin, d.adrelid)
+FROM pg_attribute a
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = format('%I.%I', $1::text, $2::text)::regclass AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum;`,
+				schemaName, t.Name,
+			)
+			if err != nil {
+				return
+			}
+
+			t.Columns, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (c ColumnSnapshot, err error) {
+				err = row.Scan(&c.Name, &c.Type, &c.Nullable, &c.Default)
+				return
+			})
+			if err != nil {
+				return
+			}
+
+			rows, err = conn.Query(ctx,
+				"SELECT indexname, indexdef FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 ORDER BY indexname;",
+				schemaName, t.Name,
+			)
+			if err != nil {
+				return
+			}
+
+			t.Indexes, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (idx IndexSnapshot, err error) {
+				err = row.Scan(&idx.Name, &idx.Definition)
+				return
+			})
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to snapshot schema %s: %w", schemaName, err)
+	}
+
+	return
+}
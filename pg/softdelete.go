@@ -0,0 +1,240 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PendingPurge is a tenant database that was soft-deleted and is waiting for
+// its grace period to end.
+type PendingPurge struct {
+	DBName     string    `json:"db"`
+	TenantName string    `json:"tenant"`
+	PurgeAfter time.Time `json:"purgeAfter"`
+}
+
+// There is no registry to record deadlines in, so the deadline and the tenant
+// name (needed to find the roles) are kept in the object's comment.
+func deadlineComment(marker string, tenantName string, deadline time.Time) string {
+	return fmt.Sprintf("%s=%s tenant=%s", marker, deadline.UTC().Format(time.RFC3339), tenantName)
+}
+
+// parseDeadlineComment reads the deadline from the first line of a comment,
+// the rest is whatever the comment held before
+func parseDeadlineComment(marker string, comment string) (deadline time.Time, tenantName string, ok bool) {
+	line, _, _ := strings.Cut(comment, "\n")
+	for _, field := range strings.Fields(line) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case marker:
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return
+			}
+			deadline = t
+			ok = true
+		case "tenant":
+			tenantName = value
+		}
+	}
+	return
+}
+
+// tenantDBRoleNames lists the owner and every managed role of the tenant
+// schemas in a database
+func (pg *Postgres) tenantDBRoleNames(ctx context.Context, dbName string, roleNamePrefix string) (names []string, err error) {
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		schemaNames, err := tenantSchemaNames(ctx, conn, ownerRole)
+		if err != nil {
+			err = fmt.Errorf("unable to list tenant schemas: %w", err)
+			return
+		}
+
+		for _, schemaName := range schemaNames {
+			names = append(names, managedRoleNames(roleNamePrefix, schemaName)...)
+		}
+
+		return
+	})
+
+	names = append(names, ownerRole)
+
+	return
+}
+
+// SoftDeleteTenantDB disables a tenant database without dropping anything:
+// its login roles get NOLOGIN, CONNECT is revoked, and the purge deadline is
+// recorded for PurgeTenantDBs. Sessions already open are only ended with
+// --terminate-connections.
+func (pg *Postgres) SoftDeleteTenantDB(ctx context.Context, dbName string, tenantName string, gracePeriod time.Duration) (pending PendingPurge, err error) {
+	roleNamePrefix := tenantName
+	if roleNamePrefix == "" {
+		roleNamePrefix = dbName
+	}
+
+	pending = PendingPurge{
+		DBName:     dbName,
+		TenantName: roleNamePrefix,
+		PurgeAfter: time.Now().Add(gracePeriod),
+	}
+
+	pg.annotate(ctx, pg.db, "delete-tenant", "tenant="+roleNamePrefix, "database="+dbName)
+
+	roleNames, err := pg.tenantDBRoleNames(ctx, dbName, roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	existing, err := collectNames(ctx, pg.db,
+		"SELECT rolname FROM pg_roles WHERE rolname = ANY($1) ORDER BY rolname;",
+		roleNames,
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list tenant roles: %w", err)
+		return
+	}
+
+	for _, roleName := range existing {
+		_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("ALTER ROLE %s NOLOGIN;", roleName))
+		if err != nil {
+			err = fmt.Errorf("unable to disable role %s: %w", roleName, err)
+			return
+		}
+	}
+
+	// the tool's own role keeps CONNECT to purge the database later
+	revokeConnect := fmt.Sprintf("REVOKE CONNECT ON DATABASE %s FROM %s;", dbName, strings.Join(append([]string{"PUBLIC"}, existing...), ", "))
+	grantConnect := fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO CURRENT_USER;", dbName)
+
+	for _, stmt := range []string{revokeConnect, grantConnect} {
+		_, err = pg.RunExec(ctx, pg.db, stmt)
+		if err != nil {
+			err = fmt.Errorf("unable to revoke CONNECT: %w", err)
+			return
+		}
+	}
+
+	var comment string
+	err = pg.db.QueryRow(ctx,
+		"SELECT coalesce(shobj_description(oid, 'pg_database'), '') FROM pg_database WHERE datname = $1;",
+		dbName,
+	).Scan(&comment)
+	if err != nil {
+		err = fmt.Errorf("unable to read database comment: %w", err)
+		return
+	}
+
+	// the deadline goes first, in front of what the comment already said
+	if _, _, ok := parseDeadlineComment(purgeAfterComment, comment); ok {
+		_, comment, _ = strings.Cut(comment, "\n")
+	}
+	comment = strings.TrimRight(deadlineComment(purgeAfterComment, roleNamePrefix, pending.PurgeAfter)+"\n"+comment, "\n")
+
+	_, err = pg.RunExec(ctx, pg.db, fmt.Sprintf("COMMENT ON DATABASE %s IS '%s';", dbName, strings.ReplaceAll(comment, "'", "''")))
+	if err != nil {
+		err = fmt.Errorf("unable to record purge deadline: %w", err)
+		return
+	}
+
+	if terminateConnections() {
+		for _, roleName := range existing {
+			err = pg.TerminateRoleSessions(ctx, roleName)
+			if err != nil {
+				err = fmt.Errorf("unable to terminate sessions of role %s: %w", roleName, err)
+				return
+			}
+		}
+	}
+
+	logf("tenant database %s disabled, purge after %s\n", dbName, pending.PurgeAfter.UTC().Format(time.RFC3339))
+
+	return
+}
+
+// PendingPurges lists the soft-deleted tenant databases. The tenant owner
+// owns its database and can write its comment, so only databases owned by
+// the tenant the comment names, and closed to every role but the tool's own,
+// count as soft-deleted.
+func (pg *Postgres) PendingPurges(ctx context.Context) (pending []PendingPurge, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT datname, pg_get_userbyid(datdba), shobj_description(oid, 'pg_database'),
+  EXISTS (
+    SELECT 1 FROM aclexplode(coalesce(datacl, acldefault('d', datdba))) a
+    WHERE a.privilege_type = 'CONNECT' AND a.grantee <> (SELECT oid FROM pg_roles WHERE rolname = current_user)
+  )
+FROM pg_database WHERE shobj_description(oid, 'pg_database') LIKE $1 ORDER BY datname;`,
+		purgeAfterComment+"=%",
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list soft-deleted databases: %w", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbName, owner, comment string
+		var connectable bool
+		err = rows.Scan(&dbName, &owner, &comment, &connectable)
+		if err != nil {
+			return
+		}
+
+		if !inNamespace(dbName) {
+			continue
+		}
+
+		p := PendingPurge{DBName: dbName}
+		var ok bool
+		p.PurgeAfter, p.TenantName, ok = parseDeadlineComment(purgeAfterComment, comment)
+		if !ok {
+			warnf("ignoring database %s with unreadable purge comment %q\n", dbName, comment)
+			continue
+		}
+
+		if owner != tenantOwnerName(p.TenantName) {
+			warnf("ignoring database %s: its purge comment names tenant %s but it is owned by %s\n", dbName, p.TenantName, owner)
+			continue
+		}
+
+		if connectable {
+			warnf("ignoring database %s: it has a purge comment but other roles can still connect to it\n", dbName)
+			continue
+		}
+
+		pending = append(pending, p)
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+// PurgeTenantDBs drops the soft-deleted tenant databases whose grace period
+// ended before now, and returns the ones that were dropped.
+func (pg *Postgres) PurgeTenantDBs(ctx context.Context, now time.Time) (purged []PendingPurge, err error) {
+	pending, err := pg.PendingPurges(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, p := range pending {
+		if p.PurgeAfter.After(now) {
+			verbosef("database %s is kept until %s\n", p.DBName, p.PurgeAfter.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		err = pg.DeleteTenantDB(ctx, p.DBName, p.TenantName)
+		if err != nil {
+			err = fmt.Errorf("unable to purge database %s: %w", p.DBName, err)
+			return
+		}
+
+		purged = append(purged, p)
+	}
+
+	return
+}
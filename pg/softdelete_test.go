@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadlineComment(t *testing.T) {
+	deadline := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		comment    string
+		wantTenant string
+		wantOk     bool
+	}{
+		{"deadline", deadlineComment(purgeAfterComment, "acme", deadline), "acme", true},
+		{"deadline before other content", deadlineComment(purgeAfterComment, "acme", deadline) + "\nbilling tenant=globex", "acme", true},
+		{"deadline after other content", "billing\n" + deadlineComment(purgeAfterComment, "acme", deadline), "", false},
+		{"other marker", deadlineComment(expiresAtComment, "acme", deadline), "", false},
+		{"no comment", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, tenant, ok := parseDeadlineComment(purgeAfterComment, tt.comment)
+			if ok != tt.wantOk {
+				t.Fatalf("parseDeadlineComment(%q) ok = %t, want %t", tt.comment, ok, tt.wantOk)
+			}
+			if ok && (!got.Equal(deadline) || tenant != tt.wantTenant) {
+				t.Errorf("parseDeadlineComment(%q) = %s, %q", tt.comment, got, tenant)
+			}
+		})
+	}
+}
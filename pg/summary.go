@@ -0,0 +1,51 @@
+package pg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (pg *Postgres) Summary() (summary ExecSummary) {
+	pg.statementsMu.Lock()
+	statements := make([]statementStat, len(pg.statements))
+	copy(statements, pg.statements)
+	pg.statementsMu.Unlock()
+
+	for _, stat := range statements {
+		summary.Executed++
+		summary.TotalDuration += stat.duration
+		if stat.failed {
+			summary.Failed++
+		}
+	}
+
+	sorted := statements
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].duration > sorted[j].duration
+	})
+
+	for i := 0; i < len(sorted) && i < summarySlowest; i++ {
+		summary.Slowest = append(summary.Slowest, StatementTiming{SQL: sorted[i].sql, Duration: sorted[i].duration})
+	}
+
+	return
+}
+
+func (s ExecSummary) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "-- statements executed: %d, failed: %d, total duration: %s\n",
+		s.Executed, s.Failed, s.TotalDuration.Round(time.Millisecond))
+
+	if len(s.Slowest) > 0 {
+		fmt.Fprintf(&b, "-- slowest statements:\n")
+	}
+
+	for _, timing := range s.Slowest {
+		fmt.Fprintf(&b, "--   %s  %s\n", timing.Duration.Round(time.Microsecond), strings.Join(strings.Fields(timing.SQL), " "))
+	}
+
+	return b.String()
+}
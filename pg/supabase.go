@@ -0,0 +1,98 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Roles managed by the Supabase platform. Tenant roles must never shadow or
+// alter them.
+var supabaseReservedRoles = []string{
+	"anon",
+	"authenticated",
+	"authenticator",
+	"dashboard_user",
+	"pgbouncer",
+	"postgres",
+	"service_role",
+}
+
+var supabaseReservedPrefixes = []string{"pg_", "supabase"}
+
+func supabaseProfile() bool {
+	return os.Getenv(envVarProfile) == profileSupabase
+}
+
+func checkSupabaseRoleName(roleNamePrefix string) (err error) {
+	if slices.Contains(supabaseReservedRoles, roleNamePrefix) {
+		err = fmt.Errorf("tenant name %s is a reserved Supabase role", roleNamePrefix)
+		return
+	}
+
+	for _, prefix := range supabaseReservedPrefixes {
+		if strings.HasPrefix(roleNamePrefix, prefix) {
+			err = fmt.Errorf("tenant name %s uses the reserved Supabase prefix %s", roleNamePrefix, prefix)
+			return
+		}
+	}
+
+	return
+}
+
+// Supabase projects come with a single database that the platform owns, and
+// the postgres role is not a superuser. Instead of creating a database, the
+// tenant owner role is created and allowed to create schemas in the existing
+// one. Since PostgreSQL 16 a CREATEROLE user only gets ADMIN OPTION on the
+// roles it creates, so membership is granted explicitly for SET ROLE to work.
+func (pg *Postgres) newSupabaseTenantDB(ctx context.Context, dbName string, roleNamePrefix string) (err error) {
+	err = checkSupabaseRoleName(roleNamePrefix)
+	if err != nil {
+		return
+	}
+
+	ownerRole := tenantOwnerName(roleNamePrefix)
+
+	grantOwner := fmt.Sprintf("GRANT %s TO CURRENT_USER;", ownerRole)
+	grantCreate := fmt.Sprintf("GRANT CREATE ON DATABASE %s TO %s;", dbName, ownerRole)
+
+	warnf("supabase profile: skipping CREATE DATABASE, using existing database %s\n", dbName)
+	warnf("supabase profile: skipping REVOKE ALL ON DATABASE %s FROM PUBLIC\n", dbName)
+	warnf("supabase profile: skipping REVOKE CREATE ON SCHEMA public FROM PUBLIC\n")
+
+	pg.annotate(ctx, pg.db, "create-database", "tenant="+roleNamePrefix, "database="+dbName, "profile="+profileSupabase)
+
+	err = pg.DropRole(ctx, ownerRole)
+	if err != nil {
+		return
+	}
+
+	err = pg.CreateGroup(ctx, ownerRole)
+	if err != nil {
+		err = fmt.Errorf("unable to create owner role: %w", err)
+		return
+	}
+
+	err = pg.recordShortenedOwnerName(ctx, roleNamePrefix)
+	if err != nil {
+		pg.DropRole(ctx, ownerRole)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, grantOwner)
+	if err != nil {
+		err = fmt.Errorf("unable to grant owner role membership: %w", err)
+		pg.DropRole(ctx, ownerRole)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, grantCreate)
+	if err != nil {
+		err = fmt.Errorf("unable to grant create on database: %w", err)
+		pg.DropRole(ctx, ownerRole)
+	}
+
+	return
+}
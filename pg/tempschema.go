@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A temp schema gives the readwrite users a scratch area next to their
+// schema, so that TEMPORARY on the database can be revoked. It is owned by
+// the readwrite group; tables in it are owned by the user that created them,
+// so each readwrite user's default privileges share them with the group and
+// with the admin group.
+
+func tempSchema() bool {
+	return os.Getenv(envVarTempSchema) != ""
+}
+
+func tenantTempSchemaName(schemaName string) string {
+	return schemaName + tempSchemaSuffix
+}
+
+// ensureTenantTempSchema creates the temp schema of a tenant schema, or
+// re-asserts its ownership and privileges when it exists
+func (pg *Postgres) ensureTenantTempSchema(ctx context.Context, dbName string, schemaName string, tenantGroups SchemaGroups, readWriteUsers ...string) (err error) {
+	tempSchemaName := tenantTempSchemaName(schemaName)
+	if len(tempSchemaName) > maxIdentifierLen {
+		err = fmt.Errorf("temp schema name %s is longer than %d characters", tempSchemaName, maxIdentifierLen)
+		return
+	}
+
+	statements := []string{
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s;", tempSchemaName, tenantGroups.ReadWrite),
+		fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s;", tempSchemaName, tenantGroups.ReadWrite),
+		fmt.Sprintf("REVOKE ALL ON SCHEMA %s FROM PUBLIC;", tempSchemaName),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s;", tempSchemaName, tenantGroups.Admin),
+	}
+
+	var defaultPrivileges []string
+	if len(readWriteUsers) > 0 {
+		defaultAlter := fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s", strings.Join(readWriteUsers, ", "), tempSchemaName)
+		defaultPrivileges = []string{
+			fmt.Sprintf("%s GRANT ALL ON TABLES TO %s, %s;", defaultAlter, tenantGroups.ReadWrite, tenantGroups.Admin),
+			fmt.Sprintf("%s GRANT ALL ON SEQUENCES TO %s, %s;", defaultAlter, tenantGroups.ReadWrite, tenantGroups.Admin),
+		}
+	}
+
+	err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+		for _, sql := range statements {
+			_, err = pg.RunExec(ctx, conn, sql)
+			if err != nil {
+				return
+			}
+		}
+
+		pg.runDefaultPrivileges(ctx, conn, defaultPrivileges...)
+
+		return
+	})
+
+	if err != nil {
+		err = fmt.Errorf("unable to create temp schema %s: %w", tempSchemaName, err)
+	}
+
+	return
+}
+
+// tenantTempSchemaExists reports whether the temp schema of a tenant schema
+// exists in the database conn is connected to. A schema of the same name
+// owned by anyone else isn't the tenant's and is left alone.
+func tenantTempSchemaExists(ctx context.Context, conn PGConnQuerier, schemaName string, tenantGroups SchemaGroups) (exists bool, err error) {
+	err = conn.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1 AND pg_get_userbyid(nspowner) = $2);",
+		tenantTempSchemaName(schemaName), tenantGroups.ReadWrite,
+	).Scan(&exists)
+	if err != nil {
+		err = fmt.Errorf("unable to check for temp schema: %w", err)
+	}
+	return
+}
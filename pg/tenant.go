@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tenant describes everything provisioned for one tenant, for services that
+// embed the package instead of running the CLI. Provision runs the same steps
+// as create-database followed by create-schema for each schema.
+type Tenant struct {
+	// Name is the tenant name roles are prefixed with, the database name
+	// when empty
+	Name    string
+	DB      TenantDB
+	Schemas []SchemaSpec
+}
+
+type TenantDB struct {
+	Name string
+	// Existing skips creating the database, for tenants added to a shared
+	// database or to one provisioned earlier
+	Existing bool
+}
+
+type SchemaSpec struct {
+	Name string
+	// Blueprint is a SQL file or directory applied to the new schema,
+	// overriding PG_TENANT_SETUP_BLUEPRINT
+	Blueprint string
+}
+
+type ProvisionResult struct {
+	Tenant     string                  `json:"tenant"`
+	DBName     string                  `json:"db"`
+	OwnerRole  string                  `json:"owner"`
+	Schemas    []SchemaProvisionResult `json:"schemas"`
+	Statements []string                `json:"statements"`
+}
+
+// Provision creates the tenant's database and schemas, and returns the roles
+// and credentials instead of writing them out. On failure the result holds
+// what was provisioned up to that point, since passwords of users already
+// created are set.
+func (t Tenant) Provision(ctx context.Context, pg *Postgres) (result ProvisionResult, err error) {
+	if t.DB.Name == "" {
+		err = fmt.Errorf("missing database name")
+		return
+	}
+
+	roleNamePrefix := t.Name
+	if roleNamePrefix == "" {
+		roleNamePrefix = t.DB.Name
+	}
+
+	result.Tenant = roleNamePrefix
+	result.DBName = t.DB.Name
+	result.OwnerRole = tenantOwnerName(roleNamePrefix)
+
+	ctx, log := withStatementLog(ctx)
+	defer func() {
+		result.Statements = log.list()
+	}()
+
+	if !t.DB.Existing {
+		err = pg.NewTenantDB(ctx, t.DB.Name, t.Name)
+		if err != nil {
+			err = fmt.Errorf("database %s: %w", t.DB.Name, err)
+			return
+		}
+	}
+
+	for _, spec := range t.Schemas {
+		req := SchemaRequest{DBName: t.DB.Name, SchemaName: spec.Name, TenantName: t.Name, Blueprint: spec.Blueprint}
+
+		var schema SchemaProvisionResult
+		schema, err = pg.provisionTenantSchema(ctx, req.SchemaName, req.TenantName, ConnectDBConfig{DBName: req.DBName}, req.blueprint())
+
+		if schema.Users != nil {
+			if noCredentialsOutput() {
+				schema.Users, _ = withholdPasswords(schema.Users)
+			}
+			result.Schemas = append(result.Schemas, schema)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("schema %s: %w", spec.Name, err)
+			return
+		}
+	}
+
+	return
+}
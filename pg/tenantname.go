@@ -0,0 +1,128 @@
+package pg
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TenantNamePolicy decides which tenant names are acceptable. Tenant names end
+// up in role, schema and database identifiers, which are interpolated into SQL
+// unquoted, so the default pattern is deliberately strict.
+type TenantNamePolicy struct {
+	Pattern   *regexp.Regexp
+	MinLength int
+	MaxLength int
+	Denied    []string
+}
+
+var DefaultTenantNamePolicy = TenantNamePolicy{
+	Pattern:   regexp.MustCompile(`^[a-z][a-z0-9_]*$`),
+	MinLength: 2,
+	MaxLength: 32,
+	Denied:    []string{"postgres", "public", "template0", "template1", "information_schema"},
+}
+
+func (p TenantNamePolicy) Validate(name string) error {
+	return p.validate("tenant name", name)
+}
+
+func (p TenantNamePolicy) validate(kind string, name string) error {
+	if len(name) < p.MinLength {
+		return fmt.Errorf("%s %q is shorter than %d characters", kind, name, p.MinLength)
+	}
+
+	if p.MaxLength > 0 && len(name) > p.MaxLength {
+		return fmt.Errorf("%s %q is longer than %d characters", kind, name, p.MaxLength)
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(name) {
+		return fmt.Errorf("%s %q does not match %s", kind, name, p.Pattern)
+	}
+
+	if slices.Contains(p.Denied, name) {
+		return fmt.Errorf("%s %q is not allowed", kind, name)
+	}
+
+	// the pg_ prefix is reserved for system roles
+	if strings.HasPrefix(name, "pg_") {
+		return fmt.Errorf("%s %q uses the reserved prefix pg_", kind, name)
+	}
+
+	return nil
+}
+
+// tenantNamePolicy is the default policy with any overrides from the environment
+func tenantNamePolicy() (policy TenantNamePolicy, err error) {
+	policy = DefaultTenantNamePolicy
+
+	if v := os.Getenv(envVarNamePattern); v != "" {
+		policy.Pattern, err = regexp.Compile(v)
+		if err != nil {
+			err = fmt.Errorf("invalid tenant name pattern: %w", err)
+			return
+		}
+	}
+
+	if v := os.Getenv(envVarNameMinLen); v != "" {
+		policy.MinLength, err = strconv.Atoi(v)
+		if err != nil {
+			err = fmt.Errorf("invalid tenant name minimum length: %w", err)
+			return
+		}
+	}
+
+	if v := os.Getenv(envVarNameMaxLen); v != "" {
+		policy.MaxLength, err = strconv.Atoi(v)
+		if err != nil {
+			err = fmt.Errorf("invalid tenant name maximum length: %w", err)
+			return
+		}
+	}
+
+	if v := os.Getenv(envVarNameDeny); v != "" {
+		policy.Denied = append(policy.Denied, strings.Split(v, ",")...)
+	}
+
+	return
+}
+
+// ValidateTenantName checks a tenant name against the configured policy
+// before any SQL runs. The namespace prefix isn't part of the tenant name.
+func ValidateTenantName(name string) error {
+	policy, err := tenantNamePolicy()
+	if err != nil {
+		return err
+	}
+
+	return policy.Validate(stripNamespace(name))
+}
+
+// ValidateRequestNames checks the database and schema names of a request
+// against the tenant name policy, for requests from outside the command line
+// whose names would otherwise reach the SQL unchecked.
+func ValidateRequestNames(req SchemaRequest) error {
+	policy, err := tenantNamePolicy()
+	if err != nil {
+		return err
+	}
+
+	err = policy.validate("database name", stripNamespace(req.DBName))
+	if err != nil {
+		return err
+	}
+
+	err = policy.validate("schema name", stripNamespace(req.SchemaName))
+	if err != nil {
+		return err
+	}
+
+	if req.TenantName != "" {
+		return policy.Validate(stripNamespace(req.TenantName))
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package pg
+
+import "testing"
+
+func TestValidateRequestNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     SchemaRequest
+		wantErr bool
+	}{
+		{"valid", SchemaRequest{DBName: "acme", SchemaName: "app", TenantName: "acme"}, false},
+		{"no tenant", SchemaRequest{DBName: "acme", SchemaName: "app"}, false},
+		{"database injection", SchemaRequest{DBName: "acme TO PUBLIC; DROP DATABASE x; --", SchemaName: "app"}, true},
+		{"schema injection", SchemaRequest{DBName: "acme", SchemaName: "app; DROP SCHEMA public"}, true},
+		{"quoted schema", SchemaRequest{DBName: "acme", SchemaName: `"App"`}, true},
+		{"reserved schema", SchemaRequest{DBName: "acme", SchemaName: "pg_catalog"}, true},
+		{"denied schema", SchemaRequest{DBName: "acme", SchemaName: "public"}, true},
+		{"invalid tenant", SchemaRequest{DBName: "acme", SchemaName: "app", TenantName: "Acme"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRequestNames(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRequestNames(%+v) = %v, want error %t", tt.req, err, tt.wantErr)
+			}
+		})
+	}
+}
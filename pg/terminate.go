@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func terminateConnections() bool {
+	return os.Getenv(envVarTerminate) != ""
+}
+
+func (pg *Postgres) TerminateRoleSessions(ctx context.Context, roleName string) (err error) {
+	terminate := fmt.Sprintf(
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = '%s' AND pid <> pg_backend_pid();",
+		roleName,
+	)
+	_, err = pg.RunExec(ctx, pg.db, terminate)
+	return
+}
+
+// terminates sessions in dbName of every login role that is a member of one of the groups
+func (pg *Postgres) TerminateGroupSessions(ctx context.Context, dbName string, groupNames ...string) (err error) {
+	terminate := fmt.Sprintf(
+		`SELECT pg_terminate_backend(a.pid) FROM pg_stat_activity a
+JOIN pg_roles u ON u.rolname = a.usename
+JOIN pg_auth_members m ON m.member = u.oid
+JOIN pg_roles g ON g.oid = m.roleid
+WHERE a.datname = '%s' AND g.rolname IN ('%s') AND a.pid <> pg_backend_pid();`,
+		dbName, strings.Join(groupNames, "', '"),
+	)
+	_, err = pg.RunExec(ctx, pg.db, terminate)
+	return
+}
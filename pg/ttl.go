@@ -0,0 +1,130 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ttl is how long new tenant schemas live before reap deletes them, zero for
+// schemas that don't expire
+func ttl() (time.Duration, error) {
+	v := os.Getenv(envVarTTL)
+	if v == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+
+	return d, nil
+}
+
+type ExpiringSchema struct {
+	DBName     string    `json:"db"`
+	SchemaName string    `json:"schema"`
+	TenantName string    `json:"tenant"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// expireSchema records when a schema expires in its comment, on conn
+// connected to the schema's database as its owner
+func (pg *Postgres) expireSchema(ctx context.Context, conn PGConnQuerier, schemaName string, roleNamePrefix string, expiresAt time.Time) (err error) {
+	_, err = pg.RunExec(ctx, conn, fmt.Sprintf("COMMENT ON SCHEMA %s IS '%s';", schemaName, deadlineComment(expiresAtComment, roleNamePrefix, expiresAt)))
+	if err != nil {
+		err = fmt.Errorf("unable to record schema expiry: %w", err)
+	}
+	return
+}
+
+// ExpiringSchemas lists the schemas created with a TTL in the given
+// databases, or in every database that accepts connections when none are
+// given. Schemas not owned by the tenant their comment names are left out.
+func (pg *Postgres) ExpiringSchemas(ctx context.Context, dbNames ...string) (schemas []ExpiringSchema, err error) {
+	if len(dbNames) == 0 {
+		dbNames, err = collectNames(ctx, pg.db, "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname;")
+		if err != nil {
+			err = fmt.Errorf("unable to list databases: %w", err)
+			return
+		}
+	}
+
+	for _, dbName := range dbNames {
+		err = pg.withDB(ctx, ConnectDBConfig{DBName: dbName}, func(conn PGConnQuerier) (err error) {
+			rows, err := conn.Query(ctx,
+				"SELECT nspname, pg_get_userbyid(nspowner), obj_description(oid, 'pg_namespace') FROM pg_namespace WHERE obj_description(oid, 'pg_namespace') LIKE $1 ORDER BY nspname;",
+				expiresAtComment+"=%",
+			)
+			if err != nil {
+				return
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var schemaName, owner, comment string
+				err = rows.Scan(&schemaName, &owner, &comment)
+				if err != nil {
+					return
+				}
+
+				if !inNamespace(schemaName) {
+					continue
+				}
+
+				s := ExpiringSchema{DBName: dbName, SchemaName: schemaName}
+				var ok bool
+				s.ExpiresAt, s.TenantName, ok = parseDeadlineComment(expiresAtComment, comment)
+				if !ok {
+					warnf("ignoring schema %s in database %s with unreadable expiry comment %q\n", schemaName, dbName, comment)
+					continue
+				}
+
+				// the tenant owner can write the comment, so the tenant it
+				// names must be the one that owns the schema
+				if owner != tenantOwnerName(s.TenantName) {
+					warnf("ignoring schema %s in database %s: its expiry comment names tenant %s but it is owned by %s\n", schemaName, dbName, s.TenantName, owner)
+					continue
+				}
+				schemas = append(schemas, s)
+			}
+
+			return rows.Err()
+		})
+
+		if err != nil {
+			err = fmt.Errorf("unable to list expiring schemas in database %s: %w", dbName, err)
+			return
+		}
+	}
+
+	return
+}
+
+// ReapTenantSchemas deletes the tenant schemas whose TTL ended before now,
+// and returns the ones that were deleted.
+func (pg *Postgres) ReapTenantSchemas(ctx context.Context, now time.Time, dbNames ...string) (reaped []ExpiringSchema, err error) {
+	schemas, err := pg.ExpiringSchemas(ctx, dbNames...)
+	if err != nil {
+		return
+	}
+
+	for _, s := range schemas {
+		if s.ExpiresAt.After(now) {
+			verbosef("schema %s in database %s expires at %s\n", s.SchemaName, s.DBName, s.ExpiresAt.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		err = pg.DeleteTenantSchema(ctx, s.SchemaName, s.TenantName, ConnectDBConfig{DBName: s.DBName})
+		if err != nil {
+			err = fmt.Errorf("unable to reap schema %s in database %s: %w", s.SchemaName, s.DBName, err)
+			return
+		}
+
+		reaped = append(reaped, s)
+	}
+
+	return
+}
@@ -2,43 +2,158 @@ package pg
 
 import (
 	"context"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
 const (
-	ownerSuffix        = "_owner"
-	schemaAdminSuffix  = "_schadm"
-	roSuffix           = "_ro"
-	rwSuffix           = "_rw"
-	groupSuffix        = "_grp"
-	userSuffix         = "_usr"
-	envVarOutCredsFile = "PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"
-	envVarOutSQLFile   = "PG_TENANT_SETUP_OUTPUT_SQL_FILE"
-	envVarHaltOnError  = "PG_TENANT_SETUP_HALT_ON_ERROR"
-	outFileMode        = 0600
+	ownerSuffix          = "_owner"
+	schemaAdminSuffix    = "_schadm"
+	roSuffix             = "_ro"
+	rwSuffix             = "_rw"
+	groupSuffix          = "_grp"
+	userSuffix           = "_usr"
+	cdcSuffix            = "_cdc"
+	publicationSuffix    = "_pub"
+	slotSuffix           = "_slot"
+	graceSuffix          = "_alt"
+	tempSchemaSuffix     = "_tmp"
+	dualSuffixA          = "_a"
+	dualSuffixB          = "_b"
+	liveUserComment      = "pg-tenant-setup:live"
+	controlRoleComment   = "pg-tenant-setup:control"
+	purgeAfterComment    = "pg-tenant-setup:purge-after"
+	expiresAtComment     = "pg-tenant-setup:expires-at"
+	rotatedAtComment     = "pg-tenant-setup:rotated-at"
+	shortenedFromComment = "pg-tenant-setup:shortened-from"
+	envVarTTL            = "PG_TENANT_SETUP_TTL"
+	envVarNamespace      = "PG_TENANT_SETUP_NAMESPACE"
+	envVarReadOnly       = "PG_TENANT_SETUP_READ_ONLY"
+	envVarRollbackFile   = "PG_TENANT_SETUP_OUTPUT_ROLLBACK_FILE"
+	envVarPoolMaxConns   = "PG_TENANT_SETUP_POOL_MAX_CONNS"
+	envVarPoolMinConns   = "PG_TENANT_SETUP_POOL_MIN_CONNS"
+	roleAdmin            = "admin"
+	roleReadWrite        = "readwrite"
+	roleReadOnly         = "readonly"
+	roleCDC              = "cdc"
+	envVarOutCredsFile   = "PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"
+	envVarOutSQLFile     = "PG_TENANT_SETUP_OUTPUT_SQL_FILE"
+	envVarHaltOnError    = "PG_TENANT_SETUP_HALT_ON_ERROR"
+	envVarCredsStdout    = "PG_TENANT_SETUP_CREDENTIALS_STDOUT"
+	envVarSplitCreds     = "PG_TENANT_SETUP_SPLIT_CREDENTIALS"
+	envVarDualUsers      = "PG_TENANT_SETUP_DUAL_USERS"
+	envVarDryRun         = "PG_TENANT_SETUP_DRY_RUN"
+	envVarQuiet          = "PG_TENANT_SETUP_QUIET"
+	envVarVerbose        = "PG_TENANT_SETUP_VERBOSE"
+	envVarSummary        = "PG_TENANT_SETUP_SUMMARY"
+	envVarLockTimeout    = "PG_TENANT_SETUP_LOCK_TIMEOUT"
+	envVarStmtTimeout    = "PG_TENANT_SETUP_STATEMENT_TIMEOUT"
+	envVarTerminate      = "PG_TENANT_SETUP_TERMINATE_CONNECTIONS"
+	envVarCitus          = "PG_TENANT_SETUP_CITUS"
+	envVarCitusSchema    = "PG_TENANT_SETUP_CITUS_DISTRIBUTE_SCHEMA"
+	envVarProfile        = "PG_TENANT_SETUP_PROFILE"
+	profileSupabase      = "supabase"
+	envVarDialect        = "PG_TENANT_SETUP_DIALECT"
+	dialectYugabyte      = "yugabyte"
+	envVarNamePattern    = "PG_TENANT_SETUP_TENANT_NAME_PATTERN"
+	envVarNameMinLen     = "PG_TENANT_SETUP_TENANT_NAME_MIN_LENGTH"
+	envVarNameMaxLen     = "PG_TENANT_SETUP_TENANT_NAME_MAX_LENGTH"
+	envVarNameDeny       = "PG_TENANT_SETUP_TENANT_NAME_DENY"
+	envVarOwnerAttrs     = "PG_TENANT_SETUP_OWNER_ATTRIBUTES"
+	envVarAdminAttrs     = "PG_TENANT_SETUP_ADMIN_ATTRIBUTES"
+	envVarRWAttrs        = "PG_TENANT_SETUP_READWRITE_ATTRIBUTES"
+	envVarROAttrs        = "PG_TENANT_SETUP_READONLY_ATTRIBUTES"
+	envVarAdminDBPrivs   = "PG_TENANT_SETUP_ADMIN_DATABASE_PRIVILEGES"
+	envVarRWDBPrivs      = "PG_TENANT_SETUP_READWRITE_DATABASE_PRIVILEGES"
+	envVarRODBPrivs      = "PG_TENANT_SETUP_READONLY_DATABASE_PRIVILEGES"
+	envVarCDC            = "PG_TENANT_SETUP_CDC"
+	envVarCDCRDS         = "PG_TENANT_SETUP_CDC_RDS_REPLICATION"
+	envVarDropRepl       = "PG_TENANT_SETUP_DROP_REPLICATION"
+	envVarFDWServers     = "PG_TENANT_SETUP_FOREIGN_SERVERS"
+	envVarLargeObjs      = "PG_TENANT_SETUP_LARGE_OBJECTS"
+	envVarRWSequences    = "PG_TENANT_SETUP_READWRITE_SEQUENCES"
+	rwSequencesSetval    = "setval"
+	rwSequencesDeny      = "deny"
+	envVarPreset         = "PG_TENANT_SETUP_PRESET"
+	envVarTempSchema     = "PG_TENANT_SETUP_TEMP_SCHEMA"
+	presetStrict         = "strict"
+	presetStandard       = "standard"
+	presetPermissive     = "permissive"
+	envVarDumpCompat     = "PG_TENANT_SETUP_PG_DUMP_COMPAT"
+	envVarLeastPriv      = "PG_TENANT_SETUP_LEAST_PRIVILEGE"
+	envVarPgauditLog     = "PG_TENANT_SETUP_PGAUDIT_LOG"
+	envVarPgauditRole    = "PG_TENANT_SETUP_PGAUDIT_ROLE"
+	envVarPwClasses      = "PG_TENANT_SETUP_PASSWORD_CLASSES"
+	envVarPwRequire      = "PG_TENANT_SETUP_PASSWORD_REQUIRE_EACH_CLASS"
+	envVarPwPrefix       = "PG_TENANT_SETUP_PASSWORD_PREFIX"
+	envVarPwSuffix       = "PG_TENANT_SETUP_PASSWORD_SUFFIX"
+	envVarPwStyle        = "PG_TENANT_SETUP_PASSWORD_STYLE"
+	pwStyleRandom        = "random"
+	pwStylePassphrase    = "passphrase"
+	envVarPwWords        = "PG_TENANT_SETUP_PASSPHRASE_WORDS"
+	envVarPwSeparator    = "PG_TENANT_SETUP_PASSPHRASE_SEPARATOR"
+	envVarNoCreds        = "PG_TENANT_SETUP_NO_CREDENTIALS_OUTPUT"
+	envVarBlueprint      = "PG_TENANT_SETUP_BLUEPRINT"
+	envVarAllOrNothing   = "PG_TENANT_SETUP_ALL_OR_NOTHING"
+	envVarWithDSN        = "PG_TENANT_SETUP_WITH_DSN"
+	envVarPooler         = "PG_TENANT_SETUP_POOLER"
+	poolerPgcat          = "pgcat"
+	envVarPoolerFile     = "PG_TENANT_SETUP_POOLER_CONFIG_FILE"
+	outFileMode          = 0600
+	maxIdentifierLen     = 63
+	maxRoleSuffixLen     = 15
+	shortHashLen         = 8
+	applicationName      = "pg-tenant-setup"
+	summarySlowest       = 5
+	defaultLockTimeout   = "10s"
+	defaultStmtTimeout   = "5min"
 )
 
 type PGConnExecutor interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 }
 
+type PGConnQuerier interface {
+	PGConnExecutor
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type PasswordConfig struct {
 	Length         int
 	UseLetters     bool
 	UseSpecial     bool
 	UseNum         bool
 	ExcludeSpecial string `default:"@/"`
+	// RequireEachClass guarantees at least one character of each selected
+	// class, with letters split into lower and upper case
+	RequireEachClass bool
+	// Prefix and Suffix are added around the Length random characters
+	Prefix string
+	Suffix string
+	// Style "passphrase" generates Words dictionary words joined by
+	// Separator instead of random characters
+	Style     string
+	Words     int
+	Separator string
 }
 
 type ConnectDBConfig struct {
 	DBName   string
 	RoleName string
+	// MaxConns sizes the pool for operations that fan out, zero for the
+	// configured default
+	MaxConns int32
 }
 
 type UserCredentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	URI      string `json:"uri,omitempty"`
+	DSN      string `json:"dsn,omitempty"`
+	JDBC     string `json:"jdbc,omitempty"`
 }
 
 type SchemaGroups struct {
@@ -47,8 +162,69 @@ type SchemaGroups struct {
 	ReadOnly  string `json:"readonly"`
 }
 
+type roleCredentials struct {
+	role  string
+	creds any
+}
+
 type SchemaUsers struct {
-	Admin     UserCredentials `json:"admin"`
-	ReadWrite UserCredentials `json:"readwrite"`
-	ReadOnly  UserCredentials `json:"readonly"`
+	Admin     UserCredentials  `json:"admin"`
+	ReadWrite UserCredentials  `json:"readwrite"`
+	ReadOnly  UserCredentials  `json:"readonly"`
+	CDC       *UserCredentials `json:"cdc,omitempty"`
+}
+
+type DualUserCredentials struct {
+	Live string          `json:"live"`
+	A    UserCredentials `json:"a"`
+	B    UserCredentials `json:"b"`
+}
+
+type DualSchemaUsers struct {
+	Admin     DualUserCredentials `json:"admin"`
+	ReadWrite DualUserCredentials `json:"readwrite"`
+	ReadOnly  DualUserCredentials `json:"readonly"`
+	CDC       *UserCredentials    `json:"cdc,omitempty"`
+}
+
+type ProbeResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type ConnectionCheck struct {
+	Username string        `json:"username"`
+	OK       bool          `json:"ok"`
+	Probes   []ProbeResult `json:"probes"`
+}
+
+type statementStat struct {
+	sql      string
+	duration time.Duration
+	failed   bool
+}
+
+type StatementTiming struct {
+	SQL      string        `json:"sql"`
+	Duration time.Duration `json:"duration"`
+}
+
+type ExecSummary struct {
+	Executed      int               `json:"executed"`
+	Failed        int               `json:"failed"`
+	TotalDuration time.Duration     `json:"totalDuration"`
+	Slowest       []StatementTiming `json:"slowest"`
+}
+
+type RoleAttributes struct {
+	Superuser       bool       `json:"superuser"`
+	Inherit         bool       `json:"inherit"`
+	CreateRole      bool       `json:"createrole"`
+	CreateDB        bool       `json:"createdb"`
+	Login           bool       `json:"login"`
+	Replication     bool       `json:"replication"`
+	BypassRLS       bool       `json:"bypassrls"`
+	ConnectionLimit int        `json:"connectionLimit"`
+	ValidUntil      *time.Time `json:"validUntil,omitempty"`
 }
@@ -0,0 +1,103 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SchemaUsage struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+type TenantUsage struct {
+	DBName  string        `json:"db"`
+	Tenant  string        `json:"tenant"`
+	Bytes   int64         `json:"bytes"`
+	Schemas []SchemaUsage `json:"schemas"`
+	Time    time.Time     `json:"time"`
+}
+
+// UsageSnapshot measures every tenant database, i.e. every database owned by
+// a tenant owner role, and the tenant schemas in it. The tenant is the owner
+// role name without its suffix, which is the hashed prefix for tenant names
+// too long to fit.
+func (pg *Postgres) UsageSnapshot(ctx context.Context) (usage []TenantUsage, err error) {
+	rows, err := pg.db.Query(ctx,
+		`SELECT d.datname, r.rolname, pg_database_size(d.oid) FROM pg_database d
+JOIN pg_roles r ON r.oid = d.datdba
+WHERE d.datallowconn AND r.rolname LIKE $1
+ORDER BY d.datname;`,
+		`%`+strings.ReplaceAll(ownerSuffix, "_", `\_`),
+	)
+	if err != nil {
+		err = fmt.Errorf("unable to list tenant databases: %w", err)
+		return
+	}
+
+	var owners []string
+	for rows.Next() {
+		var u TenantUsage
+		var owner string
+		err = rows.Scan(&u.DBName, &owner, &u.Bytes)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		if !inNamespace(u.DBName) {
+			continue
+		}
+		u.Tenant = strings.TrimSuffix(owner, ownerSuffix)
+		usage = append(usage, u)
+		owners = append(owners, owner)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+
+	for i := range usage {
+		usage[i].Time = now
+
+		err = pg.withDB(ctx, ConnectDBConfig{DBName: usage[i].DBName}, func(conn PGConnQuerier) (err error) {
+			rows, err := conn.Query(ctx,
+				`SELECT n.nspname, coalesce(sum(pg_total_relation_size(c.oid)) FILTER (WHERE c.relkind IN ('r', 'm', 'p')), 0)::bigint
+FROM pg_namespace n
+JOIN pg_roles r ON r.oid = n.nspowner
+LEFT JOIN pg_class c ON c.relnamespace = n.oid
+WHERE r.rolname = $1
+GROUP BY n.nspname
+ORDER BY n.nspname;`,
+				owners[i],
+			)
+			if err != nil {
+				return
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var s SchemaUsage
+				err = rows.Scan(&s.Name, &s.Bytes)
+				if err != nil {
+					return
+				}
+				usage[i].Schemas = append(usage[i].Schemas, s)
+			}
+
+			return rows.Err()
+		})
+
+		if err != nil {
+			err = fmt.Errorf("unable to measure schemas of database %s: %w", usage[i].DBName, err)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// YugabyteDB's YSQL layer is based on PostgreSQL 11: DROP DATABASE has no
+// FORCE option, and ALTER DEFAULT PRIVILEGES is not available on older
+// releases.
+func yugabyteDialect() bool {
+	return os.Getenv(envVarDialect) == dialectYugabyte
+}
+
+func (pg *Postgres) dropYugabyteDB(ctx context.Context, dbName string) (err error) {
+	terminate := fmt.Sprintf(
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s' AND pid <> pg_backend_pid();",
+		dbName,
+	)
+	dropDB := fmt.Sprintf("DROP DATABASE IF EXISTS %s;", dbName)
+
+	_, err = pg.RunExec(ctx, pg.db, terminate)
+	if err != nil {
+		err = fmt.Errorf("unable to terminate sessions in database %s: %w", dbName, err)
+		return
+	}
+
+	_, err = pg.RunExec(ctx, pg.db, dropDB)
+	if err != nil {
+		err = fmt.Errorf("unable to drop database %s: %w", dbName, err)
+	}
+
+	return
+}
+
+// default privileges are best-effort everywhere, but on YugabyteDB a failure
+// is expected on some releases and worth surfacing
+func (pg *Postgres) runDefaultPrivileges(ctx context.Context, conn PGConnExecutor, statements ...string) {
+	for _, sql := range statements {
+		_, err := pg.RunExec(ctx, conn, sql)
+		if err != nil && yugabyteDialect() {
+			warnf("yugabyte dialect: default privileges not applied, grant on new objects manually: %v\n", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func reconcile() {
+	var args struct {
+		SchemaName string `cli:"#R, -s, --schema-name, Schema name"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	err := pgInstance.ReconcileTenantSchema(ctx, args.SchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to reconcile tenant: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func renameSchema() {
+	var args struct {
+		SchemaName    string `cli:"#R, -s, --schema-name, Current schema name"`
+		NewSchemaName string `cli:"#R, -n, --new-schema-name, New schema name"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+	args.NewSchemaName = pg.Namespaced(args.NewSchemaName)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	err := pgInstance.RenameTenantSchema(ctx, args.SchemaName, args.NewSchemaName, args.TenantName, pg.ConnectDBConfig{DBName: args.DBName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to rename tenant schema: %v\n", err)
+		exit(1)
+	}
+}
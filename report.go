@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func reportAccess() {
+	var args struct {
+		ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		DBName           string `cli:"#R, -d, --database-name, Database name"`
+		TenantName       string `cli:"-t, --tenant-name, Tenant name"`
+		Format           string `cli:"-f, --format, Output format (csv or json)" default:"csv"`
+		ReadOnly         bool   `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+		Namespace        string `cli:"--namespace, Namespace of the database and tenant names" env:"PG_TENANT_SETUP_NAMESPACE"`
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	setupNamespace(args.Namespace)
+	args.DBName = pg.Namespaced(args.DBName)
+	args.TenantName = pg.Namespaced(args.TenantName)
+
+	if args.Format != "csv" && args.Format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, supported formats: csv, json\n", args.Format)
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	entries, err := pgInstance.AccessReport(ctx, args.DBName, args.TenantName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to build access report: %v\n", err)
+		exit(1)
+	}
+
+	if args.Format == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to marshal access report: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"database", "schema", "role", "login", "member_of", "schema_privileges", "table_privileges", "valid_until", "last_rotated_at"})
+
+	for _, e := range entries {
+		validUntil := ""
+		if e.ValidUntil != nil {
+			validUntil = e.ValidUntil.Format(time.RFC3339)
+		}
+
+		lastRotatedAt := ""
+		if e.LastRotatedAt != nil {
+			lastRotatedAt = e.LastRotatedAt.Format(time.RFC3339)
+		}
+
+		w.Write([]string{
+			e.Database,
+			e.Schema,
+			e.Role,
+			strconv.FormatBool(e.Login),
+			strings.Join(e.MemberOf, " "),
+			strings.Join(e.SchemaPrivileges, " "),
+			strings.Join(e.TablePrivileges, " "),
+			validUntil,
+			lastRotatedAt,
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write access report: %v\n", err)
+		exit(1)
+	}
+}
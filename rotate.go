@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func rotateCredentials() {
+	var args struct {
+		SchemaName  string        `cli:"#R, -s, --schema-name, Schema name"`
+		Role        string        `cli:"-r, --role, Only rotate this user (admin, readwrite or readonly)"`
+		GracePeriod time.Duration `cli:"--grace-period, Give the new password to the other user of a <user>/<user>_alt pair and keep the live one valid for this long; reap disables it afterwards"`
+		CommonArgs
+	}
+	mcli.Parse(&args, catalogCompletion())
+
+	setupOutput(&args.CommonArgs)
+	args.SchemaName = pg.Namespaced(args.SchemaName)
+
+	if args.DualUsers && args.GracePeriod != 0 {
+		fmt.Fprintf(os.Stderr, "--grace-period cannot be used with --dual-users\n")
+		exit(1)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	connConfig := pg.ConnectDBConfig{DBName: args.DBName}
+
+	var err error
+	switch {
+	case args.DualUsers && args.Role != "":
+		_, err = pgInstance.RotateTenantSchemaDualUser(ctx, args.SchemaName, args.TenantName, args.Role, connConfig)
+	case args.DualUsers:
+		_, err = pgInstance.RotateTenantSchemaDualUsers(ctx, args.SchemaName, args.TenantName, connConfig)
+	case args.Role != "":
+		_, err = pgInstance.RotateTenantSchemaUser(ctx, args.SchemaName, args.TenantName, args.Role, args.GracePeriod, connConfig)
+	default:
+		_, err = pgInstance.RotateTenantSchemaUsers(ctx, args.SchemaName, args.TenantName, args.GracePeriod, connConfig)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to rotate credentials: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const defaultVaultField = "connection_string"
+
+var resolvedConnString string
+
+// resolveConnectionString fetches the admin connection string from the secret
+// named by PG_TENANT_SETUP_CONNECTION_SECRET, so that it never shows up in
+// process listings. Like uploads, it goes through the aws and vault CLIs and
+// their usual credential chains. Without a secret connString is returned as is.
+func resolveConnectionString(ctx context.Context, connString string) string {
+	ref := os.Getenv("PG_TENANT_SETUP_CONNECTION_SECRET")
+	if ref == "" {
+		return connString
+	}
+
+	if resolvedConnString != "" {
+		return resolvedConnString
+	}
+
+	secret, err := fetchSecret(ctx, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read connection secret: %v\n", err)
+		exit(1)
+	}
+
+	resolvedConnString = secret
+	return secret
+}
+
+func fetchSecret(ctx context.Context, ref string) (string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(ref, "arn:aws:secretsmanager:"):
+		cmd = exec.CommandContext(ctx, "aws", "secretsmanager", "get-secret-value",
+			"--secret-id", ref, "--query", "SecretString", "--output", "text")
+	case strings.HasPrefix(ref, "vault://"):
+		// vault://secret/tenant-setup#field, the field defaults to connection_string
+		path, field, _ := strings.Cut(strings.TrimPrefix(ref, "vault://"), "#")
+		if field == "" {
+			field = defaultVaultField
+		}
+		cmd = exec.CommandContext(ctx, "vault", "kv", "get", "-field="+field, path)
+	default:
+		return "", fmt.Errorf("unsupported secret %s, must be a Secrets Manager ARN or start with vault://", ref)
+	}
+
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(out))
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", ref)
+	}
+
+	// RDS-managed secrets are JSON documents rather than connection strings
+	if strings.HasPrefix(secret, "{") {
+		return rdsSecretConnString(secret)
+	}
+
+	return secret, nil
+}
+
+type rdsSecret struct {
+	Username string          `json:"username"`
+	Password string          `json:"password"`
+	Host     string          `json:"host"`
+	Port     json.RawMessage `json:"port"`
+	DBName   string          `json:"dbname"`
+}
+
+func rdsSecretConnString(secret string) (string, error) {
+	var s rdsSecret
+	err := json.Unmarshal([]byte(secret), &s)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse secret: %w", err)
+	}
+
+	if s.Host == "" || s.Username == "" {
+		return "", fmt.Errorf("secret has no host or username")
+	}
+
+	// the port is a number in RDS secrets and a string in some hand-made ones
+	port := strings.Trim(string(s.Port), `"`)
+	if port == "" {
+		port = "5432"
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", fmt.Errorf("invalid port %s in secret", port)
+	}
+
+	dbName := s.DBName
+	if dbName == "" {
+		dbName = "postgres"
+	}
+
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(s.Username, s.Password),
+		Host:   s.Host + ":" + port,
+		Path:   "/" + dbName,
+	}
+
+	return u.String(), nil
+}
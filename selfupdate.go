@@ -0,0 +1,336 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jxskiss/mcli"
+)
+
+const defaultReleaseEndpoint = "https://api.github.com/repos/andreswebs/pg-tenant-setup/releases/latest"
+
+// base64 ed25519 public key release binaries are signed with, set at build
+// time with -ldflags "-X main.releasePublicKey=..."
+var releasePublicKey = ""
+
+type release struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+func (r release) asset(name string) (releaseAsset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// releaseAssetName is the binary for this platform, e.g.
+// pg-tenant-setup_linux_amd64 or pg-tenant-setup_windows_amd64.exe. Its
+// signature is the same name with .sig appended, and signs its manifest.
+func releaseAssetName() string {
+	name := fmt.Sprintf("pg-tenant-setup_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// releaseManifest is what a release signature covers: the tag, the asset name
+// and the SHA-256 of the binary, so that a signed binary can't be passed off
+// as another release or platform, e.g.
+// "pg-tenant-setup v1.2.0 pg-tenant-setup_linux_amd64 sha256:<hex>\n"
+func releaseManifest(tag string, name string, binary []byte) []byte {
+	return []byte(fmt.Sprintf("pg-tenant-setup %s %s sha256:%x\n", tag, name, sha256.Sum256(binary)))
+}
+
+// parseVersion reads a semantic version such as v1.2.3 or 1.2.3-rc.1
+func parseVersion(v string) (core [3]int, pre string, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ = strings.Cut(v, "-")
+
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return
+		}
+		core[i] = n
+	}
+
+	return core, pre, true
+}
+
+// compareVersions orders two semantic versions like semver does: a
+// pre-release comes before its release, and pre-release identifiers compare
+// numerically when both are numbers
+func compareVersions(a [3]int, aPre string, b [3]int, bPre string) int {
+	for i := range a {
+		if c := cmp.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.Atoi(aIDs[i])
+		bNum, bErr := strconv.Atoi(bIDs[i])
+
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = cmp.Compare(aNum, bNum)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(aIDs[i], bIDs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(aIDs), len(bIDs))
+}
+
+// managedInstall names the package manager that owns the binary, which
+// should update it instead
+func managedInstall(executable string) string {
+	path := filepath.ToSlash(executable)
+	switch {
+	case strings.Contains(path, "/Cellar/"), strings.Contains(path, "/homebrew/"), strings.Contains(path, "/linuxbrew/"):
+		return "brew upgrade pg-tenant-setup"
+	case strings.Contains(strings.ToLower(path), "/scoop/apps/"):
+		return "scoop update pg-tenant-setup"
+	}
+	return ""
+}
+
+func selfUpdate() {
+	var args struct {
+		Check    bool   `cli:"--check, Only report whether a newer release is available"`
+		Endpoint string `cli:"--endpoint, Release API endpoint" env:"PG_TENANT_SETUP_RELEASE_ENDPOINT"`
+	}
+	mcli.Parse(&args)
+
+	if args.Endpoint == "" {
+		args.Endpoint = defaultReleaseEndpoint
+	}
+
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to locate the running binary: %v\n", err)
+		exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	client := &http.Client{}
+
+	latest, err := fetchRelease(ctx, client, args.Endpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to check for releases: %v\n", err)
+		exit(1)
+	}
+
+	latestVersion, latestPre, ok := parseVersion(latest.TagName)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "release %s is not a semantic version\n", latest.TagName)
+		exit(1)
+	}
+
+	// development builds have no version and take any release
+	current := buildVersionInfo().Version
+	if currentVersion, currentPre, ok := parseVersion(current); ok {
+		switch compareVersions(latestVersion, latestPre, currentVersion, currentPre) {
+		case 0:
+			fmt.Printf("pg-tenant-setup %s is up to date\n", current)
+			return
+		case -1:
+			if args.Check {
+				fmt.Printf("pg-tenant-setup %s is newer than the latest release %s\n", current, latest.TagName)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "release %s is older than the running %s, not downgrading\n", latest.TagName, current)
+			exit(1)
+		}
+	}
+
+	if args.Check {
+		fmt.Printf("pg-tenant-setup %s is available, running %s\n", latest.TagName, current)
+		return
+	}
+
+	if manager := managedInstall(executable); manager != "" {
+		fmt.Fprintf(os.Stderr, "pg-tenant-setup is installed by a package manager, update it with: %s\n", manager)
+		exit(1)
+	}
+
+	if releasePublicKey == "" {
+		fmt.Fprintf(os.Stderr, "this build has no release signing key, so updates can't be verified\n")
+		exit(1)
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		fmt.Fprintf(os.Stderr, "invalid release signing key\n")
+		exit(1)
+	}
+
+	name := releaseAssetName()
+	binaryAsset, ok := latest.asset(name)
+	sigAsset, sigOK := latest.asset(name + ".sig")
+	if !ok || !sigOK {
+		fmt.Fprintf(os.Stderr, "release %s has no signed binary %s\n", latest.TagName, name)
+		exit(1)
+	}
+
+	binary, err := download(ctx, client, binaryAsset.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to download %s: %v\n", name, err)
+		exit(1)
+	}
+
+	sig, err := download(ctx, client, sigAsset.URL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to download %s.sig: %v\n", name, err)
+		exit(1)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(publicKey, releaseManifest(latest.TagName, name, binary), signature) {
+		fmt.Fprintf(os.Stderr, "signature verification of %s failed, not updating\n", name)
+		exit(1)
+	}
+
+	err = replaceExecutable(executable, binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to replace %s: %v\n", executable, err)
+		exit(1)
+	}
+
+	fmt.Printf("updated pg-tenant-setup from %s to %s\n", current, latest.TagName)
+}
+
+func fetchRelease(ctx context.Context, client *http.Client, endpoint string) (r release, err error) {
+	data, err := download(ctx, client, endpoint)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		err = fmt.Errorf("unable to parse release: %w", err)
+		return
+	}
+
+	if r.TagName == "" {
+		err = fmt.Errorf("release has no tag")
+	}
+
+	return
+}
+
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// replaceExecutable writes the new binary next to the running one and renames
+// it into place. Windows can't replace a running executable, but it can
+// rename it out of the way.
+func replaceExecutable(executable string, binary []byte) error {
+	dir := filepath.Dir(executable)
+
+	f, err := os.CreateTemp(dir, ".pg-tenant-setup-update-*")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	_, err = f.Write(binary)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0755)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	old := executable + ".old"
+	if runtime.GOOS == "windows" {
+		os.Remove(old)
+		err = os.Rename(executable, old)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	err = os.Rename(tmp, executable)
+	if err != nil {
+		os.Remove(tmp)
+		if runtime.GOOS == "windows" {
+			os.Rename(old, executable)
+		}
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.2.4", "v1.2.3", 1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.2.3", "v2.0.0", -1},
+		{"v1.2.3-rc.1", "v1.2.3", -1},
+		{"v1.2.3-rc.2", "v1.2.3-rc.10", -1},
+		{"v1.2.3-alpha", "v1.2.3-beta", -1},
+		{"v1.2.3-rc.1", "v1.2.3-rc.1.1", -1},
+		{"v1.2.3+build.5", "v1.2.3", 0},
+	}
+
+	for _, tt := range tests {
+		a, aPre, ok := parseVersion(tt.a)
+		if !ok {
+			t.Fatalf("parseVersion(%q) failed", tt.a)
+		}
+		b, bPre, ok := parseVersion(tt.b)
+		if !ok {
+			t.Fatalf("parseVersion(%q) failed", tt.b)
+		}
+
+		if got := compareVersions(a, aPre, b, bPre); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	for _, v := range []string{"dev", "v1.2", "v1.x.3", ""} {
+		if _, _, ok := parseVersion(v); ok {
+			t.Errorf("parseVersion(%q) succeeded, want failure", v)
+		}
+	}
+}
+
+func TestReleaseManifestBindsReleaseAndPlatform(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte("binary")
+	signature := ed25519.Sign(privateKey, releaseManifest("v1.0.0", "pg-tenant-setup_linux_amd64", binary))
+
+	if !ed25519.Verify(publicKey, releaseManifest("v1.0.0", "pg-tenant-setup_linux_amd64", binary), signature) {
+		t.Error("signature of the signed release doesn't verify")
+	}
+
+	for _, replay := range [][]byte{
+		releaseManifest("v2.0.0", "pg-tenant-setup_linux_amd64", binary),
+		releaseManifest("v1.0.0", "pg-tenant-setup_darwin_arm64", binary),
+		releaseManifest("v1.0.0", "pg-tenant-setup_linux_amd64", []byte("other")),
+	} {
+		if ed25519.Verify(publicKey, replay, signature) {
+			t.Errorf("signature verifies for %q", replay)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+)
+
+type SnapshotArgs struct {
+	SchemaSnapshot       string `cli:"--schema-snapshot, File to write a schema snapshot of each new schema to, for drift detection baselines"`
+	SchemaSnapshotFormat string `cli:"--schema-snapshot-format, Snapshot format: sql (pg_dump --schema-only) or json" default:"sql"`
+}
+
+func (args SnapshotArgs) validate() error {
+	if args.SchemaSnapshotFormat != "sql" && args.SchemaSnapshotFormat != "json" {
+		return fmt.Errorf("unknown --schema-snapshot-format %q, supported formats: sql, json", args.SchemaSnapshotFormat)
+	}
+	return nil
+}
+
+// snapshotFileName keeps one file per schema when many are created:
+// snapshot.sql becomes snapshot.db.schema.sql
+func snapshotFileName(filename string, dbName string, schemaName string, many bool) string {
+	if !many {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%s.%s%s", strings.TrimSuffix(filename, ext), dbName, schemaName, ext)
+}
+
+// writeSnapshot runs after provisioning, migrations and blueprints, so the
+// snapshot is the baseline the tenant starts from.
+func (args SnapshotArgs) writeSnapshot(ctx context.Context, pgInstance *pg.Postgres, connString string, dbName string, schemaName string, many bool) error {
+	if args.SchemaSnapshot == "" {
+		return nil
+	}
+
+	filename := snapshotFileName(args.SchemaSnapshot, dbName, schemaName, many)
+
+	if args.SchemaSnapshotFormat == "sql" {
+		connString, err := pg.ConnStringWithDatabase(connString, dbName)
+		if err != nil {
+			return err
+		}
+
+		connString, password, err := pg.ConnStringWithoutPassword(connString)
+		if err != nil {
+			return err
+		}
+
+		err = runTool(ctx, password, "pg_dump",
+			"--dbname="+connString,
+			"--schema="+schemaName,
+			"--schema-only",
+			"--no-owner",
+			"--no-privileges",
+			"--file="+filename,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to write schema snapshot: %w", err)
+		}
+		return nil
+	}
+
+	snapshot, err := pgInstance.SchemaSnapshot(ctx, dbName, schemaName)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal schema snapshot: %w", err)
+	}
+
+	if os.Getenv("PG_TENANT_SETUP_DRY_RUN") != "" {
+		fmt.Fprintf(os.Stdout, "-- schema snapshot to %s\n", filename)
+		return nil
+	}
+
+	err = os.WriteFile(filename, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write schema snapshot: %w", err)
+	}
+
+	return nil
+}
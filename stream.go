@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+// maximum size of one request line
+const maxStreamLine = 1024 * 1024
+
+func stream() {
+	var args struct {
+		ConnectionString string `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		DualUsers        bool   `cli:"--dual-users, Use blue/green pairs of schema users for zero-downtime rotation" env:"PG_TENANT_SETUP_DUAL_USERS"`
+		Verbose          bool   `cli:"-v, --verbose, Echo each SQL statement and its timing to stderr" env:"PG_TENANT_SETUP_VERBOSE"`
+		Operator         string `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+		Namespace        string `cli:"--namespace, Prefix for the database, schema and tenant names of every request" env:"PG_TENANT_SETUP_NAMESPACE"`
+		AllowBlueprints  bool   `cli:"--allow-request-blueprints, Let requests name their own blueprint file or directory on this host"`
+	}
+	mcli.Parse(&args)
+
+	// stdout carries the results, so SQL and credentials never go there on their own
+	os.Unsetenv("PG_TENANT_SETUP_DRY_RUN")
+	os.Unsetenv("PG_TENANT_SETUP_CREDENTIALS_STDOUT")
+	os.Unsetenv("PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE")
+
+	exportEnv("PG_TENANT_SETUP_DUAL_USERS", args.DualUsers)
+	exportEnv("PG_TENANT_SETUP_VERBOSE", args.Verbose)
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	setupNamespace(args.Namespace)
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLine)
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req pg.SchemaRequest
+		var result pg.SchemaResult
+
+		err := json.Unmarshal(line, &req)
+		switch {
+		case err != nil:
+			result = pg.SchemaResult{Error: fmt.Sprintf("invalid request: %v", err)}
+		case req.DBName == "" || req.SchemaName == "":
+			result = pg.SchemaResult{SchemaRequest: req, Error: "db and schema are required"}
+		case req.Blueprint != "" && !args.AllowBlueprints:
+			result = pg.SchemaResult{SchemaRequest: req, Error: "blueprints in requests need --allow-request-blueprints"}
+		default:
+			req.DBName = pg.Namespaced(req.DBName)
+			req.SchemaName = pg.Namespaced(req.SchemaName)
+			req.TenantName = pg.Namespaced(req.TenantName)
+
+			// the names go into DDL run as the tool's role
+			if err := pg.ValidateRequestNames(req); err != nil {
+				result = pg.SchemaResult{SchemaRequest: req, Error: err.Error()}
+				break
+			}
+
+			result = pgInstance.ProvisionSchema(ctx, req)
+		}
+
+		err = encoder.Encode(result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to write result: %v\n", err)
+			exit(1)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read requests: %v\n", err)
+		exit(1)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+)
+
+// exit ends every command, successful or not, so that its outputs are
+// uploaded even when it fails halfway
+func exit(code int) {
+	if !uploadOutputs() {
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// uploadOutputs copies the SQL log and the credentials file(s) to object
+// storage once a command has finished, using the aws and gcloud CLIs so that
+// their usual credential chains apply. It reports whether every upload
+// succeeded.
+func uploadOutputs() (ok bool) {
+	uri := os.Getenv("PG_TENANT_SETUP_UPLOAD_URI")
+	if uri == "" || os.Getenv("PG_TENANT_SETUP_DRY_RUN") != "" {
+		return true
+	}
+
+	var files []string
+	if f := os.Getenv("PG_TENANT_SETUP_OUTPUT_SQL_FILE"); f != "" {
+		files = append(files, f)
+	}
+
+	if f := os.Getenv("PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"); f != "" {
+		files = append(files, pg.CredentialsFiles(f)...)
+	}
+
+	ctx := context.Background()
+
+	ok = true
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			continue
+		}
+
+		err := uploadFile(ctx, f, strings.TrimSuffix(uri, "/")+"/"+path.Base(filepath.ToSlash(f)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to upload %s: %v\n", f, err)
+			ok = false
+		}
+	}
+
+	return
+}
+
+func uploadFile(ctx context.Context, filename string, uri string) error {
+	sse := os.Getenv("PG_TENANT_SETUP_UPLOAD_SSE")
+	kmsKey := os.Getenv("PG_TENANT_SETUP_UPLOAD_KMS_KEY")
+
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(uri, "s3://"):
+		args := []string{"s3", "cp", "--only-show-errors", filename, uri}
+		if sse != "" {
+			args = append(args, "--sse", sse)
+		}
+		if kmsKey != "" {
+			args = append(args, "--sse-kms-key-id", kmsKey)
+		}
+		cmd = exec.CommandContext(ctx, "aws", args...)
+	case strings.HasPrefix(uri, "gs://"):
+		// GCS always encrypts at rest, a KMS key makes it customer-managed
+		args := []string{"storage", "cp", filename, uri}
+		if kmsKey != "" {
+			args = append(args, "--encryption-key", kmsKey)
+		}
+		cmd = exec.CommandContext(ctx, "gcloud", args...)
+	default:
+		return fmt.Errorf("unsupported upload URI %s, must start with s3:// or gs://", uri)
+	}
+
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
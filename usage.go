@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+func reportUsage() {
+	var args struct {
+		ConnectionString string        `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		Endpoint         string        `cli:"--endpoint, URL to POST the usage snapshots to as JSON instead of printing them" env:"PG_TENANT_SETUP_USAGE_ENDPOINT"`
+		EndpointToken    string        `cli:"#E, Bearer token sent to the usage endpoint" env:"PG_TENANT_SETUP_USAGE_TOKEN"`
+		Interval         time.Duration `cli:"--interval, Keep running and take a snapshot at this interval, e.g. 1h"`
+		ReadOnly         bool          `cli:"--read-only, Only run catalog queries and fail on any statement that would change the cluster" env:"PG_TENANT_SETUP_READ_ONLY"`
+		Operator         string        `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+		Namespace        string        `cli:"--namespace, Only report tenants in this namespace" env:"PG_TENANT_SETUP_NAMESPACE"`
+	}
+	mcli.Parse(&args)
+
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	exportEnv("PG_TENANT_SETUP_READ_ONLY", args.ReadOnly)
+	setupNamespace(args.Namespace)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	for {
+		usage, err := pgInstance.UsageSnapshot(ctx)
+		if err == nil {
+			err = sendUsage(ctx, client, args.Endpoint, args.EndpointToken, usage)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to report usage: %v\n", err)
+			// a one-off run fails, a periodic one tries again next time
+			if args.Interval == 0 {
+				exit(1)
+			}
+		}
+
+		if args.Interval == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(args.Interval):
+		}
+	}
+}
+
+// sendUsage POSTs a usage snapshot to the endpoint, or prints it to stdout
+// when there is none
+func sendUsage(ctx context.Context, client *http.Client, endpoint string, token string, usage []pg.TenantUsage) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("unable to marshal usage: %w", err)
+	}
+
+	if endpoint == "" {
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	err = postJSON(ctx, client, endpoint, token, data)
+	if err != nil {
+		return fmt.Errorf("unable to post usage: %w", err)
+	}
+
+	return nil
+}
+
+// postJSON POSTs a JSON document to an endpoint, with a bearer token when
+// there is one
+func postJSON(ctx context.Context, client *http.Client, endpoint string, token string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to build request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("endpoint returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/jxskiss/mcli"
+)
+
+// set at build time with -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// DROP DATABASE ... WITH (FORCE) needs PostgreSQL 13
+const (
+	minPostgresVersion = "13"
+	maxPostgresVersion = "17"
+)
+
+type versionInfo struct {
+	Version            string `json:"version"`
+	Commit             string `json:"commit"`
+	Date               string `json:"date"`
+	GoVersion          string `json:"goVersion"`
+	MinPostgresVersion string `json:"minPostgresVersion"`
+	MaxPostgresVersion string `json:"maxPostgresVersion"`
+}
+
+func buildVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:            version,
+		Commit:             commit,
+		Date:               date,
+		GoVersion:          runtime.Version(),
+		MinPostgresVersion: minPostgresVersion,
+		MaxPostgresVersion: maxPostgresVersion,
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	if info.Version == "dev" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+		info.Version = buildInfo.Main.Version
+	}
+
+	for _, setting := range buildInfo.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "":
+			info.Date = setting.Value
+		}
+	}
+
+	return info
+}
+
+func printVersion() {
+	var args struct {
+		JSON bool `cli:"--json, Print version information as JSON"`
+	}
+	mcli.Parse(&args)
+
+	info := buildVersionInfo()
+
+	if args.JSON {
+		data, err := json.Marshal(info)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to marshal version information: %v\n", err)
+			exit(1)
+		}
+		fmt.Printf("%s\n", data)
+		return
+	}
+
+	fmt.Printf("version:    %s\n", info.Version)
+	fmt.Printf("commit:     %s\n", info.Commit)
+	fmt.Printf("date:       %s\n", info.Date)
+	fmt.Printf("go:         %s\n", info.GoVersion)
+	fmt.Printf("postgresql: %s - %s\n", info.MinPostgresVersion, info.MaxPostgresVersion)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+)
+
+const (
+	driftActionAlert     = "alert"
+	driftActionReconcile = "reconcile"
+)
+
+// watchTarget is a tenant schema watched for drift, with what to do about it
+type watchTarget struct {
+	pg.SchemaRequest
+	Action string
+}
+
+// Drift is how a watched tenant schema differs from the state create-schema
+// leaves it in, and what was done about it
+type Drift struct {
+	Database   string   `json:"db"`
+	Schema     string   `json:"schema"`
+	Tenant     string   `json:"tenant,omitempty"`
+	Action     string   `json:"action"`
+	Problems   []string `json:"problems"`
+	Reconciled bool     `json:"reconciled"`
+	Error      string   `json:"error,omitempty"`
+}
+
+func watch() {
+	var args struct {
+		ConnectionString string        `cli:"-c, --connection-string, PostgreSQL connection string" env:"PG_TENANT_SETUP_CONNECTION_STRING"`
+		TenantsFile      string        `cli:"#R, --tenants-file, CSV file of the watched tenant schemas, with db, schema, tenant and action columns"`
+		Action           string        `cli:"--action, What to do about drift for rows without an action: alert or reconcile" default:"alert"`
+		Interval         time.Duration `cli:"--interval, Keep running and check at this interval, e.g. 15m"`
+		Endpoint         string        `cli:"--endpoint, URL to POST the drift of each check that finds any to as JSON" env:"PG_TENANT_SETUP_DRIFT_ENDPOINT"`
+		EndpointToken    string        `cli:"#E, Bearer token sent to the drift endpoint" env:"PG_TENANT_SETUP_DRIFT_TOKEN"`
+		Verbose          bool          `cli:"-v, --verbose, Echo each SQL statement and its timing to stderr" env:"PG_TENANT_SETUP_VERBOSE"`
+		Operator         string        `cli:"--operator, Operator name recorded as app.operator on every session for auditing" env:"PG_TENANT_SETUP_OPERATOR"`
+		Namespace        string        `cli:"--namespace, Prefix for the database, schema and tenant names of every row" env:"PG_TENANT_SETUP_NAMESPACE"`
+		CredentialsFile  string        `cli:"#E, File name to save the credentials of users reconcile recreates to, required with the reconcile action" env:"PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE"`
+	}
+	mcli.Parse(&args)
+
+	// stdout carries the drift, so the credentials of users reconcile has to
+	// recreate only go to the credentials file
+	os.Unsetenv("PG_TENANT_SETUP_DRY_RUN")
+	os.Unsetenv("PG_TENANT_SETUP_CREDENTIALS_STDOUT")
+	os.Unsetenv("PG_TENANT_SETUP_NO_CREDENTIALS_OUTPUT")
+
+	exportEnv("PG_TENANT_SETUP_VERBOSE", args.Verbose)
+	exportEnvValue("PG_TENANT_SETUP_OPERATOR", args.Operator)
+	setupNamespace(args.Namespace)
+
+	targets, err := readWatchTargets(args.TenantsFile, args.Action)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read %s: %v\n", args.TenantsFile, err)
+		exit(1)
+	}
+
+	for _, target := range targets {
+		if target.Action == driftActionReconcile && args.CredentialsFile == "" {
+			fmt.Fprintf(os.Stderr, "the reconcile action needs PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE for the users it recreates\n")
+			exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pgInstance := connect(ctx, args.ConnectionString)
+	defer pgInstance.Close()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	encoder := json.NewEncoder(os.Stdout)
+
+	for {
+		var drifts []Drift
+		for _, target := range targets {
+			drift, ok := checkDrift(ctx, pgInstance, target)
+			if !ok {
+				continue
+			}
+
+			drifts = append(drifts, drift)
+
+			err = encoder.Encode(drift)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "unable to write drift: %v\n", err)
+				exit(1)
+			}
+		}
+
+		unresolved := 0
+		for _, drift := range drifts {
+			if !drift.Reconciled {
+				unresolved++
+			}
+		}
+
+		err = reportDrift(ctx, client, args.Endpoint, args.EndpointToken, drifts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			// a one-off run fails, a periodic one tries again next time
+			if args.Interval == 0 {
+				exit(1)
+			}
+		}
+
+		if args.Interval == 0 {
+			if unresolved > 0 {
+				exit(1)
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(args.Interval):
+		}
+	}
+}
+
+// readWatchTargets reads the watched tenant schemas like the rows of
+// create-schema --from-csv, with an action column overriding the default
+func readWatchTargets(filename string, defaultAction string) (targets []watchTarget, err error) {
+	err = readCSVRows(filename, "schema", func(line int, field func(name string) string) error {
+		target := watchTarget{
+			SchemaRequest: pg.SchemaRequest{
+				DBName:     pg.Namespaced(field("db")),
+				SchemaName: pg.Namespaced(field("schema")),
+				TenantName: pg.Namespaced(field("tenant")),
+			},
+			Action: field("action"),
+		}
+
+		if target.Action == "" {
+			target.Action = defaultAction
+		}
+
+		if target.Action != driftActionAlert && target.Action != driftActionReconcile {
+			return fmt.Errorf("line %d: unknown action %q, must be %s or %s", line, target.Action, driftActionAlert, driftActionReconcile)
+		}
+
+		if target.DBName == "" || target.SchemaName == "" {
+			return fmt.Errorf("line %d: db and schema are required", line)
+		}
+
+		// the names go into DDL when the schema is reconciled
+		err := pg.ValidateRequestNames(target.SchemaRequest)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		targets = append(targets, target)
+		return nil
+	})
+
+	return
+}
+
+// checkDrift compares a watched schema with its expected state and reconciles
+// it when its action says so. It reports whether there is anything to report.
+func checkDrift(ctx context.Context, pgInstance *pg.Postgres, target watchTarget) (drift Drift, ok bool) {
+	drift = Drift{
+		Database: target.DBName,
+		Schema:   target.SchemaName,
+		Tenant:   target.TenantName,
+		Action:   target.Action,
+	}
+
+	problems, err := pgInstance.TenantSchemaDrift(ctx, target.SchemaName, target.TenantName, target.DBName)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift, true
+	}
+
+	if len(problems) == 0 {
+		return drift, false
+	}
+
+	drift.Problems = problems
+
+	if target.Action != driftActionReconcile {
+		return drift, true
+	}
+
+	err = pgInstance.ReconcileTenantSchema(ctx, target.SchemaName, target.TenantName, pg.ConnectDBConfig{DBName: target.DBName})
+	if err != nil {
+		drift.Error = fmt.Sprintf("unable to reconcile: %v", err)
+		return drift, true
+	}
+
+	remaining, err := pgInstance.TenantSchemaDrift(ctx, target.SchemaName, target.TenantName, target.DBName)
+	if err != nil {
+		drift.Error = err.Error()
+		return drift, true
+	}
+
+	if len(remaining) > 0 {
+		drift.Error = fmt.Sprintf("still drifted after reconcile: %v", remaining)
+		return drift, true
+	}
+
+	drift.Reconciled = true
+	return drift, true
+}
+
+// reportDrift posts the drift of a check to the endpoint when there is any,
+// reconciled drift included, so that it can be audited
+func reportDrift(ctx context.Context, client *http.Client, endpoint string, token string, drifts []Drift) error {
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "found drift in %d tenant schemas\n", len(drifts))
+
+	if endpoint == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(drifts)
+	if err != nil {
+		return fmt.Errorf("unable to marshal drift: %w", err)
+	}
+
+	err = postJSON(ctx, client, endpoint, token, data)
+	if err != nil {
+		return fmt.Errorf("unable to post drift: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadWatchTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantActions []string
+		wantErr     bool
+	}{
+		{
+			name:        "default and per-row actions",
+			data:        "db,schema,tenant,action\nacme,app,acme,\nacme,billing,acme,reconcile\n",
+			wantActions: []string{driftActionAlert, driftActionReconcile},
+		},
+		{
+			name:    "unknown action",
+			data:    "db,schema,action\nacme,app,drop\n",
+			wantErr: true,
+		},
+		{
+			name:    "missing db",
+			data:    "db,schema\n,app\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid schema name",
+			data:    "db,schema\nacme,app; DROP SCHEMA public\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "tenants.csv")
+			err := os.WriteFile(filename, []byte(tt.data), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			targets, err := readWatchTargets(filename, driftActionAlert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readWatchTargets() error = %v, want error %t", err, tt.wantErr)
+			}
+
+			var actions []string
+			for _, target := range targets {
+				actions = append(actions, target.Action)
+			}
+
+			if !tt.wantErr && len(actions) != len(tt.wantActions) {
+				t.Fatalf("actions = %v, want %v", actions, tt.wantActions)
+			}
+			for i := range tt.wantActions {
+				if actions[i] != tt.wantActions[i] {
+					t.Errorf("actions = %v, want %v", actions, tt.wantActions)
+				}
+			}
+		})
+	}
+}
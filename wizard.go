@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andreswebs/pg-tenant-setup/pg"
+	"github.com/jxskiss/mcli"
+	"golang.org/x/term"
+)
+
+type wizardAnswers struct {
+	DBName      string
+	CreateDB    bool
+	TenantName  string
+	SchemaNames []string
+}
+
+// wizard asks for what create-database and create-schema take as names, and
+// takes every other setting from the same flags and environment as they do
+func wizard() {
+	var args struct {
+		SetupArgs
+	}
+	mcli.Parse(&args)
+
+	in := bufio.NewReader(os.Stdin)
+
+	var answers wizardAnswers
+	if args.ConnectionString == "" && args.ConnectionSecret == "" {
+		// not echoed since it may contain a password
+		args.ConnectionString = promptSecret(in, "Connection string")
+	}
+	answers.DBName = prompt(in, "Database name", "")
+	if answers.DBName == "" {
+		fmt.Fprintf(os.Stderr, "a database name is required\n")
+		exit(1)
+	}
+	answers.CreateDB = confirm(in, "Create (or recreate) the database?")
+	answers.TenantName = prompt(in, "Tenant name", answers.DBName)
+
+	for _, name := range strings.Split(prompt(in, "Schema names, comma-separated", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			answers.SchemaNames = append(answers.SchemaNames, name)
+		}
+	}
+
+	if len(answers.SchemaNames) > 0 && !args.DualUsers {
+		args.DualUsers = confirm(in, "Create blue/green pairs of schema users?")
+	}
+
+	if !answers.CreateDB && len(answers.SchemaNames) == 0 {
+		fmt.Fprintf(os.Stderr, "nothing to do\n")
+		exit(1)
+	}
+
+	// passwords are only ever shown once, so without a credentials file they
+	// are printed
+	if len(answers.SchemaNames) > 0 && args.OutputCredentialsFile == "" && !args.CredentialsStdout && !args.NoCredentialsOutput {
+		if args.OutputSQLFile != "" || args.OutputRollbackFile != "" || args.PoolerConfigFile != "" {
+			fmt.Fprintf(os.Stderr, "set PG_TENANT_SETUP_OUTPUT_CREDENTIALS_FILE to keep the schema users credentials\n")
+			exit(1)
+		}
+		args.CredentialsStdout = true
+	}
+
+	common := CommonArgs{SetupArgs: args.SetupArgs, DBName: answers.DBName, TenantName: answers.TenantName}
+	setupOutput(&common)
+	answers.DBName = common.DBName
+	answers.TenantName = common.TenantName
+	for i, schemaName := range answers.SchemaNames {
+		answers.SchemaNames[i] = pg.Namespaced(schemaName)
+	}
+
+	ctx := context.Background()
+
+	pgInstance := connect(ctx, common.ConnectionString)
+	defer pgInstance.Close()
+
+	fmt.Printf("\nPlanned SQL:\n\n")
+
+	planOnly := args.DryRun
+	os.Setenv("PG_TENANT_SETUP_DRY_RUN", "true")
+	err := runWizard(ctx, pgInstance, answers)
+	if !planOnly {
+		os.Unsetenv("PG_TENANT_SETUP_DRY_RUN")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to plan tenant objects: %v\n", err)
+		exit(1)
+	}
+
+	if planOnly {
+		return
+	}
+
+	fmt.Println()
+	if !confirm(in, "Apply these changes?") {
+		fmt.Fprintf(os.Stderr, "aborted\n")
+		exit(1)
+	}
+
+	err = runWizard(ctx, pgInstance, answers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create new tenant objects: %v\n", err)
+		exit(1)
+	}
+}
+
+// runWizard provisions the schemas as one batch, like create-schema
+// --from-csv, so their credentials are written out together
+func runWizard(ctx context.Context, pgInstance *pg.Postgres, answers wizardAnswers) (err error) {
+	// the plan is a dry run, outputs are written when it is applied
+	planning := os.Getenv("PG_TENANT_SETUP_DRY_RUN") != ""
+
+	if answers.CreateDB {
+		err = pgInstance.NewTenantDB(ctx, answers.DBName, answers.TenantName)
+		if err != nil {
+			return
+		}
+
+		if !planning {
+			gitHubOutputDB(answers.DBName, answers.TenantName)
+		}
+	}
+
+	if len(answers.SchemaNames) == 0 {
+		return
+	}
+
+	var requests []pg.SchemaRequest
+	for _, schemaName := range answers.SchemaNames {
+		requests = append(requests, pg.SchemaRequest{DBName: answers.DBName, SchemaName: schemaName, TenantName: answers.TenantName})
+	}
+
+	err = pgInstance.NewTenantSchemas(ctx, requests)
+	if err != nil {
+		return
+	}
+
+	if !planning {
+		gitHubOutputSchemas(requests)
+	}
+
+	return
+}
+
+func prompt(in *bufio.Reader, label string, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, defaultValue)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintf(os.Stderr, "\n")
+		exit(1)
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultValue
+	}
+
+	return line
+}
+
+// promptSecret is prompt without echoing the answer on a terminal. Piped
+// input isn't echoed anyway and is read like any other answer.
+func promptSecret(in *bufio.Reader, label string) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return prompt(in, label, "")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+
+	line, err := term.ReadPassword(fd)
+	fmt.Fprintf(os.Stderr, "\n")
+	if err != nil {
+		exit(1)
+	}
+
+	return strings.TrimSpace(string(line))
+}
+
+func confirm(in *bufio.Reader, label string) bool {
+	answer := strings.ToLower(prompt(in, label+" (y/N)", ""))
+	return answer == "y" || answer == "yes"
+}